@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"pg_lineage/internal/catalog"
+	writer "pg_lineage/internal/lineage-writer"
+	C "pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+var catalogOutput string
+
+func catalogExportFlags(fs *flag.FlagSet) {
+	fs.StringVar(&catalogOutput, "o", "", "output file, <label>.catalog.json when empty; only valid with a single data source")
+}
+
+// catalogExport 将选中数据源的 catalog 导出为快照文件，供 parse -catalog 等离线场景使用
+func catalogExport(a *app, args []string) error {
+	services := a.postgresServices("")
+	if len(services) == 0 {
+		return errors.New("no data source selected")
+	}
+	if catalogOutput != "" && len(services) > 1 {
+		return fmt.Errorf("-o requires exactly one data source, %d selected, use -label", len(services))
+	}
+
+	var errs []error
+	for _, conf := range services {
+		path := catalogOutput
+		if path == "" {
+			path = conf.Label + ".catalog.json"
+		}
+
+		if err := exportCatalog(&conf, path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", conf.Label, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func exportCatalog(conf *C.PostgresService, path string) error {
+	db, err := writer.InitPGClient(conf)
+	if err != nil {
+		return err
+	}
+	defer safeClose(conf.Label, db)
+
+	s, err := catalog.Export(db, conf.Label, conf.DBName)
+	if err != nil {
+		return err
+	}
+	if err := s.Save(path); err != nil {
+		return err
+	}
+
+	log.Infof("Catalog of %s exported to %s: %d functions, %d relations", conf.Label, path, len(s.Functions), len(s.Relations))
+	return nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/internal/erd"
+	"pg_lineage/internal/lineage"
+	writer "pg_lineage/internal/lineage-writer"
+	"pg_lineage/internal/service"
+	C "pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+	"pg_lineage/pkg/log"
+)
+
+type QueryStore struct {
+	Query     string
+	Calls     int64
+	TotalTime float64
+	MinTime   float64
+	MaxTime   float64
+	MeanTime  float64
+}
+
+var (
+	collectReset   bool
+	collectWithERD bool
+)
+
+func collectPGFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&collectReset, "reset", true, "reset the lineage graph before collecting")
+	fs.BoolVar(&collectWithERD, "erd", true, "also extract join relationships between tables from the same queries")
+}
+
+// collectPG 解析 pg_stat_statements 中的查询生成表级血缘，再补全表统计信息
+func collectPG(a *app, args []string) error {
+	wm, err := a.writerManager()
+	if err != nil {
+		return err
+	}
+	defer safeClose("lineage writers", wm)
+
+	if collectReset {
+		if err := wm.ResetGraph(); err != nil {
+			return fmt.Errorf("ResetGraph: %w", err)
+		}
+	}
+
+	// 目前仅支持 PG 高版本的血缘解析
+	for _, dsConf := range a.postgresServices(service.DBTypePostgres) {
+		processDataSource(dsConf, wm)
+	}
+	return nil
+}
+
+// collectGreenplum Greenplum 没有 pg_stat_statements，只补全表统计信息
+func collectGreenplum(a *app, args []string) error {
+	wm, err := a.writerManager()
+	if err != nil {
+		return err
+	}
+	defer safeClose("lineage writers", wm)
+
+	for _, dsConf := range a.postgresServices(service.DBTypeGreenplum) {
+		log.Infof("Processing data source: %s", dsConf.Label)
+
+		db, err := writer.InitPGClient(&dsConf)
+		if err != nil {
+			log.Errorf("Failed to connect to data source %s: %v", dsConf.Label, err)
+			continue
+		}
+		if err := completeLineageGraph(dsConf, db, wm); err != nil {
+			log.Errorf("Complete graph update error for %s: %v", dsConf.Label, err)
+		}
+		safeClose(dsConf.Label, db)
+	}
+	return nil
+}
+
+func processDataSource(conf C.PostgresService, wm *writer.WriterManager) {
+	log.Infof("Processing data source: %s", conf.Label)
+
+	db, err := writer.InitPGClient(&conf)
+	if err != nil {
+		log.Errorf("Failed to connect to data source %s: %v", conf.Label, err)
+		return
+	}
+	defer safeClose(conf.Label, db)
+
+	queries, err := fetchQueryStats(db, conf.DBName)
+	if err != nil {
+		log.Errorf("Error fetching query stats for %s: %v", conf.Label, err)
+		return
+	}
+	defer queries.Close()
+
+	// 血缘与 ERD 解析同一批查询，共用函数、表的定义
+	cat := catalog.NewCache(catalog.NewDB(db))
+	for queries.Next() {
+		var qs QueryStore
+		if err := queries.Scan(&qs.Query, &qs.Calls, &qs.TotalTime, &qs.MinTime, &qs.MaxTime, &qs.MeanTime); err != nil {
+			log.Warnf("Query row scan error: %v", err)
+			continue
+		}
+		handleQueryLineage(&qs, conf, cat, wm)
+		if collectWithERD {
+			handleQueryERD(&qs, conf, cat, wm)
+		}
+	}
+
+	if err := completeLineageGraph(conf, db, wm); err != nil {
+		log.Errorf("Complete graph update error for %s: %v", conf.Label, err)
+		return
+	}
+}
+
+func fetchQueryStats(db *sql.DB, dbName string) (*sql.Rows, error) {
+	// 获取 PostgreSQL 版本
+	var versionStr string
+	err := db.QueryRow("SHOW server_version;").Scan(&versionStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres version: %w", err)
+	}
+
+	// 提取主版本号
+	re := regexp.MustCompile(`^(\d+)\.?(\d+)?`)
+	matches := re.FindStringSubmatch(versionStr)
+	if len(matches) < 2 {
+		return nil, fmt.Errorf("could not parse version string: %s", versionStr)
+	}
+	major, _ := strconv.Atoi(matches[1])
+	// minor := 0
+	// if len(matches) > 2 && matches[2] != "" {
+	// 	minor, _ = strconv.Atoi(matches[2])
+	// }
+
+	// 针对不同版本选择字段
+	var query string
+	if major >= 13 {
+		// PostgreSQL 13+ 使用 *_exec_time
+		query = fmt.Sprintf(`
+			SELECT
+				s.query, s.calls, s.total_exec_time AS total_time,
+				s.min_exec_time AS min_time,
+				s.max_exec_time AS max_time,
+				s.mean_exec_time AS mean_time
+			FROM pg_stat_statements s
+			JOIN pg_database d ON d.oid = s.dbid
+			WHERE d.datname = '%s' AND calls > 10
+			ORDER BY s.mean_exec_time DESC
+			LIMIT 1000;`, dbName)
+	} else {
+		// PostgreSQL < 13 使用 *_time
+		query = fmt.Sprintf(`
+			SELECT
+				s.query, s.calls, s.total_time,
+				s.min_time, s.max_time, s.mean_time
+			FROM pg_stat_statements s
+			JOIN pg_database d ON d.oid = s.dbid
+			WHERE d.datname = '%s' AND calls > 10
+			ORDER BY s.mean_time DESC
+			LIMIT 1000;`, dbName)
+	}
+
+	return db.Query(query)
+}
+
+func handleQueryLineage(qs *QueryStore, conf C.PostgresService, cat catalog.Catalog, wm *writer.WriterManager) {
+	var graph *depgraph.Graph
+	udf, err := lineage.IdentifyFuncCall(qs.Query)
+	if err == nil {
+		graph, err = lineage.HandleUDF4Lineage(cat, udf)
+	} else {
+		graph, err = lineage.Parse(qs.Query)
+		graph = lineage.ResolveTables(cat, graph)
+	}
+
+	if err != nil {
+		log.Debugf("Skip invalid query: %s, err: %v", trimQuery(qs.Query), err)
+		return
+	}
+
+	udf.Calls = qs.Calls
+	udf.MeanTime = qs.MeanTime
+	udf.Query = qs.Query
+	graph.SetNamespace(conf.Label)
+
+	log.Debugf("Lineage Graph for query: %s", trimQuery(qs.Query))
+	layers, err := graph.TopoSortedLayers()
+	for i, layer := range layers {
+		log.Debugf("Layer %d: %s", i, strings.Join(layer, ", "))
+	}
+	if err != nil {
+		log.Debugf("Layer: %v", err)
+	}
+
+	// 存储中的表需带 schema，catalog 中也找不到 schema 的表与临时表一样去掉，连接其上下游
+	shrunk := graph.Shrink(depgraph.ShrinkOptions{
+		Remove: []depgraph.NodeClass{depgraph.ClassCTE, depgraph.ClassTemp, depgraph.ClassUnresolved},
+	})
+	if err := wm.CreateGraphPostgres(shrunk, udf, conf); err != nil {
+		log.Errorf("Failed to write lineage graph: %v", err)
+	}
+}
+
+// handleQueryERD 从同一条查询（或函数定义）中提取表间的关联，表节点与血缘的为同一个
+func handleQueryERD(qs *QueryStore, conf C.PostgresService, cat catalog.Catalog, wm *writer.WriterManager) {
+	relationShips, err := parseERD(cat, qs.Query)
+	if err != nil {
+		log.Debugf("Skip ERD of query: %s, err: %v", trimQuery(qs.Query), err)
+		return
+	}
+
+	joins := erd.Joins(relationShips, conf.Label, qs.Calls)
+	if len(joins) == 0 {
+		return
+	}
+	if err := wm.CreateGraphERD(joins, conf); err != nil {
+		log.Errorf("Failed to write ERD relationships: %v", err)
+	}
+}
+
+// completeLineageGraph 补全表的扫描统计及注释，Greenplum 从 gp_stat_user_tables 汇总各 segment 的统计
+func completeLineageGraph(conf C.PostgresService, db *sql.DB, wm *writer.WriterManager) error {
+	statView := "pg_stat_user_tables"
+	if conf.Type == service.DBTypeGreenplum {
+		statView = "gp_stat_user_tables"
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			COALESCE(p.relname, st.relname) AS relname,
+			COALESCE(n.nspname, st.schemaname) AS schemaname,
+			SUM(st.seq_scan) AS seq_scan,
+			SUM(st.seq_tup_read) AS seq_tup_read,
+			SUM(COALESCE(st.idx_scan, 0)) AS idx_scan,
+			SUM(COALESCE(st.idx_tup_fetch, 0)) AS idx_tup_fetch,
+			STRING_AGG(DISTINCT COALESCE(obj_description(st.relid), ''), ' | ') AS comment
+		FROM ` + statView + ` st
+		LEFT JOIN pg_inherits i ON st.relid = i.inhrelid
+		LEFT JOIN pg_class p ON i.inhparent = p.oid
+		LEFT JOIN pg_namespace n ON p.relnamespace = n.oid
+		WHERE st.schemaname !~ '^pg_temp_'
+		AND st.schemaname !~ '_del$'
+		AND st.schemaname NOT IN ('sync', 'sync_his', 'partman', 'debug')
+		GROUP BY COALESCE(p.relname, st.relname),
+				COALESCE(n.nspname, st.schemaname)
+		ORDER BY schemaname, relname;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query table stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t service.Table
+		if err := rows.Scan(
+			&t.RelName, &t.SchemaName,
+			&t.SeqScan, &t.SeqTupRead,
+			&t.IdxScan, &t.IdxTupFetch,
+			&t.Comment,
+		); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+		t.Database = conf.Label
+
+		if err := wm.CompleteTableNode(&t, conf); err != nil {
+			return fmt.Errorf("failed to complete node: %w", err)
+		}
+	}
+
+	log.Infof("Lineage node metadata updated for: %s", conf.Label)
+	return nil
+}
+
+func trimQuery(query string) string {
+	if len(query) > 80 {
+		return query[:80] + "..."
+	}
+	return query
+}
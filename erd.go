@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/internal/erd"
+	"pg_lineage/internal/lineage"
+	writer "pg_lineage/internal/lineage-writer"
+	"pg_lineage/internal/service"
+	C "pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+var (
+	erdCandidates bool
+	erdCatalog    string
+	erdFormat     string
+)
+
+func erdFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&erdCandidates, "candidates", false, "rank foreign key candidates by confidence instead of listing relationships")
+	fs.StringVar(&erdCatalog, "catalog", "", "catalog snapshot file used for SQL files: constraints, column types and UDF definitions")
+	fs.StringVar(&erdFormat, "format", "text", "output format of -candidates: text | json")
+}
+
+// runERD 参数为 SQL 文件（- 为标准输入）；未指定文件时解析选中数据源 pg_stat_statements 中的查询
+func runERD(a *app, args []string) error {
+	if erdFormat != "text" && erdFormat != "json" {
+		return fmt.Errorf("unknown format: %s", erdFormat)
+	}
+
+	relationShips := make(map[string]*erd.RelationShip)
+	var candidates []*erd.Candidate
+
+	if len(args) > 0 {
+		var cat catalog.Catalog
+		if erdCatalog != "" {
+			snapshot, err := catalog.Load(erdCatalog)
+			if err != nil {
+				return err
+			}
+			cat = snapshot
+		}
+
+		inputs, err := readInputs(args)
+		if err != nil {
+			return err
+		}
+		stats := erd.NewStats()
+		for _, in := range inputs {
+			m, err := parseERD(cat, in.sql)
+			if err != nil {
+				log.Errorf("Parse %s error: %v", in.name, err)
+				continue
+			}
+			stats.Add(m, 1)
+			maps.Copy(relationShips, m)
+		}
+		if candidates, err = stats.Candidates(cat); err != nil {
+			return err
+		}
+	} else {
+		services := a.postgresServices(service.DBTypePostgres)
+		if len(services) == 0 {
+			return errors.New("no SQL file given and no postgres data source selected")
+		}
+		for _, conf := range services {
+			c, err := collectERD(&conf, relationShips)
+			if err != nil {
+				log.Errorf("Collect ERD for %s error: %v", conf.Label, err)
+			}
+			candidates = append(candidates, c...)
+		}
+	}
+
+	if erdCandidates {
+		return writeCandidates(os.Stdout, candidates)
+	}
+
+	var lines []string
+	for _, v := range relationShips {
+		// 过滤掉临时表
+		if v.SColumn == nil || v.TColumn == nil || v.SColumn.Schema == "" || v.TColumn.Schema == "" {
+			continue
+		}
+		lines = append(lines, v.ToString())
+	}
+	sort.Strings(lines)
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	return nil
+}
+
+// parseERD 函数调用在有 catalog 时取函数定义解析，否则按普通 SQL 解析；catalog 用于补全 schema 及确定不带别名的字段所属的表
+func parseERD(cat catalog.Catalog, sql string) (map[string]*erd.RelationShip, error) {
+	if cat != nil {
+		if udf, err := lineage.IdentifyFuncCall(sql); err == nil {
+			return erd.HandleUDF4ERD(cat, udf)
+		}
+	}
+	return erd.Parse(cat, sql)
+}
+
+// collectERD 解析一个数据源的查询，按该数据源的 catalog 给外键候选打分
+func collectERD(conf *C.PostgresService, relationShips map[string]*erd.RelationShip) ([]*erd.Candidate, error) {
+	db, err := writer.InitPGClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer safeClose(conf.Label, db)
+
+	queries, err := fetchQueryStats(db, conf.DBName)
+	if err != nil {
+		return nil, err
+	}
+	defer queries.Close()
+
+	// 同一张表在各查询中反复出现，缓存表的定义
+	cat := catalog.NewCache(catalog.NewDB(db))
+	stats := erd.NewStats()
+	for queries.Next() {
+		var qs QueryStore
+		if err := queries.Scan(&qs.Query, &qs.Calls, &qs.TotalTime, &qs.MinTime, &qs.MaxTime, &qs.MeanTime); err != nil {
+			log.Warnf("Query row scan error: %v", err)
+			continue
+		}
+
+		m, err := parseERD(cat, qs.Query)
+		if err != nil {
+			log.Debugf("Skip invalid query: %s, err: %v", trimQuery(qs.Query), err)
+			continue
+		}
+		stats.Add(m, qs.Calls)
+		maps.Copy(relationShips, m)
+	}
+	if err := queries.Err(); err != nil {
+		return nil, err
+	}
+	return stats.Candidates(cat)
+}
+
+// writeCandidates 文本格式每行一个候选：置信度 引用方 -> 被引用方 及依据
+func writeCandidates(out io.Writer, candidates []*erd.Candidate) error {
+	if erdFormat == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if candidates == nil {
+			candidates = []*erd.Candidate{}
+		}
+		return enc.Encode(candidates)
+	}
+
+	for _, c := range candidates {
+		var notes []string
+		if c.Declared {
+			notes = append(notes, "declared")
+		}
+		if c.Unique {
+			notes = append(notes, "unique")
+		}
+		if c.TypeMatch {
+			notes = append(notes, "type match")
+		}
+		notes = append(notes, fmt.Sprintf("queries %d", c.Queries), strings.Join(c.JoinTypes, "/"))
+		if _, err := fmt.Fprintf(out, "%.2f %s -> %s (%s)\n", c.Confidence, c.From.GetID(), c.To.GetID(), strings.Join(notes, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
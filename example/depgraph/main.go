@@ -62,7 +62,11 @@ func main() {
 	g.DependOn(r7, r5)
 
 	// 拓扑排序
-	for i, layer := range g.ShrinkGraph().TopoSortedLayers() {
+	layers, err := g.ShrinkGraph().TopoSortedLayers()
+	if err != nil {
+		fmt.Println(err)
+	}
+	for i, layer := range layers {
 		fmt.Printf("%d: %s\n", i, strings.Join(layer, ", "))
 	}
 	// Output:
@@ -59,7 +59,11 @@ func main() {
 	}
 
 	// 拓扑排序
-	for i, layer := range sqlTree.ShrinkGraph().TopoSortedLayers() {
+	layers, err := sqlTree.ShrinkGraph().TopoSortedLayers()
+	if err != nil {
+		log.Warn(err)
+	}
+	for i, layer := range layers {
 		log.Debugf("%d: %s\n", i, strings.Join(layer, ", "))
 	}
 }
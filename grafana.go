@@ -3,14 +3,13 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"net/url"
-	"os"
 	"regexp"
 	"strings"
 	"sync"
 
+	"pg_lineage/internal/catalog"
 	"pg_lineage/internal/lineage"
 	writer "pg_lineage/internal/lineage-writer"
 	"pg_lineage/internal/service"
@@ -22,8 +21,6 @@ import (
 	grafanaclient "github.com/grafana/grafana-openapi-client-go/client"
 	grafanasearch "github.com/grafana/grafana-openapi-client-go/client/search"
 	"github.com/grafana/grafana-openapi-client-go/models"
-	_ "github.com/lib/pq"
-	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 )
 
 // ServiceProvider 封装服务依赖
@@ -31,6 +28,8 @@ type ServiceProvider struct {
 	Grafana       GrafanaBundle
 	PG            map[string]*PGBundle
 	WriterManager *writer.WriterManager
+
+	dsCache *DataSourceCache
 }
 
 type GrafanaBundle struct {
@@ -39,8 +38,9 @@ type GrafanaBundle struct {
 }
 
 type PGBundle struct {
-	Client *sql.DB
-	Config *C.PostgresService
+	Client  *sql.DB
+	Catalog catalog.Catalog
+	Config  *C.PostgresService
 }
 
 type DataSourceCache struct {
@@ -48,81 +48,55 @@ type DataSourceCache struct {
 	mu sync.Mutex
 }
 
-var (
-	config  C.Config
-	dsCache *DataSourceCache
-)
-
-func init() {
-	configFile := flag.String("c", "../../config/config.yaml", "path to config.yaml")
-	flag.Parse()
-
-	var err error
-	if config, err = C.InitConfig(*configFile); err != nil {
-		fmt.Println("InitConfig err: ", err)
-		os.Exit(1)
-	}
-	if err = log.InitLogger(&config.Log); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	dsCache = &DataSourceCache{
-		ds: make(map[string]*models.DataSource),
+// collectGrafana 采集看板、面板，并解析面板 SQL 得到依赖的表；
+// -label 只影响连接哪些数据源，映射到未选中数据源的面板会跳过其依赖
+func collectGrafana(a *app, args []string) error {
+	wm, err := a.writerManager()
+	if err != nil {
+		return err
 	}
-}
-
-func main() {
-	// 初始化 WriterManager（内部根据 config.Storage 决定用哪种存储）
-	wm := mustInitWriterManager(&config.Storage)
-	defer wm.Close() // WriterManager 内部封装资源关闭逻辑
+	defer safeClose("lineage writers", wm)
 
-	// 初始化 Grafana 客户端
-	grafanaClient := mustInitGrafanaClient(&config.Service.Grafana)
-
-	// 初始化所有 PG 客户端并关联配置
-	pgMap := mustInitPGClients(config.Service.Postgres)
+	pgMap, err := initPGClients(a.postgresServices(""))
 	defer closePGClients(pgMap)
+	if err != nil {
+		return err
+	}
 
-	// 构造 ServiceProvider，聚合服务资源
 	sp := &ServiceProvider{
 		Grafana: GrafanaBundle{
-			Client: grafanaClient,
-			Config: &config.Service.Grafana,
+			Client: mustInitGrafanaClient(&a.config.Service.Grafana),
+			Config: &a.config.Service.Grafana,
 		},
 		PG:            pgMap,
 		WriterManager: wm,
+		dsCache:       &DataSourceCache{ds: make(map[string]*models.DataSource)},
 	}
 
-	// 核心处理
-	if err := processDashboards(sp); err != nil {
-		log.Fatal(err)
-	}
+	return processDashboards(sp)
 }
 
-func mustInitWriterManager(cfg *C.StorageConfig) *writer.WriterManager {
-	var neo4jDriver neo4j.Driver
-	var pgDriver *sql.DB
-	var err error
-
-	if cfg.Neo4j.Enabled {
-		neo4jDriver, err = writer.InitNeo4jDriver(&cfg.Neo4j)
+func initPGClients(pgConfigs []C.PostgresService) (map[string]*PGBundle, error) {
+	pgMap := make(map[string]*PGBundle)
+	for _, pgConf := range pgConfigs {
+		pgConf := pgConf
+		db, err := writer.InitPGClient(&pgConf)
 		if err != nil {
-			log.Fatal(err)
+			return pgMap, fmt.Errorf("failed to init pg client for label %s: %w", pgConf.Label, err)
 		}
-	}
-
-	if cfg.Postgres.Enabled {
-		pgDriver, err = writer.InitPGClient(&cfg.Postgres)
-		if err != nil {
-			log.Fatal(err)
+		pgMap[pgConf.Label] = &PGBundle{
+			Client:  db,
+			Catalog: catalog.NewDB(db),
+			Config:  &pgConf,
 		}
 	}
+	return pgMap, nil
+}
 
-	return writer.InitWriterManager(&writer.WriterContext{
-		Neo4jDriver: neo4jDriver,
-		PgDriver:    pgDriver,
-	})
+func closePGClients(pgMap map[string]*PGBundle) {
+	for label, pg := range pgMap {
+		safeClose(label, pg.Client)
+	}
 }
 
 func mustInitGrafanaClient(cfg *C.GrafanaService) *grafanaclient.GrafanaHTTPAPI {
@@ -141,34 +115,11 @@ func mustInitGrafanaClient(cfg *C.GrafanaService) *grafanaclient.GrafanaHTTPAPI
 	return grafanaclient.NewHTTPClientWithConfig(strfmt.Default, grafanaCfg)
 }
 
-func mustInitPGClients(pgConfigs []C.PostgresService) map[string]*PGBundle {
-	pgMap := make(map[string]*PGBundle)
-	for _, pgConf := range pgConfigs {
-		db, err := writer.InitPGClient(&pgConf)
-		if err != nil {
-			log.Fatalf("failed to init pg client for label %s: %v", pgConf.Label, err)
-		}
-		pgMap[pgConf.Label] = &PGBundle{
-			Client: db,
-			Config: &pgConf,
-		}
-	}
-	return pgMap
-}
-
-func closePGClients(pgMap map[string]*PGBundle) {
-	for label, pg := range pgMap {
-		if err := pg.Client.Close(); err != nil {
-			log.Warnf("failed to close PG client for %s: %v", label, err)
-		}
-	}
-}
-
 func processDashboards(sp *ServiceProvider) error {
 	typeVar := "dash-db"
 	pageVar := int64(1)
 	limitVar := int64(100)
-	dashIds := config.Service.Grafana.DashboardIDs
+	dashIds := sp.Grafana.Config.DashboardIDs
 
 	for {
 		params := grafanasearch.NewSearchParams().
@@ -268,13 +219,14 @@ func processDatasourceForPanel(sp *ServiceProvider, panel *service.Panel, dashbo
 		}
 	}
 }
-func resolveDatasource(client *grafanaclient.GrafanaHTTPAPI, ds any, dashboard *service.DashboardFullWithMeta) ([]*models.DataSource, error) {
+
+func (c *DataSourceCache) resolveDatasource(client *grafanaclient.GrafanaHTTPAPI, ds any, dashboard *service.DashboardFullWithMeta) ([]*models.DataSource, error) {
 	switch v := ds.(type) {
 	case string:
 		if strings.HasPrefix(v, "${") {
 			return nil, fmt.Errorf("template variable %s not resolved", v)
 		}
-		dsObj, err := getDatasourceByName(client, v)
+		dsObj, err := c.getDatasourceByName(client, v)
 		if err != nil {
 			return nil, err
 		}
@@ -287,7 +239,7 @@ func resolveDatasource(client *grafanaclient.GrafanaHTTPAPI, ds any, dashboard *
 		}
 
 		if !strings.HasPrefix(uid, "${") {
-			dsObj, err := getDatasourceByUid(client, uid)
+			dsObj, err := c.getDatasourceByUid(client, uid)
 			if err != nil {
 				return nil, err
 			}
@@ -307,7 +259,7 @@ func resolveDatasource(client *grafanaclient.GrafanaHTTPAPI, ds any, dashboard *
 
 		var result []*models.DataSource
 		for _, name := range dsNames {
-			dsObj, err := getDatasourceByName(client, name)
+			dsObj, err := c.getDatasourceByName(client, name)
 			if err != nil {
 				return nil, fmt.Errorf("error retrieving datasource '%s': %w", name, err)
 			}
@@ -358,11 +310,11 @@ func extractDatasourceName(client *grafanaclient.GrafanaHTTPAPI, t *service.Temp
 	return matched
 }
 
-func getDatasourceByName(client *grafanaclient.GrafanaHTTPAPI, name string) (*models.DataSource, error) {
-	dsCache.mu.Lock()
-	defer dsCache.mu.Unlock()
+func (c *DataSourceCache) getDatasourceByName(client *grafanaclient.GrafanaHTTPAPI, name string) (*models.DataSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if cachedDatasource, found := dsCache.ds[name]; found {
+	if cachedDatasource, found := c.ds[name]; found {
 		return cachedDatasource, nil
 	}
 
@@ -370,20 +322,20 @@ func getDatasourceByName(client *grafanaclient.GrafanaHTTPAPI, name string) (*mo
 	if err != nil {
 		return nil, err
 	}
-	dsCache.ds[name] = ds.Payload
+	c.ds[name] = ds.Payload
 
 	return ds.Payload, nil
 }
 
-func getDatasourceByUid(client *grafanaclient.GrafanaHTTPAPI, uid string) (*models.DataSource, error) {
+func (c *DataSourceCache) getDatasourceByUid(client *grafanaclient.GrafanaHTTPAPI, uid string) (*models.DataSource, error) {
 	if uid == "" {
 		return nil, fmt.Errorf("uid is empty")
 	}
 
-	dsCache.mu.Lock()
-	defer dsCache.mu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if cachedDatasource, found := dsCache.ds[uid]; found {
+	if cachedDatasource, found := c.ds[uid]; found {
 		return cachedDatasource, nil
 	}
 
@@ -391,7 +343,7 @@ func getDatasourceByUid(client *grafanaclient.GrafanaHTTPAPI, uid string) (*mode
 	if err != nil {
 		return nil, err
 	}
-	dsCache.ds[uid] = ds.Payload
+	c.ds[uid] = ds.Payload
 
 	return ds.Payload, nil
 }
@@ -411,7 +363,7 @@ func getPanelDependencies(sp *ServiceProvider, panel *service.Panel, dashboard *
 		}
 
 		// 获取所有解析出的数据源
-		dsList, err := resolveDatasource(sp.Grafana.Client, t.Datasource, dashboard)
+		dsList, err := sp.dsCache.resolveDatasource(sp.Grafana.Client, t.Datasource, dashboard)
 		if err != nil {
 			log.Warnf("Skipping unresolved datasource: %v", err)
 			continue
@@ -463,10 +415,11 @@ func parseRawSQL(rawsql string, pgBundle *PGBundle) ([]*service.Table, error) {
 	udf, err := lineage.IdentifyFuncCall(rawsql)
 	// TODO:引入 AI for lineage
 	if err == nil {
-		sqlTree, err = lineage.HandleUDF4Lineage(pgBundle.Client, udf)
+		sqlTree, err = lineage.HandleUDF4Lineage(pgBundle.Catalog, udf)
 	} else {
 		// TODO:如果 rawsql 中含有 Grafana 中的模版变量，则需要考虑先渲染模版变量，然后再做语法解析，否则会报语法错误
 		sqlTree, err = lineage.Parse(rawsql)
+		sqlTree = lineage.ResolveTables(pgBundle.Catalog, sqlTree)
 	}
 	if err != nil {
 		return nil, err
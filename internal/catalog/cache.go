@@ -0,0 +1,79 @@
+package catalog
+
+import (
+	"errors"
+	"sync"
+)
+
+// Cache 缓存另一个 Catalog 中函数、表的定义及 search_path，未找到的同样缓存；
+// 解析大量查询时避免每个字段都访问 pg_catalog，血缘与 ERD 解析同一函数时也只查询一次定义
+type Cache struct {
+	Catalog
+
+	mu        sync.Mutex
+	functions map[string]cachedFunction
+	relations map[string]cachedRelation
+	path      []string
+}
+
+type cachedFunction struct {
+	definition string
+	err        error
+}
+
+type cachedRelation struct {
+	r   *Relation
+	err error
+}
+
+func NewCache(c Catalog) *Cache {
+	return &Cache{
+		Catalog:   c,
+		functions: make(map[string]cachedFunction),
+		relations: make(map[string]cachedRelation),
+	}
+}
+
+func (c *Cache) FunctionDefinition(schema, name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.functions[schema+"."+name]; ok {
+		return v.definition, v.err
+	}
+	definition, err := c.Catalog.FunctionDefinition(schema, name)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		c.functions[schema+"."+name] = cachedFunction{definition: definition, err: err}
+	}
+	return definition, err
+}
+
+func (c *Cache) Relation(schema, name string) (*Relation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.relations[schema+"."+name]; ok {
+		return v.r, v.err
+	}
+	r, err := c.Catalog.Relation(schema, name)
+	// 连接中断等错误不缓存，下次重新查询
+	if err == nil || errors.Is(err, ErrNotFound) {
+		c.relations[schema+"."+name] = cachedRelation{r: r, err: err}
+	}
+	return r, err
+}
+
+func (c *Cache) SearchPath() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path != nil {
+		return c.path, nil
+	}
+	path, err := c.Catalog.SearchPath()
+	if err != nil {
+		return nil, err
+	}
+	c.path = path
+	return path, nil
+}
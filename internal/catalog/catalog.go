@@ -0,0 +1,174 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrNotFound = errors.New("not found in catalog")
+
+// Catalog 血缘解析需要查询的元数据，在线数据库（DB）与离线快照（Snapshot）都实现它
+type Catalog interface {
+	// FunctionDefinition pg_get_functiondef 的结果，同名重载时取第一个
+	FunctionDefinition(schema, name string) (string, error)
+	// Relation 表、视图、分区表等的定义，含字段、父表及视图定义
+	Relation(schema, name string) (*Relation, error)
+	// SearchPath 解析不带 schema 的表名时依次查找的 schema
+	SearchPath() ([]string, error)
+}
+
+// relkind 取值，与 pg_class.relkind 一致
+const (
+	RelKindTable            = "r"
+	RelKindPartitionedTable = "p"
+	RelKindView             = "v"
+	RelKindMaterializedView = "m"
+	RelKindForeignTable     = "f"
+)
+
+type Function struct {
+	Schema     string `json:"schema"`
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments,omitempty"` // pg_get_function_identity_arguments
+	Language   string `json:"language,omitempty"`
+	Definition string `json:"definition"` // pg_get_functiondef 的结果
+	Comment    string `json:"comment,omitempty"`
+}
+
+type Relation struct {
+	Schema         string       `json:"schema"`
+	Name           string       `json:"name"`
+	Kind           string       `json:"kind"`                      // pg_class.relkind
+	Persistence    string       `json:"persistence,omitempty"`     // pg_class.relpersistence
+	Parents        []string     `json:"parents,omitempty"`         // pg_inherits 中的父表，schema.name
+	ViewDefinition string       `json:"view_definition,omitempty"` // 视图、物化视图的 pg_get_viewdef
+	Comment        string       `json:"comment,omitempty"`
+	Columns        []Column     `json:"columns,omitempty"`
+	Constraints    []Constraint `json:"constraints,omitempty"` // 主键、唯一约束（含唯一索引）及外键
+}
+
+type Column struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // format_type 的结果
+	NotNull bool   `json:"not_null,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// pg_constraint.contype 取值，不属于约束的唯一索引也记为 ConstraintUnique
+const (
+	ConstraintPrimaryKey = "p"
+	ConstraintUnique     = "u"
+	ConstraintForeignKey = "f"
+)
+
+type Constraint struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"` // p | u | f
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"ref_table,omitempty"`   // 外键引用的表，schema.name
+	RefColumns []string `json:"ref_columns,omitempty"` // 外键引用的字段，与 Columns 一一对应
+}
+
+func (r *Relation) ID() string {
+	return r.Schema + "." + r.Name
+}
+
+func (r *Relation) IsView() bool {
+	return r.Kind == RelKindView || r.Kind == RelKindMaterializedView
+}
+
+func (r *Relation) Column(name string) (*Column, bool) {
+	for i := range r.Columns {
+		if r.Columns[i].Name == name {
+			return &r.Columns[i], true
+		}
+	}
+	return nil, false
+}
+
+// IsUnique 字段组合包含某个主键或唯一约束的全部字段时，组合的取值唯一
+func (r *Relation) IsUnique(columns ...string) bool {
+	for _, c := range r.Constraints {
+		if c.Type != ConstraintPrimaryKey && c.Type != ConstraintUnique {
+			continue
+		}
+		if len(c.Columns) > 0 && containsAll(columns, c.Columns) {
+			return true
+		}
+	}
+	return false
+}
+
+// References 是否有外键由 column 引用 refTable（schema.name）的 refColumn
+func (r *Relation) References(column, refTable, refColumn string) bool {
+	for _, c := range r.Constraints {
+		if c.Type != ConstraintForeignKey || c.RefTable != refTable {
+			continue
+		}
+		for i, col := range c.Columns {
+			if col == column && i < len(c.RefColumns) && c.RefColumns[i] == refColumn {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsAll(set, subset []string) bool {
+	for _, s := range subset {
+		if !slices.Contains(set, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveRelation 按 search_path 找到不带 schema 的表所在的 schema
+func ResolveRelation(c Catalog, name string) (*Relation, error) {
+	path, err := c.SearchPath()
+	if err != nil {
+		return nil, err
+	}
+	for _, schema := range path {
+		r, err := c.Relation(schema, name)
+		if err == nil {
+			return r, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("relation %s in search_path %v: %w", name, path, ErrNotFound)
+}
+
+// PartitionRoot 沿继承关系向上找到最顶层的父表，分区、子表的血缘统一记在父表上
+func PartitionRoot(c Catalog, schema, name string) (*Relation, error) {
+	r, err := c.Relation(schema, name)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{r.ID(): true}
+	for len(r.Parents) > 0 {
+		parentSchema, parentName := splitID(r.Parents[0])
+		parent, err := c.Relation(parentSchema, parentName)
+		if err != nil {
+			return nil, err
+		}
+		if seen[parent.ID()] {
+			break
+		}
+		seen[parent.ID()] = true
+		r = parent
+	}
+	return r, nil
+}
+
+func splitID(id string) (string, string) {
+	if schema, name, ok := strings.Cut(id, "."); ok {
+		return schema, name
+	}
+	return "", id
+}
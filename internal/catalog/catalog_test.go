@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// testSnapshot dw.orders 按月分区，dw.orders_2024_01 下还有二级分区；ods、public 中有同名的表
+func testSnapshot() *Snapshot {
+	return &Snapshot{
+		Version:   SnapshotVersion,
+		Label:     "test",
+		Schemas:   []string{"ods", "public"},
+		Functions: []Function{{Schema: "dw", Name: "f", Definition: "CREATE FUNCTION dw.f() ..."}},
+		Relations: []Relation{
+			{Schema: "dw", Name: "orders", Kind: RelKindPartitionedTable},
+			{Schema: "dw", Name: "orders_2024_01", Kind: RelKindPartitionedTable, Parents: []string{"dw.orders"}},
+			{Schema: "dw", Name: "orders_2024_01_a", Kind: RelKindTable, Parents: []string{"dw.orders_2024_01"}},
+			{Schema: "ods", Name: "users", Kind: RelKindTable},
+			{Schema: "public", Name: "users", Kind: RelKindTable},
+			{Schema: "public", Name: "items", Kind: RelKindTable},
+			{Schema: "public", Name: "loop_a", Kind: RelKindTable, Parents: []string{"public.loop_b"}},
+			{Schema: "public", Name: "loop_b", Kind: RelKindTable, Parents: []string{"public.loop_a"}},
+		},
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := testSnapshot().Save(path); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Version != SnapshotVersion || s.Label != "test" || len(s.Relations) != 8 {
+		t.Errorf("snapshot = %+v", s)
+	}
+	if def, err := s.FunctionDefinition("dw", "f"); err != nil || def != "CREATE FUNCTION dw.f() ..." {
+		t.Errorf("FunctionDefinition = %q, %v", def, err)
+	}
+	if r, err := s.Relation("dw", "orders_2024_01"); err != nil || len(r.Parents) != 1 || r.Parents[0] != "dw.orders" {
+		t.Errorf("Relation = %+v, %v", r, err)
+	}
+	if _, err := s.Relation("dw", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing relation: err = %v", err)
+	}
+	if path, _ := s.SearchPath(); len(path) != 2 || path[0] != "ods" {
+		t.Errorf("SearchPath = %v", path)
+	}
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	s := testSnapshot()
+	s.Version = SnapshotVersion + 1
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load accepted a newer snapshot version")
+	}
+}
+
+func TestResolveRelation(t *testing.T) {
+	s := testSnapshot()
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"users", "ods.users"},
+		{"items", "public.items"},
+		{"orders", ""},
+	} {
+		r, err := ResolveRelation(s, tc.name)
+		if tc.want == "" {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: err = %v, want ErrNotFound", tc.name, err)
+			}
+			continue
+		}
+		if err != nil || r.ID() != tc.want {
+			t.Errorf("%s: relation = %v, %v, want %s", tc.name, r, err, tc.want)
+		}
+	}
+
+	// 未记录 search_path 时按 public 查找
+	s = testSnapshot()
+	s.Schemas = nil
+	if r, err := ResolveRelation(s, "users"); err != nil || r.ID() != "public.users" {
+		t.Errorf("default search_path: relation = %v, %v", r, err)
+	}
+}
+
+func TestPartitionRoot(t *testing.T) {
+	s := testSnapshot()
+	for _, tc := range []struct {
+		schema, name string
+		want         string
+	}{
+		{"dw", "orders_2024_01_a", "dw.orders"},
+		{"dw", "orders_2024_01", "dw.orders"},
+		{"dw", "orders", "dw.orders"},
+		{"public", "items", "public.items"},
+		{"public", "loop_a", "public.loop_b"},
+	} {
+		r, err := PartitionRoot(s, tc.schema, tc.name)
+		if err != nil || r.ID() != tc.want {
+			t.Errorf("%s.%s: root = %v, %v, want %s", tc.schema, tc.name, r, err, tc.want)
+		}
+	}
+
+	if _, err := PartitionRoot(s, "dw", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing relation: err = %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package catalog
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 排除系统 schema 及临时 schema，与采集表统计信息时的过滤保持一致
+const userSchemaFilter = `n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname !~ '^pg_toast' AND n.nspname !~ '^pg_temp_'`
+
+const (
+	// 只导出 plpgsql / sql 函数，聚合等内置语言的函数没有 pg_get_functiondef
+	queryFunctions = `
+		SELECT n.nspname, p.proname, pg_get_function_identity_arguments(p.oid), l.lanname,
+			pg_get_functiondef(p.oid), coalesce(obj_description(p.oid, 'pg_proc'), '')
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		JOIN pg_language l ON l.oid = p.prolang
+		WHERE l.lanname IN ('plpgsql', 'sql') AND ` + userSchemaFilter
+
+	queryRelations = `
+		SELECT c.oid::bigint, n.nspname, c.relname, c.relkind::text, c.relpersistence::text,
+			coalesce(obj_description(c.oid, 'pg_class'), ''),
+			CASE WHEN c.relkind IN ('v', 'm') THEN coalesce(pg_get_viewdef(c.oid), '') ELSE '' END
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f') AND ` + userSchemaFilter
+
+	queryParents = `
+		SELECT i.inhrelid::bigint, pn.nspname || '.' || p.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		WHERE ` + userSchemaFilter
+
+	queryColumns = `
+		SELECT a.attrelid::bigint, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+			coalesce(col_description(a.attrelid, a.attnum), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE a.attnum > 0 AND NOT a.attisdropped AND c.relkind IN ('r', 'p', 'v', 'm', 'f') AND ` + userSchemaFilter
+
+	// 字段按约束、索引中的顺序以逗号拼接
+	queryConstraints = `
+		SELECT con.conrelid::bigint, con.conname, con.contype::text,
+			coalesce((SELECT string_agg(a.attname, ',' ORDER BY k.i) FROM unnest(con.conkey) WITH ORDINALITY k(n, i)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.n), ''),
+			coalesce(fn.nspname || '.' || f.relname, ''),
+			coalesce((SELECT string_agg(a.attname, ',' ORDER BY k.i) FROM unnest(con.confkey) WITH ORDINALITY k(n, i)
+				JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.n), '')
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class f ON f.oid = con.confrelid
+		LEFT JOIN pg_namespace fn ON fn.oid = f.relnamespace
+		WHERE con.contype IN ('p', 'u', 'f') AND ` + userSchemaFilter
+
+	// 不属于主键、唯一约束的唯一索引，跳过部分索引及表达式索引
+	queryUniqueIndexes = `
+		SELECT i.indrelid::bigint, ic.relname, 'u',
+			coalesce((SELECT string_agg(a.attname, ',' ORDER BY k.i) FROM unnest(i.indkey::int2[]) WITH ORDINALITY k(n, i)
+				JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.n), ''),
+			'', ''
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE i.indisunique AND i.indpred IS NULL AND NOT (0 = ANY (i.indkey::int2[]))
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid AND con.contype IN ('p', 'u'))
+			AND ` + userSchemaFilter
+
+	querySearchPath = `SELECT array_to_string(current_schemas(false), ',')`
+)
+
+// DB 在线数据库实现，每次查询都访问 pg_catalog
+type DB struct {
+	db *sql.DB
+}
+
+func NewDB(db *sql.DB) *DB {
+	return &DB{db: db}
+}
+
+func (c *DB) FunctionDefinition(schema, name string) (string, error) {
+	fs, err := queryFunctionRows(c.db, queryFunctions+` AND n.nspname = $1 AND p.proname = $2 ORDER BY p.oid LIMIT 1`, schema, name)
+	if err != nil {
+		return "", err
+	}
+	if len(fs) == 0 {
+		return "", fmt.Errorf("function %s.%s: %w", schema, name, ErrNotFound)
+	}
+	return fs[0].Definition, nil
+}
+
+func (c *DB) Relation(schema, name string) (*Relation, error) {
+	rs, err := queryRelationRows(c.db, ` AND n.nspname = $1 AND c.relname = $2`, schema, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, fmt.Errorf("relation %s.%s: %w", schema, name, ErrNotFound)
+	}
+	return &rs[0], nil
+}
+
+func (c *DB) SearchPath() ([]string, error) {
+	var path string
+	if err := c.db.QueryRow(querySearchPath).Scan(&path); err != nil {
+		return nil, err
+	}
+	return strings.Split(path, ","), nil
+}
+
+// Export 导出用户 schema 下的函数、表、视图及字段，生成离线快照
+func Export(db *sql.DB, label, database string) (*Snapshot, error) {
+	s := &Snapshot{
+		Version:    SnapshotVersion,
+		Label:      label,
+		Database:   database,
+		ExportedAt: time.Now().UTC(),
+	}
+
+	var err error
+	if s.Schemas, err = NewDB(db).SearchPath(); err != nil {
+		return nil, fmt.Errorf("search_path: %w", err)
+	}
+	if s.Functions, err = queryFunctionRows(db, queryFunctions+` ORDER BY n.nspname, p.proname, p.oid`); err != nil {
+		return nil, fmt.Errorf("functions: %w", err)
+	}
+	if s.Relations, err = queryRelationRows(db, ""); err != nil {
+		return nil, fmt.Errorf("relations: %w", err)
+	}
+	return s, nil
+}
+
+func queryFunctionRows(db *sql.DB, query string, args ...any) ([]Function, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fs []Function
+	for rows.Next() {
+		var f Function
+		if err := rows.Scan(&f.Schema, &f.Name, &f.Arguments, &f.Language, &f.Definition, &f.Comment); err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, rows.Err()
+}
+
+// queryRelationRows filter 为追加到各查询 WHERE 之后的条件，参数在各查询中共用
+func queryRelationRows(db *sql.DB, filter string, args ...any) ([]Relation, error) {
+	rows, err := db.Query(queryRelations+filter+` ORDER BY n.nspname, c.relname`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		rs    []Relation
+		index = make(map[int64]int)
+	)
+	for rows.Next() {
+		var (
+			oid int64
+			r   Relation
+		)
+		if err := rows.Scan(&oid, &r.Schema, &r.Name, &r.Kind, &r.Persistence, &r.Comment, &r.ViewDefinition); err != nil {
+			return nil, err
+		}
+		index[oid] = len(rs)
+		rs = append(rs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := eachRow(db, queryParents+filter, args, func(rows *sql.Rows) error {
+		var (
+			oid    int64
+			parent string
+		)
+		if err := rows.Scan(&oid, &parent); err != nil {
+			return err
+		}
+		if i, ok := index[oid]; ok {
+			rs[i].Parents = append(rs[i].Parents, parent)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	err = eachRow(db, queryColumns+filter+` ORDER BY a.attrelid, a.attnum`, args, func(rows *sql.Rows) error {
+		var (
+			oid int64
+			col Column
+		)
+		if err := rows.Scan(&oid, &col.Name, &col.Type, &col.NotNull, &col.Comment); err != nil {
+			return err
+		}
+		if i, ok := index[oid]; ok {
+			rs[i].Columns = append(rs[i].Columns, col)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, query := range []string{queryConstraints + filter + ` ORDER BY con.conrelid, con.conname`, queryUniqueIndexes + filter + ` ORDER BY i.indrelid, ic.relname`} {
+		if err := eachRow(db, query, args, func(rows *sql.Rows) error {
+			var (
+				oid                 int64
+				con                 Constraint
+				columns, refColumns string
+			)
+			if err := rows.Scan(&oid, &con.Name, &con.Type, &columns, &con.RefTable, &refColumns); err != nil {
+				return err
+			}
+			con.Columns = splitList(columns)
+			con.RefColumns = splitList(refColumns)
+			if i, ok := index[oid]; ok {
+				rs[i].Constraints = append(rs[i].Constraints, con)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func eachRow(db *sql.DB, query string, args []any, fn func(*sql.Rows) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SnapshotVersion 快照格式版本，格式不兼容时递增；新增的可选字段不改变版本
+const SnapshotVersion = 1
+
+// Snapshot 离线的 catalog 快照，由 catalog export 从数据库导出，用于在没有数据库连接时解析
+type Snapshot struct {
+	Version    int        `json:"version"`
+	Label      string     `json:"label,omitempty"`
+	Database   string     `json:"database,omitempty"`
+	ExportedAt time.Time  `json:"exported_at,omitempty"`
+	Schemas    []string   `json:"search_path,omitempty"` // 导出时的 search_path
+	Functions  []Function `json:"functions"`
+	Relations  []Relation `json:"relations,omitempty"`
+
+	once      sync.Once
+	functions map[string]*Function
+	relations map[string]*Relation
+}
+
+// Load 读取 JSON 格式的快照文件
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("catalog snapshot %s: %w", path, err)
+	}
+	if s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("catalog snapshot %s: version %d, this binary supports up to %d", path, s.Version, SnapshotVersion)
+	}
+	return &s, nil
+}
+
+// Save 写为缩进的 JSON，便于纳入版本管理后对比差异
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// index 首次查询时建立索引，同名函数保留第一个
+func (s *Snapshot) index() {
+	s.once.Do(func() {
+		s.functions = make(map[string]*Function, len(s.Functions))
+		for i := range s.Functions {
+			f := &s.Functions[i]
+			if _, ok := s.functions[f.Schema+"."+f.Name]; !ok {
+				s.functions[f.Schema+"."+f.Name] = f
+			}
+		}
+		s.relations = make(map[string]*Relation, len(s.Relations))
+		for i := range s.Relations {
+			s.relations[s.Relations[i].ID()] = &s.Relations[i]
+		}
+	})
+}
+
+func (s *Snapshot) FunctionDefinition(schema, name string) (string, error) {
+	s.index()
+	if f, ok := s.functions[schema+"."+name]; ok {
+		return f.Definition, nil
+	}
+	return "", fmt.Errorf("function %s.%s: %w", schema, name, ErrNotFound)
+}
+
+func (s *Snapshot) Relation(schema, name string) (*Relation, error) {
+	s.index()
+	if r, ok := s.relations[schema+"."+name]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("relation %s.%s: %w", schema, name, ErrNotFound)
+}
+
+// SearchPath 快照未记录时与 PostgreSQL 默认值一致
+func (s *Snapshot) SearchPath() ([]string, error) {
+	if len(s.Schemas) == 0 {
+		return []string{"public"}, nil
+	}
+	return s.Schemas, nil
+}
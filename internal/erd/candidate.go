@@ -0,0 +1,192 @@
+package erd
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"pg_lineage/internal/catalog"
+)
+
+// 置信度中各项的权重，catalog 中已声明的外键直接为 1
+const (
+	weightUnique    = 0.45 // 被引用的字段为主键或唯一字段
+	weightTypeMatch = 0.2  // 两个字段的类型兼容
+	weightFrequency = 0.35 // 关联出现的查询越多越可信，按 1 - 1/(1+n) 增长
+)
+
+// Candidate 由查询中的关联推断出的外键候选，From 引用 To
+type Candidate struct {
+	From       *Column  `json:"from"`
+	To         *Column  `json:"to"`
+	Queries    int      `json:"queries"`    // 出现该关联的查询数
+	Calls      int64    `json:"calls"`      // 这些查询的执行次数之和
+	JoinTypes  []string `json:"join_types"` // JOIN_INNER、JOIN_LEFT 等，排序
+	Declared   bool     `json:"declared"`   // catalog 中已有该外键约束
+	Unique     bool     `json:"unique"`     // To 为主键或唯一字段
+	TypeMatch  bool     `json:"type_match"` // 两个字段的类型兼容，catalog 中找不到字段时为 false
+	Confidence float64  `json:"confidence"`
+}
+
+// pair 同一对字段的关联，不区分左右
+type pair struct {
+	a, b    *Column
+	queries int
+	calls   int64
+	types   map[string]struct{}
+}
+
+// Stats 累计所有查询中各对字段被关联的次数
+type Stats struct {
+	pairs map[string]*pair
+}
+
+func NewStats() *Stats {
+	return &Stats{pairs: make(map[string]*pair)}
+}
+
+// Add 记录一条查询（或一个函数）解析出的关联，calls 为其执行次数；同一对字段在一次 Add 中只计一次。
+// 不带 schema 的一侧为 CTE、子查询或临时表，不是外键的候选
+func (s *Stats) Add(relationShips map[string]*RelationShip, calls int64) {
+	seen := make(map[string]bool)
+	for _, r := range relationShips {
+		if r.SColumn == nil || r.TColumn == nil || r.SColumn.Schema == "" || r.TColumn.Schema == "" ||
+			r.SColumn.GetID() == r.TColumn.GetID() {
+			continue
+		}
+
+		a, b := r.SColumn, r.TColumn
+		if a.GetID() > b.GetID() {
+			a, b = b, a
+		}
+		key := a.GetID() + "=" + b.GetID()
+
+		p, ok := s.pairs[key]
+		if !ok {
+			p = &pair{a: a, b: b, types: make(map[string]struct{})}
+			s.pairs[key] = p
+		}
+		p.types[r.Type] = struct{}{}
+		if !seen[key] {
+			seen[key] = true
+			p.queries++
+			p.calls += calls
+		}
+	}
+}
+
+// Candidates 结合 catalog 中的外键约束、字段类型及唯一性给每对字段打分，按置信度降序返回；
+// c 为 nil 时只按出现次数打分。方向按外键约束或唯一性确定：唯一的一侧为 To，都不唯一时按字段 ID 排序
+func (s *Stats) Candidates(c catalog.Catalog) ([]*Candidate, error) {
+	var out []*Candidate
+	for _, p := range s.pairs {
+		ra, err := lookup(c, p.a)
+		if err != nil {
+			return nil, err
+		}
+		rb, err := lookup(c, p.b)
+		if err != nil {
+			return nil, err
+		}
+
+		cand := &Candidate{From: p.a, To: p.b, Queries: p.queries, Calls: p.calls}
+		for t := range p.types {
+			cand.JoinTypes = append(cand.JoinTypes, t)
+		}
+		sort.Strings(cand.JoinTypes)
+
+		switch {
+		case references(ra, p.a, p.b):
+			cand.Declared = true
+		case references(rb, p.b, p.a):
+			cand.Declared = true
+			cand.From, cand.To, ra, rb = p.b, p.a, rb, ra
+		case !unique(rb, p.b) && unique(ra, p.a):
+			cand.From, cand.To, ra, rb = p.b, p.a, rb, ra
+		}
+		cand.Unique = unique(rb, cand.To)
+		cand.TypeMatch = typeMatch(ra, cand.From, rb, cand.To)
+		cand.Confidence = confidence(cand)
+
+		out = append(out, cand)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Confidence != out[j].Confidence {
+			return out[i].Confidence > out[j].Confidence
+		}
+		if out[i].Queries != out[j].Queries {
+			return out[i].Queries > out[j].Queries
+		}
+		return out[i].From.GetID()+out[i].To.GetID() < out[j].From.GetID()+out[j].To.GetID()
+	})
+	return out, nil
+}
+
+func confidence(c *Candidate) float64 {
+	if c.Declared {
+		return 1
+	}
+	score := weightFrequency * (1 - 1/float64(1+c.Queries))
+	if c.Unique {
+		score += weightUnique
+	}
+	if c.TypeMatch {
+		score += weightTypeMatch
+	}
+	return score
+}
+
+// lookup 字段所在的表，catalog 中没有时返回 nil
+func lookup(c catalog.Catalog, col *Column) (*catalog.Relation, error) {
+	if c == nil {
+		return nil, nil
+	}
+	r, err := c.Relation(col.Schema, col.RelName)
+	if errors.Is(err, catalog.ErrNotFound) {
+		return nil, nil
+	}
+	return r, err
+}
+
+func references(r *catalog.Relation, from, to *Column) bool {
+	return r != nil && r.References(from.Field, to.Schema+"."+to.RelName, to.Field)
+}
+
+func unique(r *catalog.Relation, col *Column) bool {
+	return r != nil && r.IsUnique(col.Field)
+}
+
+func typeMatch(ra *catalog.Relation, a *Column, rb *catalog.Relation, b *Column) bool {
+	if ra == nil || rb == nil {
+		return false
+	}
+	ca, ok := ra.Column(a.Field)
+	if !ok {
+		return false
+	}
+	cb, ok := rb.Column(b.Field)
+	if !ok {
+		return false
+	}
+	return typeFamily(ca.Type) == typeFamily(cb.Type)
+}
+
+// typeFamily 去掉长度、精度后按可以直接比较的类型归类，如 integer 与 bigint、varchar 与 text
+func typeFamily(t string) string {
+	t = strings.TrimSpace(t)
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch t {
+	case "smallint", "integer", "bigint", "smallserial", "serial", "bigserial", "int2", "int4", "int8":
+		return "integer"
+	case "numeric", "decimal", "real", "double precision", "float4", "float8":
+		return "numeric"
+	case "text", "character varying", "varchar", "character", "char", "bpchar", "name":
+		return "text"
+	case "timestamp without time zone", "timestamp with time zone", "timestamp", "timestamptz":
+		return "timestamp"
+	}
+	return t
+}
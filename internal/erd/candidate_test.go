@@ -0,0 +1,180 @@
+package erd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "erd-test")
+	if err != nil {
+		panic(err)
+	}
+	// 解析 SQL 时会写日志
+	if err := log.InitLogger(&config.LogConfig{Level: "error", Path: filepath.Join(dir, "test.log")}); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testCatalog public.users、public.orders 在 search_path 中，orders.item_id 有引用 dw.items 的外键
+func testCatalog() *catalog.Snapshot {
+	return &catalog.Snapshot{
+		Version: catalog.SnapshotVersion,
+		Schemas: []string{"public"},
+		Relations: []catalog.Relation{
+			{
+				Schema: "public", Name: "users", Kind: catalog.RelKindTable,
+				Columns:     []catalog.Column{{Name: "id", Type: "integer"}, {Name: "name", Type: "text"}},
+				Constraints: []catalog.Constraint{{Name: "users_pkey", Type: catalog.ConstraintPrimaryKey, Columns: []string{"id"}}},
+			},
+			{
+				Schema: "public", Name: "orders", Kind: catalog.RelKindTable,
+				Columns: []catalog.Column{{Name: "id", Type: "bigint"}, {Name: "user_id", Type: "bigint"}, {Name: "item_id", Type: "integer"}},
+				Constraints: []catalog.Constraint{
+					{Name: "orders_pkey", Type: catalog.ConstraintPrimaryKey, Columns: []string{"id"}},
+					{Name: "orders_item_fkey", Type: catalog.ConstraintForeignKey, Columns: []string{"item_id"}, RefTable: "dw.items", RefColumns: []string{"item_id"}},
+				},
+			},
+			{
+				Schema: "dw", Name: "items", Kind: catalog.RelKindTable,
+				Columns:     []catalog.Column{{Name: "item_id", Type: "integer"}, {Name: "price", Type: "numeric(10,2)"}},
+				Constraints: []catalog.Constraint{{Name: "items_pkey", Type: catalog.ConstraintPrimaryKey, Columns: []string{"item_id"}}},
+			},
+		},
+	}
+}
+
+// parseJoins 解析出的关联，按 ToString 排序；c 为 nil 时不补全 schema
+func parseJoins(t *testing.T, c catalog.Catalog, sql string) string {
+	t.Helper()
+	relationShips, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", sql, err)
+	}
+	out := make([]string, 0, len(relationShips))
+	for _, r := range relationShips {
+		out = append(out, r.ToString())
+	}
+	sort.Strings(out)
+	return strings.Join(out, "; ")
+}
+
+func TestParseJoins(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"inner join", "select * from users u join orders o on u.id = o.user_id", "users.id JOIN_INNER orders.user_id"},
+		{"left join with filter", "select * from users u left join orders o on u.id = o.user_id and o.item_id = 3", "users.id JOIN_LEFT orders.user_id"},
+		{"not an equality", "select * from users u join orders o on u.id > o.user_id", ""},
+		{"where", "select * from users u, orders o where o.user_id = u.id", "orders.user_id JOIN_INNER users.id"},
+		{"delete using", "delete from orders o using users u where o.user_id = u.id", "orders.user_id JOIN_INNER users.id"},
+		{"update from", "update orders o set item_id = 1 from users u where o.user_id = u.id", "orders.user_id JOIN_INNER users.id"},
+		{
+			"union",
+			"select u.id from users u join orders o on u.id = o.user_id union select i.item_id from dw.items i join orders o on o.item_id = i.item_id",
+			"orders.item_id JOIN_INNER dw.items.item_id; users.id JOIN_INNER orders.user_id",
+		},
+		{"subquery in from", "select * from users u join (select * from orders) o on u.id = o.user_id", "users.id JOIN_INNER o.user_id"},
+		{"in subquery", "select * from users u where u.id in (select o.user_id from orders o)", "users.id JOIN_INNER orders.user_id"},
+		{
+			"three tables",
+			"select * from users join orders on users.id = orders.user_id join dw.items i on orders.item_id = i.item_id",
+			"orders.item_id JOIN_INNER dw.items.item_id; users.id JOIN_INNER orders.user_id",
+		},
+	} {
+		if got := parseJoins(t, nil, tc.sql); got != tc.want {
+			t.Errorf("%s: joins = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	stats := NewStats()
+	for _, q := range []struct {
+		sql   string
+		calls int64
+	}{
+		{"select * from users u join orders o on u.id = o.user_id", 10},
+		// 同一对字段在一条查询中只计一次
+		{"select * from users u join orders o on u.id = o.user_id where o.user_id = u.id", 5},
+		{"select * from orders o join dw.items i on o.item_id = i.item_id", 1},
+		{"select * from orders o join users u on o.id = u.name", 1},
+		// 临时表不在 catalog 中，没有 schema，不是候选
+		{"select * from tmp t join users u on t.id = u.id", 100},
+	} {
+		relationShips, err := Parse(testCatalog(), q.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats.Add(relationShips, q.calls)
+	}
+
+	for _, tc := range []struct {
+		name string
+		cat  catalog.Catalog
+		want []string
+	}{
+		{
+			name: "catalog",
+			cat:  testCatalog(),
+			want: []string{
+				"public.orders.item_id -> dw.items.item_id queries=1 calls=1 declared=true unique=true type=true 1.000",
+				"public.orders.user_id -> public.users.id queries=2 calls=15 declared=false unique=true type=true 0.883",
+				"public.users.name -> public.orders.id queries=1 calls=1 declared=false unique=true type=false 0.625",
+			},
+		},
+		{
+			// 没有 catalog 时只按出现次数打分，方向按字段 ID 排序
+			name: "no catalog",
+			want: []string{
+				"public.orders.user_id -> public.users.id queries=2 calls=15 declared=false unique=false type=false 0.233",
+				"dw.items.item_id -> public.orders.item_id queries=1 calls=1 declared=false unique=false type=false 0.175",
+				"public.orders.id -> public.users.name queries=1 calls=1 declared=false unique=false type=false 0.175",
+			},
+		},
+	} {
+		candidates, err := stats.Candidates(tc.cat)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got []string
+		for _, c := range candidates {
+			got = append(got, fmt.Sprintf("%s -> %s queries=%d calls=%d declared=%v unique=%v type=%v %.3f",
+				c.From.GetID(), c.To.GetID(), c.Queries, c.Calls, c.Declared, c.Unique, c.TypeMatch, c.Confidence))
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s: candidates =\n%s\nwant\n%s", tc.name, strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+		}
+	}
+}
+
+func TestTypeFamily(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		same bool
+	}{
+		{"integer", "bigint", true},
+		{"character varying(32)", "text", true},
+		{"numeric(10,2)", "double precision", true},
+		{"timestamp with time zone", "timestamp without time zone", true},
+		{"integer", "text", false},
+		{"uuid", "uuid", true},
+	} {
+		if got := typeFamily(tc.a) == typeFamily(tc.b); got != tc.same {
+			t.Errorf("%s ~ %s = %v, want %v", tc.a, tc.b, got, tc.same)
+		}
+	}
+}
@@ -1,94 +1,41 @@
 package erd
 
 import (
-	"fmt"
+	"sort"
 
-	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"pg_lineage/internal/service"
 )
 
-func ResetGraph(session neo4j.Session) error {
-
-	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-		return tx.Run("MATCH (n:ERD) DETACH DELETE n", nil)
-	})
-
-	return err
-}
-
-func CreateGraph(session neo4j.Session, relationShips map[string]*RelationShip) error {
-
-	// 点还是relation，边id用key，属性就是RelationShip
-	for k, v := range relationShips {
-		_, err := session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-
-			// 创建点，起点，终点
-			if err := CreateNode(tx, v.SColumn); err != nil {
-				return nil, err
-			}
-			if err := CreateNode(tx, v.TColumn); err != nil {
-				return nil, err
-			}
-			// 创建边
-			if err := CreateEdge(tx, k, v); err != nil {
-				return nil, err
-			}
-
-			return nil, nil
-		})
-		if err != nil {
-			return err
+// Joins 把解析出的关联转为写入存储的边，database 为图的 namespace，calls 为查询的执行次数；
+// 不带 schema 的一侧为 CTE、子查询或临时表，跳过
+func Joins(relationShips map[string]*RelationShip, database string, calls int64) []*service.Join {
+	var joins []*service.Join
+	for _, r := range relationShips {
+		if r.SColumn == nil || r.TColumn == nil || r.SColumn.Schema == "" || r.TColumn.Schema == "" ||
+			r.SColumn.GetID() == r.TColumn.GetID() {
+			continue
 		}
-	}
-
-	return nil
-}
-
-func CreateNode(tx neo4j.Transaction, r *Column) error {
-	// CREATE CONSTRAINT ON (cc:ERD:PG) ASSERT cc.id IS UNIQUE
-	_, err := tx.Run(`
-		MERGE (n:ERD:PG:`+r.Schema+` {id: $id}) 
-		ON CREATE SET n.schemaname = $schemaname, n.relname = $relname, n.udt = timestamp()
-		ON MATCH SET n.udt = timestamp()
-		RETURN n.id
-	`,
-		map[string]any{
-			"id":         r.Schema + "." + r.RelName,
-			"schemaname": r.Schema,
-			"relname":    r.RelName,
+		joins = append(joins, &service.Join{
+			Database:   database,
+			From:       table(r.SColumn, database),
+			To:         table(r.TColumn, database),
+			FromColumn: r.SColumn.Field,
+			ToColumn:   r.TColumn.Field,
+			Type:       r.Type,
+			Calls:      calls,
 		})
-
-	return err
-}
-
-func CreateEdge(tx neo4j.Transaction, id string, r *RelationShip) error {
-	var cypher string
-
-	if r.Type == "JOIN_INNER" {
-		// Neo4jError: Neo.ClientError.Statement.SyntaxError (Only directed relationships are supported)
-		cypher = `
-			MATCH (snode:ERD:PG {id: $sid}), (tnode:ERD:PG {id: $tid})
-			CREATE (snode)-[e:` + r.Type + ` {id: $id, larg: $larg, rarg: $rarg, type: $type}]->(tnode)
-			RETURN e
-		`
-	} else if r.Type == "JOIN_LEFT" {
-		cypher = `
-			MATCH (snode:ERD:PG {id: $sid}), (tnode:ERD:PG {id: $tid})
-			CREATE (snode)-[e:` + r.Type + ` {id: $id, larg: $larg, rarg: $rarg, type: $type}]->(tnode)
-			RETURN e
-		`
-	} else {
-		fmt.Printf("Unknown pg_query.JoinType: %s\n", r.Type)
-		return nil
 	}
 
-	_, err := tx.Run(cypher, map[string]any{
-		"id":   id,
-		"sid":  r.SColumn.Schema + "." + r.SColumn.RelName,
-		"tid":  r.TColumn.Schema + "." + r.TColumn.RelName,
-		"larg": r.SColumn.Schema + "." + r.SColumn.RelName + "." + r.SColumn.Field,
-		"rarg": r.TColumn.Schema + "." + r.TColumn.RelName + "." + r.TColumn.Field,
-		"type": r.Type,
+	sort.Slice(joins, func(i, j int) bool {
+		return joins[i].GetID() < joins[j].GetID()
 	})
+	return joins
+}
 
-	return err
+func table(c *Column, database string) *service.Table {
+	return &service.Table{
+		Database:   database,
+		SchemaName: c.Schema,
+		RelName:    c.RelName,
+	}
 }
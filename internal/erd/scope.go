@@ -0,0 +1,244 @@
+package erd
+
+import (
+	"errors"
+	"slices"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/pkg/log"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// scope 一层查询中 FROM 的表、子查询及 WITH 定义的 CTE。
+// 子查询、UNION 的各个分支各有一层，别名、字段先在本层查找，找不到再到外层，内层的别名不会覆盖外层的
+type scope struct {
+	parent    *scope
+	cat       catalog.Catalog // 为 nil 时不解析 search_path，也无法确定不带别名的字段所属的表
+	relations []*Relation     // 按出现顺序
+	aliases   map[string]*Relation
+	ctes      map[string]*Relation
+
+	// 本层查询结果的字段名，及能追溯到的表字段，供引用该查询的 CTE、子查询使用
+	columns []string
+	sources map[string]*Column
+}
+
+func newScope(c catalog.Catalog) *scope {
+	return &scope{
+		cat:     c,
+		aliases: make(map[string]*Relation),
+		ctes:    make(map[string]*Relation),
+	}
+}
+
+func (s *scope) child() *scope {
+	sub := newScope(s.cat)
+	sub.parent = s
+	return sub
+}
+
+func (s *scope) add(r *Relation) {
+	s.relations = append(s.relations, r)
+	s.aliases[r.Alias] = r
+}
+
+// lookup 按别名由内向外查找
+func (s *scope) lookup(alias string) (*Relation, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if r, ok := sc.aliases[alias]; ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (s *scope) cte(name string) (*Relation, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if r, ok := sc.ctes[name]; ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// bind 找到不带别名的字段所属的表：本层中恰好一张表有该字段时取该表，多张表都有时无法确定，本层都没有时到外层查找
+func (s *scope) bind(field string) (*Column, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		var found []*Column
+		for _, r := range sc.relations {
+			if col, ok := r.column(field); ok {
+				found = append(found, col)
+			}
+		}
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], true
+		default:
+			log.Debugf("Column %s is ambiguous", field)
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// table FROM 中的表：不带 schema 且与 CTE 同名时为 CTE，否则按 catalog 补全 schema 及字段
+func (s *scope) table(node *pg_query.RangeVar) *Relation {
+	alias := node.GetRelname()
+	if node.GetAlias().GetAliasname() != "" {
+		alias = node.GetAlias().GetAliasname()
+	}
+
+	if node.GetSchemaname() == "" {
+		if cte, ok := s.cte(node.GetRelname()); ok {
+			r := *cte
+			r.Alias = alias
+			return &r
+		}
+	}
+
+	r := &Relation{
+		Schema:  node.GetSchemaname(),
+		RelName: node.GetRelname(),
+		Alias:   alias,
+	}
+	if s.cat == nil {
+		return r
+	}
+
+	var (
+		meta *catalog.Relation
+		err  error
+	)
+	if r.Schema == "" {
+		meta, err = catalog.ResolveRelation(s.cat, r.RelName)
+	} else {
+		meta, err = s.cat.Relation(r.Schema, r.RelName)
+	}
+	if err != nil {
+		// 临时表等不在 catalog 中，schema 保持为空
+		if !errors.Is(err, catalog.ErrNotFound) {
+			log.Warnf("Lookup relation %s error: %v", r.RelName, err)
+		}
+		return r
+	}
+	r.Schema = meta.Schema
+	r.meta = meta
+	return r
+}
+
+// derived 以 CTE 或子查询的名称记录 sub 层查询的结果，aliasColumns 为 name(a, b) 中重命名的字段
+func derived(name string, sub *scope, aliasColumns []*pg_query.Node) *Relation {
+	r := &Relation{
+		RelName: name,
+		Alias:   name,
+		derived: true,
+		columns: make([]string, len(sub.columns)),
+		sources: make(map[string]*Column),
+	}
+	for i, c := range sub.columns {
+		r.columns[i] = c
+		if i < len(aliasColumns) {
+			r.columns[i] = aliasColumns[i].GetString_().GetSval()
+		}
+		if src, ok := sub.sources[c]; ok {
+			r.sources[r.columns[i]] = src
+		}
+	}
+	return r
+}
+
+// column 表中名为 field 的字段，表不在 catalog 中或确定没有该字段时 ok 为 false
+func (r *Relation) column(field string) (*Column, bool) {
+	if r.derived {
+		if !slices.Contains(r.columns, field) {
+			return nil, false
+		}
+		return r.ref(field), true
+	}
+	if r.meta == nil {
+		return nil, false
+	}
+	if _, ok := r.meta.Column(field); !ok {
+		return nil, false
+	}
+	return r.ref(field), true
+}
+
+// ref 经别名引用的字段，CTE、子查询中能追溯到表字段的取该表字段
+func (r *Relation) ref(field string) *Column {
+	if src, ok := r.sources[field]; ok {
+		c := *src
+		return &c
+	}
+	return &Column{
+		Schema:  r.Schema,
+		RelName: r.RelName,
+		Field:   field,
+	}
+}
+
+// collectOutputs 记录查询结果的字段，select * 及 A.* 按本层各表的字段展开，字段未知的表跳过
+func (s *scope) collectOutputs(targets []*pg_query.Node) {
+	s.sources = make(map[string]*Column)
+	for _, t := range targets {
+		rt := t.GetResTarget()
+		val := rt.GetVal()
+
+		if fields := val.GetColumnRef().GetFields(); len(fields) > 0 && fields[len(fields)-1].GetAStar() != nil {
+			for _, r := range s.relations {
+				if len(fields) > 1 && r.Alias != fields[len(fields)-2].GetString_().GetSval() {
+					continue
+				}
+				for _, c := range r.fields() {
+					s.output(c, r.ref(c))
+				}
+			}
+			continue
+		}
+
+		name := rt.GetName()
+		if name == "" {
+			name = outputName(val)
+		}
+		s.output(name, columnOf(val, s))
+	}
+}
+
+func (s *scope) output(name string, src *Column) {
+	s.columns = append(s.columns, name)
+	if name != "" && src != nil && src.Schema != "" {
+		s.sources[name] = src
+	}
+}
+
+// fields 表的全部字段名，未知时为空
+func (r *Relation) fields() []string {
+	if r.derived {
+		return r.columns
+	}
+	if r.meta == nil {
+		return nil
+	}
+	names := make([]string, 0, len(r.meta.Columns))
+	for _, c := range r.meta.Columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// outputName 未指定别名时结果字段的名称，与 PostgreSQL 一致取字段名或函数名，其余为空
+func outputName(node *pg_query.Node) string {
+	if node.GetTypeCast() != nil {
+		return outputName(node.GetTypeCast().GetArg())
+	}
+	if fields := node.GetColumnRef().GetFields(); len(fields) > 0 {
+		return fields[len(fields)-1].GetString_().GetSval()
+	}
+	if name := node.GetFuncCall().GetFuncname(); len(name) > 0 {
+		return name[len(name)-1].GetString_().GetSval()
+	}
+	return ""
+}
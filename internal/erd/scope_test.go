@@ -0,0 +1,87 @@
+package erd
+
+import "testing"
+
+func TestScope(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "search_path",
+			sql:  "select * from users u join orders o on u.id = o.user_id",
+			want: "public.users.id JOIN_INNER public.orders.user_id",
+		},
+		{
+			name: "unqualified column",
+			sql:  "select * from users u join orders o on u.id = user_id",
+			want: "public.users.id JOIN_INNER public.orders.user_id",
+		},
+		{
+			// users 与 orders 都有 id
+			name: "ambiguous column",
+			sql:  "select * from users u join orders o on id = user_id",
+			want: "",
+		},
+		{
+			// 子查询中的别名 u 不覆盖外层的 u
+			name: "inner alias",
+			sql:  "select * from users u join (select u.user_id as uid from orders u) o on u.id = o.uid",
+			want: "public.users.id JOIN_INNER public.orders.user_id",
+		},
+		{
+			// 内层没有 name，到外层查找
+			name: "outer column",
+			sql:  "select * from users u where exists (select 1 from orders o where o.user_id = name)",
+			want: "public.orders.user_id JOIN_INNER public.users.name",
+		},
+		{
+			name: "union branches",
+			sql:  "select u.id from users u join orders o on u.id = o.user_id union select 1 from dw.items u join orders o on o.item_id = u.item_id",
+			want: "public.orders.item_id JOIN_INNER dw.items.item_id; public.users.id JOIN_INNER public.orders.user_id",
+		},
+		{
+			name: "cte column",
+			sql:  "with o as (select user_id as uid from orders) select * from users u join o on u.id = o.uid",
+			want: "public.users.id JOIN_INNER public.orders.user_id",
+		},
+		{
+			name: "cte renamed column",
+			sql:  "with o(uid) as (select user_id from orders) select * from users u join o on u.id = uid",
+			want: "public.users.id JOIN_INNER public.orders.user_id",
+		},
+		{
+			name: "subquery star",
+			sql:  "select * from users u join (select o.* from orders o) x on u.id = x.user_id",
+			want: "public.users.id JOIN_INNER public.orders.user_id",
+		},
+		{
+			// 不在 catalog 中的表保持为空 schema
+			name: "temp table",
+			sql:  "select * from tmp t join users u on t.id = u.id",
+			want: "tmp.id JOIN_INNER public.users.id",
+		},
+	} {
+		if got := parseJoins(t, testCatalog(), tc.sql); got != tc.want {
+			t.Errorf("%s: joins = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestScopeWithoutCatalog(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sql  string
+		want string
+	}{
+		// 没有 catalog 时无法确定不带别名的字段所属的表
+		{"unqualified column", "select * from users u join orders o on u.id = user_id", ""},
+		{"inner alias", "select * from users u join (select u.user_id from orders u) o on u.id = o.user_id", "users.id JOIN_INNER o.user_id"},
+		{"cte", "with o as (select user_id from orders) select * from users u join o on u.id = o.user_id", "users.id JOIN_INNER o.user_id"},
+	} {
+		if got := parseJoins(t, nil, tc.sql); got != tc.want {
+			t.Errorf("%s: joins = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -2,11 +2,11 @@ package erd
 
 import (
 	"crypto/md5"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"maps"
 
+	"pg_lineage/internal/catalog"
 	"pg_lineage/internal/lineage"
 	"pg_lineage/internal/service"
 	"pg_lineage/pkg/log"
@@ -30,12 +30,17 @@ type Relation struct {
 	Schema  string
 	RelName string
 	Alias   string
+
+	derived bool               // CTE 或子查询
+	columns []string           // CTE、子查询结果的字段
+	sources map[string]*Column // CTE、子查询结果中能追溯到的表字段
+	meta    *catalog.Relation  // catalog 中表的定义，含字段
 }
 
 type Column struct {
-	Schema  string
-	RelName string
-	Field   string
+	Schema  string `json:"schema"`
+	RelName string `json:"relname"`
+	Field   string `json:"field"`
 }
 
 func (r *Column) GetID() string {
@@ -77,7 +82,8 @@ func (r *RelationShip) ToString() string {
 	)
 }
 
-func HandleUDF4ERD(db *sql.DB, udf *service.Udf) (map[string]*RelationShip, error) {
+// HandleUDF4ERD 从 catalog 取函数定义解析，c 同时用于补全表的 schema 及确定字段所属的表
+func HandleUDF4ERD(c catalog.Catalog, udf *service.Udf) (map[string]*RelationShip, error) {
 	log.Infof("HandleUDF: %s.%s", udf.SchemaName, udf.ProcName)
 
 	// 排除系统函数的干扰 e.g. select now()
@@ -85,7 +91,7 @@ func HandleUDF4ERD(db *sql.DB, udf *service.Udf) (map[string]*RelationShip, erro
 		return nil, fmt.Errorf("UDF %s is system function", udf.ProcName)
 	}
 
-	definition, err := lineage.GetUDFDefinition(db, udf)
+	definition, err := lineage.GetUDFDefinition(c, udf)
 	if err != nil {
 		log.Errorf("GetUDFDefinition err: %s", err)
 		return nil, err
@@ -94,7 +100,7 @@ func HandleUDF4ERD(db *sql.DB, udf *service.Udf) (map[string]*RelationShip, erro
 	plpgsql := lineage.FilterUnhandledCommands(definition)
 	// log.Debug("plpgsql: ", plpgsql)
 
-	relationShips, err := ParseUDF(plpgsql)
+	relationShips, err := ParseUDF(c, plpgsql)
 	if err != nil {
 		log.Errorf("ParseUDF %+v, err: %s", udf, err)
 		return nil, err
@@ -103,7 +109,7 @@ func HandleUDF4ERD(db *sql.DB, udf *service.Udf) (map[string]*RelationShip, erro
 	return relationShips, nil
 }
 
-func ParseUDF(plpgsql string) (map[string]*RelationShip, error) {
+func ParseUDF(c catalog.Catalog, plpgsql string) (map[string]*RelationShip, error) {
 
 	raw, err := pg_query.ParsePlPgSqlToJSON(plpgsql)
 	if err != nil {
@@ -122,7 +128,7 @@ func ParseUDF(plpgsql string) (map[string]*RelationShip, error) {
 			}
 
 			// 递归调用 Parse
-			if err := parseUDFOperator(relationShip, key.String(), value.String()); err != nil {
+			if err := parseUDFOperator(relationShip, c, key.String(), value.String()); err != nil {
 				log.Errorf("pg_query.ParseToJSON err: %s, sql: %s", err, value.String())
 				return false
 			}
@@ -134,7 +140,7 @@ func ParseUDF(plpgsql string) (map[string]*RelationShip, error) {
 	return relationShip, nil
 }
 
-func parseUDFOperator(relationShip map[string]*RelationShip, operator, plan string) error {
+func parseUDFOperator(relationShip map[string]*RelationShip, c catalog.Catalog, operator, plan string) error {
 	// log.Printf("%s: %s\n", operator, plan)
 
 	var subQuery string
@@ -154,17 +160,18 @@ func parseUDFOperator(relationShip map[string]*RelationShip, operator, plan stri
 
 	}
 
-	if err := parseSQL(relationShip, subQuery); err != nil {
+	if err := parseSQL(relationShip, c, subQuery); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func Parse(sql string) (map[string]*RelationShip, error) {
+// Parse c 为 nil 时不补全表的 schema，不带别名的字段也无法确定所属的表
+func Parse(c catalog.Catalog, sql string) (map[string]*RelationShip, error) {
 	relationShip := make(map[string]*RelationShip)
 
-	if err := parseSQL(relationShip, sql); err != nil {
+	if err := parseSQL(relationShip, c, sql); err != nil {
 		return nil, err
 	}
 
@@ -172,7 +179,7 @@ func Parse(sql string) (map[string]*RelationShip, error) {
 }
 
 // 解析独立SQL，不支持关系传递
-func parseSQL(relationShip map[string]*RelationShip, sql string) error {
+func parseSQL(relationShip map[string]*RelationShip, c catalog.Catalog, sql string) error {
 
 	log.Debugf("%s\n", sql)
 	result, err := pg_query.Parse(sql)
@@ -204,28 +211,31 @@ func parseSQL(relationShip map[string]*RelationShip, sql string) error {
 			continue
 		}
 
+		// 每条语句一个最外层的 scope
+		s := newScope(c)
+
 		if v.Stmt.GetCreateTableAsStmt() != nil {
-			r := parseSelectStmt(v.Stmt.GetCreateTableAsStmt().GetQuery().GetSelectStmt())
+			r := parseSelect(v.Stmt.GetCreateTableAsStmt().GetQuery().GetSelectStmt(), s)
 			maps.Copy(relationShip, r)
 			continue
 		}
 		if v.Stmt.GetSelectStmt() != nil {
-			r := parseSelectStmt(v.Stmt.GetSelectStmt())
+			r := parseSelect(v.Stmt.GetSelectStmt(), s)
 			maps.Copy(relationShip, r)
 			continue
 		}
 		if v.Stmt.GetInsertStmt() != nil {
-			r := parseSelectStmt(v.Stmt.GetInsertStmt().GetSelectStmt().GetSelectStmt())
+			r := parseInsertStmt(v.Stmt.GetInsertStmt(), s)
 			maps.Copy(relationShip, r)
 			continue
 		}
 		if v.Stmt.GetDeleteStmt() != nil {
-			r := parseDeleteStmt(v.Stmt.GetDeleteStmt())
+			r := parseDeleteStmt(v.Stmt.GetDeleteStmt(), s)
 			maps.Copy(relationShip, r)
 			continue
 		}
 		if v.Stmt.GetUpdateStmt() != nil {
-			r := parseUpdateStmt(v.Stmt.GetUpdateStmt())
+			r := parseUpdateStmt(v.Stmt.GetUpdateStmt(), s)
 			maps.Copy(relationShip, r)
 			continue
 		}
@@ -234,84 +244,128 @@ func parseSQL(relationShip map[string]*RelationShip, sql string) error {
 	return nil
 }
 
-func parseSelectStmt(selectStmt *pg_query.SelectStmt) map[string]*RelationShip {
-	aliasMap := make(map[string]*Relation)
+// parseSelect 在 s 层解析查询，调用方为子查询、UNION 的分支新建一层；查询结果的字段记录在 s 中
+func parseSelect(selectStmt *pg_query.SelectStmt, s *scope) map[string]*RelationShip {
 	m := make(map[string]*RelationShip)
 
 	// 解析 CTE
 	if selectStmt.GetWithClause() != nil {
-		r0 := parseWithClause(selectStmt.GetWithClause(), aliasMap)
+		r0 := parseWithClause(selectStmt.GetWithClause(), s)
 		maps.Copy(m, r0)
 	}
 
-	// TODO:解析 UNION
-	// ...
+	// 解析 UNION / INTERSECT / EXCEPT 的两个分支，结果的字段名取左侧分支的
+	if selectStmt.GetOp() > pg_query.SetOperation_SETOP_NONE {
+		larg, rarg := s.child(), s.child()
+		maps.Copy(m, parseSelect(selectStmt.GetLarg(), larg))
+		maps.Copy(m, parseSelect(selectStmt.GetRarg(), rarg))
+		s.columns = larg.columns
+		return m
+	}
 
 	// 解析 FROM 获取关系
 	// 从 FromClause 中获取 JoinExpr 信息，以便提炼关系
 	// 从 FromClause 中获取别名信息，可能在 WHERE 会用到
 	for _, vv := range selectStmt.GetFromClause() {
-		r1 := parseFromClause(vv, aliasMap)
+		r1 := parseFromClause(vv, s)
 		maps.Copy(m, r1)
 	}
 
 	// 解析 WHERE IN 获取关系
-	r2 := parseWhereClause(selectStmt.GetWhereClause(), aliasMap)
+	r2 := parseWhereClause(selectStmt.GetWhereClause(), s)
 	maps.Copy(m, r2)
 
+	s.collectOutputs(selectStmt.GetTargetList())
+
 	return m
 }
 
-func parseDeleteStmt(deleteStmt *pg_query.DeleteStmt) map[string]*RelationShip {
-	// fmt.Printf("parseDeleteStmt: %s\n", deleteStmt)
-	return nil
+// insert into ... select ...，insert 自身的 CTE 对 select 可见，插入的表不可见
+func parseInsertStmt(insertStmt *pg_query.InsertStmt, s *scope) map[string]*RelationShip {
+	m := make(map[string]*RelationShip)
+
+	if insertStmt.GetWithClause() != nil {
+		maps.Copy(m, parseWithClause(insertStmt.GetWithClause(), s))
+	}
+	if insertStmt.GetSelectStmt().GetSelectStmt() != nil {
+		maps.Copy(m, parseSelect(insertStmt.GetSelectStmt().GetSelectStmt(), s.child()))
+	}
+
+	return m
 }
 
-func parseUpdateStmt(updateStmt *pg_query.UpdateStmt) map[string]*RelationShip {
-	// fmt.Printf("parseUpdateStmt: %s\n", updateStmt)
-	return nil
+// 关联删除：delete from A using B where A.? = B.?
+func parseDeleteStmt(deleteStmt *pg_query.DeleteStmt, s *scope) map[string]*RelationShip {
+	m := make(map[string]*RelationShip)
+
+	if deleteStmt.GetWithClause() != nil {
+		maps.Copy(m, parseWithClause(deleteStmt.GetWithClause(), s))
+	}
+
+	parseRangeVar(deleteStmt.GetRelation(), s)
+	for _, vv := range deleteStmt.GetUsingClause() {
+		maps.Copy(m, parseFromClause(vv, s))
+	}
+	maps.Copy(m, parseWhereClause(deleteStmt.GetWhereClause(), s))
+
+	return m
 }
 
-func parseWithClause(withClause *pg_query.WithClause, aliasMap map[string]*Relation) map[string]*RelationShip {
+// 关联更新：update A set ... from B where A.? = B.?
+func parseUpdateStmt(updateStmt *pg_query.UpdateStmt, s *scope) map[string]*RelationShip {
 	m := make(map[string]*RelationShip)
 
-	for _, v := range withClause.GetCtes() {
+	if updateStmt.GetWithClause() != nil {
+		maps.Copy(m, parseWithClause(updateStmt.GetWithClause(), s))
+	}
 
-		// 解析 FROM 获取关系
-		// 从 FromClause 中获取 JoinExpr 信息，以便提炼关系
-		// 从 FromClause 中获取别名信息，可能在 WHERE 会用到
-		for _, vv := range v.GetCommonTableExpr().GetCtequery().GetSelectStmt().GetFromClause() {
-			r1 := parseFromClause(vv, aliasMap)
-			maps.Copy(m, r1)
-		}
+	parseRangeVar(updateStmt.GetRelation(), s)
+	for _, vv := range updateStmt.GetFromClause() {
+		maps.Copy(m, parseFromClause(vv, s))
+	}
+	maps.Copy(m, parseWhereClause(updateStmt.GetWhereClause(), s))
 
-		// 解析 WHERE IN 获取关系
-		r2 := parseWhereClause(v.GetCommonTableExpr().GetCtequery().GetSelectStmt().GetWhereClause(), aliasMap)
-		maps.Copy(m, r2)
+	return m
+}
+
+// 每个 CTE 在单独的一层中解析，之后的 CTE 及主查询可以引用它；recursive 时 CTE 先记录名称，字段未知
+func parseWithClause(withClause *pg_query.WithClause, s *scope) map[string]*RelationShip {
+	m := make(map[string]*RelationShip)
+
+	for _, v := range withClause.GetCtes() {
+		cte := v.GetCommonTableExpr()
+		if withClause.GetRecursive() {
+			s.ctes[cte.GetCtename()] = &Relation{RelName: cte.GetCtename(), Alias: cte.GetCtename(), derived: true}
+		}
 
-		// 记录 CTE 的 Alias
-		r := &Relation{
-			Alias:   v.GetCommonTableExpr().GetCtename(),
-			RelName: v.GetCommonTableExpr().GetCtename(),
+		// 解析 CTE 中的查询，含 UNION 及子查询
+		sub := s.child()
+		if ss := cte.GetCtequery().GetSelectStmt(); ss != nil {
+			maps.Copy(m, parseSelect(ss, sub))
 		}
-		aliasMap[r.Alias] = r
+
+		// 记录 CTE 的名称及结果的字段
+		s.ctes[cte.GetCtename()] = derived(cte.GetCtename(), sub, cte.GetAliascolnames())
 	}
 
 	return m
 }
 
-func parseFromClause(node *pg_query.Node, aliasMap map[string]*Relation) map[string]*RelationShip {
+func parseFromClause(node *pg_query.Node, s *scope) map[string]*RelationShip {
 	// 单表查询
 	if node.GetRangeVar() != nil {
-		return parseRangeVar(node.GetRangeVar(), aliasMap)
+		return parseRangeVar(node.GetRangeVar(), s)
 	}
 
 	// 关联查询
 	if node.GetJoinExpr() != nil {
-		return parseJoinClause(node.GetJoinExpr(), aliasMap)
+		return parseJoinClause(node.GetJoinExpr(), s)
 	}
 
-	// TODO:子查询
+	// 子查询
+	if node.GetRangeSubselect() != nil {
+		return parseRangeSubselect(node.GetRangeSubselect(), s)
+	}
 
 	// TODO:调用 UDF，获取返回值
 	// ...
@@ -319,237 +373,180 @@ func parseFromClause(node *pg_query.Node, aliasMap map[string]*Relation) map[str
 	return nil
 }
 
-func parseRangeVar(node *pg_query.RangeVar, aliasMap map[string]*Relation) map[string]*RelationShip {
-	var alias string
+// 解析子查询中的关系，并以子查询的别名记录，外层经别名引用的字段能追溯到表字段时归到该表上，否则归到子查询上
+func parseRangeSubselect(node *pg_query.RangeSubselect, s *scope) map[string]*RelationShip {
+	sub := s.child()
+	m := parseSelect(node.GetSubquery().GetSelectStmt(), sub)
 
-	if node.GetAlias().GetAliasname() != "" {
-		alias = node.GetAlias().GetAliasname()
-	} else {
-		alias = node.GetRelname()
-	}
+	s.add(derived(node.GetAlias().GetAliasname(), sub, node.GetAlias().GetColnames()))
 
-	lRelation := &Relation{
-		Schema:  node.GetSchemaname(),
-		RelName: node.GetRelname(),
-		Alias:   alias,
-	}
+	return m
+}
 
-	aliasMap[lRelation.Alias] = lRelation
+func parseRangeVar(node *pg_query.RangeVar, s *scope) map[string]*RelationShip {
+	s.add(s.table(node))
 
 	return nil
 }
 
 // 返回左右表间的关系，所以主体有两个表，外加关系，多张表的话，则需要递归
-func parseJoinClause(j *pg_query.JoinExpr, aliasMap map[string]*Relation) map[string]*RelationShip {
+func parseJoinClause(j *pg_query.JoinExpr, s *scope) map[string]*RelationShip {
 	m := make(map[string]*RelationShip)
 
-	// 优先遍历内层JOIN
-	if j.GetLarg().GetJoinExpr() != nil {
-		lSubRelationShip := parseJoinClause(j.GetLarg().GetJoinExpr(), aliasMap)
-		maps.Copy(m, lSubRelationShip)
-	}
-	if j.GetRarg().GetJoinExpr() != nil {
-		rSubRelationShip := parseJoinClause(j.GetRarg().GetJoinExpr(), aliasMap)
-		maps.Copy(m, rSubRelationShip)
-	}
-	// 处理子查询
-	if j.GetLarg().GetRangeSubselect() != nil {
-		// 解析 FROM
-		for _, vv := range j.GetLarg().GetRangeSubselect().GetSubquery().GetSelectStmt().GetFromClause() {
-			r1 := parseFromClause(vv, aliasMap)
-			maps.Copy(m, r1)
-		}
-
-		// 解析 WHERE IN 获取关系
-		r2 := parseWhereClause(j.GetLarg().GetRangeSubselect().GetSubquery().GetSelectStmt().GetWhereClause(), aliasMap)
-		maps.Copy(m, r2)
-
-		// 记录 SubQuery 的 Alias
-		r := &Relation{
-			Alias:   j.GetLarg().GetRangeSubselect().GetAlias().GetAliasname(),
-			RelName: j.GetLarg().GetRangeSubselect().GetAlias().GetAliasname(),
-		}
-		aliasMap[r.Alias] = r
-	}
-	if j.GetRarg().GetRangeSubselect() != nil {
-		// 解析 FROM
-		for _, vv := range j.GetRarg().GetRangeSubselect().GetSubquery().GetSelectStmt().GetFromClause() {
-			r1 := parseFromClause(vv, aliasMap)
-			maps.Copy(m, r1)
-		}
-
-		// 解析 WHERE IN 获取关系
-		r2 := parseWhereClause(j.GetRarg().GetRangeSubselect().GetSubquery().GetSelectStmt().GetWhereClause(), aliasMap)
-		maps.Copy(m, r2)
-
-		// 记录 SubQuery 的 Alias
-		r := &Relation{
-			Alias:   j.GetRarg().GetRangeSubselect().GetAlias().GetAliasname(),
-			RelName: j.GetRarg().GetRangeSubselect().GetAlias().GetAliasname(),
-		}
-		aliasMap[r.Alias] = r
-	}
-	if j.GetLarg().GetRangeVar() != nil {
-		parseRangeVar(j.GetLarg().GetRangeVar(), aliasMap)
-	}
-	if j.GetRarg().GetRangeVar() != nil {
-		parseRangeVar(j.GetRarg().GetRangeVar(), aliasMap)
-	}
+	// 先解析左右两侧（内层 JOIN、子查询、单表），记录别名
+	maps.Copy(m, parseFromClause(j.GetLarg(), s))
+	maps.Copy(m, parseFromClause(j.GetRarg(), s))
 
-	// 解析关联条件
-	currRelationShip := parseWhereClause(j.GetQuals(), aliasMap)
+	// 解析关联条件，关系的类型为 JOIN 的类型
+	currRelationShip := parseQuals(j.GetQuals(), j.GetJointype(), s)
 	maps.Copy(m, currRelationShip)
 
 	return m
 }
 
-// 默认的关联关系定义为
-func parseWhereClause(node *pg_query.Node, aliasMap map[string]*Relation) map[string]*RelationShip {
+// WHERE 中的关联条件记为 JOIN_INNER
+func parseWhereClause(node *pg_query.Node, s *scope) map[string]*RelationShip {
+	return parseQuals(node, pg_query.JoinType_JOIN_INNER, s)
+}
+
+// parseQuals 从关联条件中提取字段间的等值关系，joinType 为关系的类型
+func parseQuals(node *pg_query.Node, joinType pg_query.JoinType, s *scope) map[string]*RelationShip {
 	m := make(map[string]*RelationShip)
 
 	if node.GetAExpr() != nil { // on A.? = B.? and A.? = B.?
-		m = parseAExpr(node.GetAExpr(), pg_query.JoinType_JOIN_INNER, aliasMap)
+		m = parseAExpr(node.GetAExpr(), joinType, s)
 	} else if node.GetBoolExpr() != nil { // (A.? = B.? and/or A.? = B.?) and ...
-		m = parseBoolExpr(node.GetBoolExpr(), pg_query.JoinType_JOIN_INNER, aliasMap)
+		m = parseBoolExpr(node.GetBoolExpr(), joinType, s)
 	} else if node.GetSubLink() != nil { // A.? in (select B.? from B)
-		m = parseSubLink(node.GetSubLink(), pg_query.JoinType_JOIN_INNER, aliasMap)
+		m = parseSubLink(node.GetSubLink(), joinType, s)
 	}
 
 	return m
 }
 
-func parseBoolExpr(expr *pg_query.BoolExpr, joinType pg_query.JoinType, aliasMap map[string]*Relation) map[string]*RelationShip {
+func parseBoolExpr(expr *pg_query.BoolExpr, joinType pg_query.JoinType, s *scope) map[string]*RelationShip {
 	m := make(map[string]*RelationShip)
 	for _, v := range expr.GetArgs() {
-		maps.Copy(m, parseWhereClause(v, aliasMap))
+		maps.Copy(m, parseQuals(v, joinType, s))
 	}
 	return m
 }
 
-func parseAExpr(expr *pg_query.A_Expr, joinType pg_query.JoinType, aliasMap map[string]*Relation) map[string]*RelationShip {
-
-	l := expr.GetLexpr()
-	r := expr.GetRexpr()
-
-	if r.GetAConst() != nil { // col = 'v1'，直接跳过
+func parseAExpr(expr *pg_query.A_Expr, joinType pg_query.JoinType, s *scope) map[string]*RelationShip {
+	// 只有等值条件说明字段间存在关联，col = 'v1'、col IN (...)、col > B.? 等直接跳过
+	if expr.GetKind() != pg_query.A_Expr_Kind_AEXPR_OP || len(expr.GetName()) != 1 ||
+		expr.GetName()[0].GetString_().GetSval() != "=" {
 		return nil
 	}
-	if r.GetList() != nil { // col IN ('v1', 'v2', ...)
-		return nil
-	}
-	if r.GetAExpr() != nil { // col = 'v1' || 'v2'，那直接跳过
+
+	// col = func(...)、col = 'v1' || 'v2' 等不是字段，同样跳过
+	sColumn := columnOf(expr.GetLexpr(), s)
+	tColumn := columnOf(expr.GetRexpr(), s)
+	if sColumn == nil || tColumn == nil {
 		return nil
 	}
-	if r.GetFuncCall() != nil { // col = func(...)
-		return nil
+
+	relationship := &RelationShip{
+		SColumn: sColumn,
+		TColumn: tColumn,
+		Type:    joinType.String(),
 	}
 
-	relationship := &RelationShip{}
+	// checksum
+	m := make(map[string]*RelationShip)
+	key := Hash(relationship)
+	m[key] = relationship
+
+	return m
+}
 
-	if len(l.GetColumnRef().GetFields()) == 2 {
-		rel, ok := aliasMap[l.GetColumnRef().GetFields()[0].GetString_().GetSval()]
-		if !ok {
-			fmt.Printf("Relation not found: %s\n", l.GetColumnRef().GetFields()[0].GetString_().GetSval())
-			fmt.Printf("Details: %s\n", expr)
-			return nil
-		}
+// columnOf 按别名找到 A.? 所属的表，schema.table.? 取后两段，A.?::type 取类型转换前的字段；
+// 不带别名的字段按 catalog 中各表的字段确定所属的表，无法确定时返回 nil
+func columnOf(node *pg_query.Node, s *scope) *Column {
+	if node.GetTypeCast() != nil {
+		node = node.GetTypeCast().GetArg()
+	}
 
-		relationship.SColumn = &Column{
-			Schema:  rel.Schema,
-			RelName: rel.RelName,
-			Field:   l.GetColumnRef().GetFields()[1].GetString_().GetSval(),
-		}
+	fields := node.GetColumnRef().GetFields()
+	if len(fields) == 0 {
+		return nil
+	}
+	field := fields[len(fields)-1].GetString_().GetSval()
+	if field == "" { // A.*
+		return nil
 	}
 
-	if len(r.GetColumnRef().GetFields()) == 2 {
-		rel, ok := aliasMap[r.GetColumnRef().GetFields()[0].GetString_().GetSval()]
+	if len(fields) == 1 {
+		col, ok := s.bind(field)
 		if !ok {
-			fmt.Printf("Relation not found: %s\n", r.GetColumnRef().GetFields()[0].GetString_().GetSval())
-			fmt.Printf("Details: %s\n", expr)
+			log.Debugf("Column not bound: %s", field)
 			return nil
 		}
-
-		relationship.TColumn = &Column{
-			Schema:  rel.Schema,
-			RelName: rel.RelName,
-			Field:   r.GetColumnRef().GetFields()[1].GetString_().GetSval(),
-		}
+		return col
 	}
 
-	relationship.Type = joinType.String()
-
-	// checksum
-	m := make(map[string]*RelationShip)
-	key := Hash(relationship)
-	m[key] = relationship
+	alias := fields[len(fields)-2].GetString_().GetSval()
+	rel, ok := s.lookup(alias)
+	if !ok {
+		log.Debugf("Relation not found: %s", alias)
+		return nil
+	}
 
-	return m
+	return rel.ref(field)
 }
 
-func parseSubLink(node *pg_query.SubLink, jointype pg_query.JoinType, aliasMap map[string]*Relation) map[string]*RelationShip {
+func parseSubLink(node *pg_query.SubLink, jointype pg_query.JoinType, s *scope) map[string]*RelationShip {
 	m := make(map[string]*RelationShip)
 
 	switch node.GetSubLinkType() {
 	case pg_query.SubLinkType_ANY_SUBLINK:
-		m = parseAnySubLink(node, jointype, aliasMap)
+		m = parseAnySubLink(node, jointype, s)
+
+	case pg_query.SubLinkType_EXISTS_SUBLINK:
+		// exists (select 1 from B where B.? = A.?)，子查询的条件中可以引用外层的别名
+		m = parseSelect(node.GetSubselect().GetSelectStmt(), s.child())
 
 	// TODO:扩展支持
 
 	default:
-		fmt.Printf("node.GetSubLinkType(): %s\n", node.GetSubLinkType())
+		log.Debugf("node.GetSubLinkType(): %s", node.GetSubLinkType())
 	}
 
 	return m
 }
 
-func parseAnySubLink(node *pg_query.SubLink, jointype pg_query.JoinType, aliasMap map[string]*Relation) map[string]*RelationShip {
-	// fmt.Printf("parseAnySubLink: %s", node)
-
+func parseAnySubLink(node *pg_query.SubLink, jointype pg_query.JoinType, s *scope) map[string]*RelationShip {
+	// 外层的字段在外层解析
 	// 跳过 func(A.?) IN (SELECT B.? FROM B) ，较复杂，不适合暴露给用户
-	// 跳过 ? IN (SELECT B.? FROM B) ? 前没有明确的表别名
-	if node.GetTestexpr().GetFuncCall() != nil ||
-		len(node.GetTestexpr().GetColumnRef().GetFields()) < 2 {
-		return nil
-	}
-	// 跳过 A.? IN (SELECT func(B.?) FROM B) ，较复杂，不适合暴露给用户
-	// 跳过 A.? IN (SELECT ? FROM ...) ? 前没有明确的表别名
-	if len(node.GetSubselect().GetSelectStmt().GetTargetList()) == 1 &&
-		(node.GetSubselect().GetSelectStmt().GetTargetList()[0].GetResTarget().GetVal().GetFuncCall() != nil ||
-			len(node.GetSubselect().GetSelectStmt().GetTargetList()[0].GetResTarget().GetVal().GetColumnRef().GetFields()) < 2) {
-		return nil
-	}
-
-	relationship := &RelationShip{}
+	sColumn := columnOf(node.GetTestexpr(), s)
 
-	// TODO:目前仅支持子查询是单表查询的情况，不支持 B 是多表查询，关联查询，嵌套子查询
-	// 支持 A.? IN (SELECT B.? FROM B)
-	if len(node.GetTestexpr().GetColumnRef().GetFields()) == 2 &&
-		len(node.GetSubselect().GetSelectStmt().GetTargetList()) == 1 &&
-		len(node.GetSubselect().GetSelectStmt().GetTargetList()[0].GetResTarget().GetVal().GetColumnRef().GetFields()) <= 2 &&
-		len(node.GetSubselect().GetSelectStmt().GetFromClause()) == 1 {
+	// 子查询自身的关联
+	ss := node.GetSubselect().GetSelectStmt()
+	sub := s.child()
+	m := parseSelect(ss, sub)
 
-		lrel := aliasMap[node.GetTestexpr().GetColumnRef().GetFields()[0].GetString_().GetSval()]
-		relationship.SColumn = &Column{
-			Schema:  lrel.Schema,
-			RelName: lrel.RelName,
-			Field:   node.GetTestexpr().GetColumnRef().GetFields()[1].GetString_().GetSval(),
-		}
-
-		rrel := node.GetSubselect().GetSelectStmt().GetFromClause()[0].GetRangeVar()
-		c := len(node.GetSubselect().GetSelectStmt().GetTargetList()[0].GetResTarget().GetVal().GetColumnRef().GetFields())
-		relationship.TColumn = &Column{
-			Schema:  rrel.GetSchemaname(),
-			RelName: rrel.GetRelname(),
-			Field:   node.GetSubselect().GetSelectStmt().GetTargetList()[0].GetResTarget().GetVal().GetColumnRef().GetFields()[c-1].GetString_().GetSval(),
-		}
+	if sColumn == nil || len(ss.GetTargetList()) != 1 {
+		return m
+	}
 
-		relationship.Type = jointype.String()
+	// 支持 A.? IN (SELECT B.? FROM B ...)，子查询为单表时字段可以不带别名
+	// 跳过 A.? IN (SELECT func(B.?) FROM B) ，较复杂，不适合暴露给用户
+	target := ss.GetTargetList()[0].GetResTarget().GetVal()
+	tColumn := columnOf(target, sub)
+	if tColumn == nil && len(target.GetColumnRef().GetFields()) == 1 && len(sub.relations) == 1 {
+		tColumn = sub.relations[0].ref(target.GetColumnRef().GetFields()[0].GetString_().GetSval())
+	}
+	if tColumn == nil || tColumn.Field == "" {
+		return m
 	}
 
-	// TODO:扩展支持
+	relationship := &RelationShip{
+		SColumn: sColumn,
+		TColumn: tColumn,
+		Type:    jointype.String(),
+	}
 
 	// checksum
-	m := make(map[string]*RelationShip)
 	key := Hash(relationship)
 	m[key] = relationship
 
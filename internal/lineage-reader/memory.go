@@ -0,0 +1,167 @@
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	writer "pg_lineage/internal/lineage-writer"
+)
+
+// Memory 内存中的血缘图，用于测试或加载 json 文件 writer 导出的快照
+type Memory struct {
+	graphReader
+	data *memStore
+}
+
+type memStore struct {
+	mu   sync.RWMutex
+	byID map[string]*Node
+	up   map[string][]edge // 键为下游端点
+	down map[string][]edge // 键为上游端点
+}
+
+func NewMemory() *Memory {
+	s := &memStore{
+		byID: make(map[string]*Node),
+		up:   make(map[string][]edge),
+		down: make(map[string][]edge),
+	}
+	return &Memory{graphReader: graphReader{s}, data: s}
+}
+
+// AddNode 同 ID 的节点后加入的覆盖先加入的
+func (m *Memory) AddNode(n *Node) {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	m.data.byID[n.ID] = n
+}
+
+// AddEdge Kind 为 contain 时表示 dashboard 到面板，为 join 时表示 ERD 中表间的关联，其余均视为数据流向
+func (m *Memory) AddEdge(e *Edge) {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	ed := edge{up: e.From, down: e.To, typ: e.Kind, attrs: e.Attributes}
+	m.data.down[e.From] = append(m.data.down[e.From], ed)
+	m.data.up[e.To] = append(m.data.up[e.To], ed)
+}
+
+// graphJSON json 文件 writer 的输出格式，见 docs/lineage-graph.schema.json
+type graphJSON struct {
+	Nodes []struct {
+		ID         string         `json:"id"`
+		Kind       string         `json:"kind"`
+		Service    string         `json:"service"`
+		Domain     string         `json:"domain"`
+		Name       string         `json:"name"`
+		Attributes map[string]any `json:"attributes"`
+	} `json:"nodes"`
+	Edges []struct {
+		Up         string         `json:"up"`
+		Down       string         `json:"down"`
+		Kind       string         `json:"kind"`
+		Attributes map[string]any `json:"attributes"`
+	} `json:"edges"`
+}
+
+// LoadGraphJSON 读取 json 文件 writer 导出的血缘图
+func LoadGraphJSON(path string) (*Memory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var g graphJSON
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("lineage graph %s: %w", path, err)
+	}
+
+	m := NewMemory()
+	for _, n := range g.Nodes {
+		m.AddNode(&Node{ID: n.ID, Kind: n.Kind, Service: n.Service, Database: n.Domain, Name: n.Name, Attributes: n.Attributes})
+	}
+	for _, e := range g.Edges {
+		m.AddEdge(&Edge{From: e.Up, To: e.Down, Kind: e.Kind, Attributes: e.Attributes})
+	}
+	return m, nil
+}
+
+func openGraphJSON(ctx *writer.WriterContext) (LineageReader, error) {
+	var conf struct {
+		Path string `mapstructure:"path"`
+	}
+	if err := ctx.Decode(&conf); err != nil {
+		return nil, err
+	}
+	return LoadGraphJSON(conf.Path)
+}
+
+func (s *memStore) close() error {
+	return nil
+}
+
+func (s *memStore) nodes(ids []string) (map[string]*Node, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[string]*Node, len(ids))
+	for _, id := range ids {
+		if n, ok := s.byID[id]; ok {
+			out[id] = n
+		}
+	}
+	return out, nil
+}
+
+func (s *memStore) edges(ids []string, dir direction) ([]edge, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.down
+	if dir == upstream {
+		index = s.up
+	}
+	var out []edge
+	for _, id := range ids {
+		out = append(out, index[id]...)
+	}
+	return out, nil
+}
+
+func (s *memStore) edgeDetails(from, to string) ([]*Edge, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []*Edge
+	for _, e := range s.down[from] {
+		if e.down == to {
+			out = append(out, &Edge{From: e.up, To: e.down, Kind: e.typ, Attributes: e.attrs})
+		}
+	}
+	return out, nil
+}
+
+// search 与 Neo4j 的 =~ 一致，正则需整体匹配
+func (s *memStore) search(pattern string, limit int) ([]*Node, error) {
+	re, err := regexp.Compile(`^(?:` + regexPattern(pattern) + `)$`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []*Node
+	for _, n := range s.byID {
+		if re.MatchString(n.ID) || re.MatchString(n.Name) {
+			out = append(out, n)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
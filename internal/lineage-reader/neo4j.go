@@ -0,0 +1,247 @@
+package reader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	writer "pg_lineage/internal/lineage-writer"
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/samber/lo"
+)
+
+// neo4jReader 直接用可变长路径查询，一次往返取回整个子图
+type neo4jReader struct {
+	driver   neo4j.DriverWithContext
+	database string
+}
+
+func openNeo4j(ctx *writer.WriterContext) (LineageReader, error) {
+	var c config.Neo4jService
+	if err := ctx.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	driver, err := writer.InitNeo4jDriver(&c)
+	if err != nil {
+		return nil, err
+	}
+	if err := driver.VerifyConnectivity(context.Background()); err != nil {
+		driver.Close(context.Background())
+		return nil, err
+	}
+	return &neo4jReader{driver: driver, database: c.Database}, nil
+}
+
+func (r *neo4jReader) Close() error {
+	return r.driver.Close(context.Background())
+}
+
+func (r *neo4jReader) query(cypher string, params map[string]any) ([]*neo4j.Record, error) {
+	result, err := neo4j.ExecuteQuery(context.Background(), r.driver, cypher, params, neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase(r.database), neo4j.ExecuteQueryWithReadersRouting())
+	if err != nil {
+		return nil, err
+	}
+	return result.Records, nil
+}
+
+func (r *neo4jReader) Node(id string) (*Node, error) {
+	records, err := r.query(`MATCH (n:lineage {id: $id}) RETURN n`, map[string]any{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	return neo4jNode(records[0].Values[0]), nil
+}
+
+func (r *neo4jReader) Upstream(id string, depth int) (*depgraph.Graph, error) {
+	return r.walk(id, fmt.Sprintf(`(m:lineage)-[:downstream*1..%d]->(root)`, clampDepth(depth)))
+}
+
+func (r *neo4jReader) Downstream(id string, depth int) (*depgraph.Graph, error) {
+	return r.walk(id, fmt.Sprintf(`(root)-[:downstream*1..%d]->(m:lineage)`, clampDepth(depth)))
+}
+
+// walk 先收集范围内的节点，再取这些节点之间的边，避免逐条返回路径
+func (r *neo4jReader) walk(id, pattern string) (*depgraph.Graph, error) {
+	records, err := r.query(`
+		MATCH (root:lineage {id: $id})
+		OPTIONAL MATCH `+pattern+`
+		WITH root, collect(DISTINCT m) + root AS ns
+		UNWIND ns AS n
+		OPTIONAL MATCH (n)-[:downstream]->(c:lineage) WHERE c IN ns
+		RETURN n, collect(DISTINCT c.id) AS children
+	`, map[string]any{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	sg := newSubgraph()
+	for _, rec := range records {
+		n := neo4jNode(rec.Values[0])
+		sg.addNode(n)
+		children, _ := rec.Values[1].([]any)
+		for _, c := range children {
+			if cid, ok := c.(string); ok {
+				sg.addEdge(n.ID, cid)
+			}
+		}
+	}
+	return sg.graph(), nil
+}
+
+func (r *neo4jReader) Path(from, to string) (*depgraph.Graph, error) {
+	if from == to {
+		n, err := r.Node(from)
+		if err != nil {
+			return nil, err
+		}
+		return depgraph.New().AddNode(n), nil
+	}
+
+	records, err := r.query(fmt.Sprintf(`
+		MATCH (a:lineage {id: $from}), (b:lineage {id: $to})
+		OPTIONAL MATCH p = allShortestPaths((a)-[:downstream*..%d]->(b))
+		RETURN p
+	`, MaxDepth), map[string]any{"from": from, "to": to})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s or %s: %w", from, to, ErrNotFound)
+	}
+
+	sg := newSubgraph()
+	for _, rec := range records {
+		p, ok := rec.Values[0].(neo4j.Path)
+		if !ok {
+			return nil, fmt.Errorf("%s -> %s: %w", from, to, ErrNoPath)
+		}
+		addPath(sg, p)
+	}
+	return sg.graph(), nil
+}
+
+// Impact 面板所在的 dashboard 通过 contain 边取得
+func (r *neo4jReader) Impact(id string) (*depgraph.Graph, error) {
+	records, err := r.query(fmt.Sprintf(`
+		MATCH (root:lineage {id: $id})
+		OPTIONAL MATCH p = (root)-[:downstream*1..%d]->(:panel)
+		WITH root, p, last(nodes(p)) AS panel
+		OPTIONAL MATCH (d:dashboard)-[:contain]->(panel)
+		RETURN root, p, d, panel.id
+	`, MaxDepth), map[string]any{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	sg := newSubgraph()
+	for _, rec := range records {
+		sg.addNode(neo4jNode(rec.Values[0]))
+		if p, ok := rec.Values[1].(neo4j.Path); ok {
+			addPath(sg, p)
+		}
+		if d, ok := rec.Values[2].(neo4j.Node); ok {
+			dn := neo4jNode(d)
+			sg.addNode(dn)
+			sg.addEdge(dn.ID, rec.Values[3].(string))
+		}
+	}
+	return sg.graph(), nil
+}
+
+func (r *neo4jReader) Edges(from, to string) ([]*Edge, error) {
+	records, err := r.query(`
+		MATCH (:lineage {id: $from})-[e]->(:lineage {id: $to})
+		RETURN type(e), properties(e) ORDER BY coalesce(e.id, '')
+	`, map[string]any{"from": from, "to": to})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Edge, 0, len(records))
+	for _, rec := range records {
+		e := &Edge{From: from, To: to}
+		e.Kind, _ = rec.Values[0].(string)
+		e.Attributes, _ = rec.Values[1].(map[string]any)
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (r *neo4jReader) Search(pattern string, limit int) ([]*Node, error) {
+	records, err := r.query(`
+		MATCH (n:lineage)
+		WHERE n.id =~ $re OR coalesce(n.relname, n.panel_title, n.title, '') =~ $re
+		RETURN n ORDER BY n.id LIMIT $limit
+	`, map[string]any{"re": regexPattern(pattern), "limit": limit})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Node, 0, len(records))
+	for _, rec := range records {
+		out = append(out, neo4jNode(rec.Values[0]))
+	}
+	return out, nil
+}
+
+// addPath 路径为单一方向，相邻节点即为一条边
+func addPath(sg *subgraph, p neo4j.Path) {
+	for i, n := range p.Nodes {
+		node := neo4jNode(n)
+		sg.addNode(node)
+		if i > 0 {
+			sg.addEdge(neo4jNode(p.Nodes[i-1]).ID, node.ID)
+		}
+	}
+}
+
+// neo4jNode 按 Neo4jLineageWriter 写入时的 label 与属性还原节点
+func neo4jNode(v any) *Node {
+	n, _ := v.(neo4j.Node)
+	out := &Node{Attributes: make(map[string]any, len(n.Props))}
+	for k, v := range n.Props {
+		if k == "id" {
+			out.ID, _ = v.(string)
+			continue
+		}
+		out.Attributes[k] = v
+	}
+	prop := func(k string) string {
+		s, _ := n.Props[k].(string)
+		return s
+	}
+
+	switch {
+	case lo.Contains(n.Labels, "panel"):
+		out.Kind, out.Service = KindPanel, "grafana"
+		out.Database, _, _ = strings.Cut(out.ID, ">")
+		out.Name = prop("dashboard_title") + ">" + prop("panel_title")
+	case lo.Contains(n.Labels, "dashboard"):
+		out.Kind, out.Service = KindDashboard, "grafana"
+		out.Database, _, _ = strings.Cut(out.ID, ">")
+		out.Name = prop("title")
+	default:
+		out.Kind = KindTable
+		out.Service, _ = lo.Find([]string{service.DBTypePostgres, service.DBTypeGreenplum}, func(t string) bool {
+			return lo.Contains(n.Labels, t)
+		})
+		out.Database = prop("database")
+		out.Name = prop("schemaname") + "." + prop("relname")
+	}
+	return out
+}
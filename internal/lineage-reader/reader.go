@@ -0,0 +1,182 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	writer "pg_lineage/internal/lineage-writer"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+)
+
+// MaxDepth 上下游遍历及路径查找的最大层数，depth <= 0 时按该值处理
+const MaxDepth = 10
+
+var (
+	ErrNotFound = errors.New("node not found")
+	ErrNoPath   = errors.New("no path between nodes")
+)
+
+// 节点种类，与写入时的 data_lineage_node.type / Neo4j label 对应，文件等其他种类沿用 depgraph.NodeKind
+const (
+	KindTable     = string(depgraph.KindTable)
+	KindDashboard = string(depgraph.KindDashboard)
+	KindPanel     = string(depgraph.KindPanel)
+)
+
+// LineageReader 查询已写入的血缘图，Upstream / Downstream / Path / Impact 返回的子图中
+// 节点均为 *Node，边的方向为上游 -> 下游
+type LineageReader interface {
+	// Node 单个节点及其属性（calls、seq_scan、description 等）
+	Node(id string) (*Node, error)
+	// Upstream 向上游遍历 depth 层，子图包含 id 本身
+	Upstream(id string, depth int) (*depgraph.Graph, error)
+	// Downstream 向下游遍历 depth 层，子图包含 id 本身
+	Downstream(id string, depth int) (*depgraph.Graph, error)
+	// Path from 到 to 的所有最短路径，不连通时返回 ErrNoPath
+	Path(from, to string) (*depgraph.Graph, error)
+	// Impact 受 id 影响的 Grafana 面板：从 id 到各面板的路径，以及面板所属的 dashboard
+	Impact(id string) (*depgraph.Graph, error)
+	// Edges from 到 to 的所有边及其属性（procname、calls 等），同一对节点间可能有多个函数产生的边
+	Edges(from, to string) ([]*Edge, error)
+	// Search 按节点名匹配，pattern 含 * ? 时按通配符整体匹配，否则按子串匹配，均不区分大小写
+	Search(pattern string, limit int) ([]*Node, error)
+	Close() error
+}
+
+// Node 子图中的节点，ID 为写入时的节点标识（Neo4j 的 id 属性、manager 表的 node_name）
+type Node struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind,omitempty"`     // table | dashboard | panel | file 等，未写入点的边端点为空
+	Service    string         `json:"service,omitempty"`  // 数据源类型或 grafana
+	Database   string         `json:"database,omitempty"` // 数据源 label 或 Grafana host
+	Name       string         `json:"name,omitempty"`     // schema.table、folder>dashboard>panel 等可读名称
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Edge 两个节点间的一条边，Kind 为写入时的类型：Neo4j 的关系类型，或 manager 表的 type 列
+type Edge struct {
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Kind       string         `json:"kind"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func (n *Node) GetID() string {
+	return n.ID
+}
+
+func (n *Node) IsTemp() bool {
+	return false
+}
+
+func (n *Node) GetKind() depgraph.NodeKind {
+	return depgraph.NodeKind(n.Kind)
+}
+
+func (n *Node) GetAttributes() map[string]any {
+	return n.Attributes
+}
+
+type opener func(ctx *writer.WriterContext) (LineageReader, error)
+
+// 可读的存储后端，键为 writer 的注册名
+var openers = map[string]opener{
+	"neo4j":    openNeo4j,
+	"postgres": openPostgres,
+	"sqlite":   openSQLite,
+	"json":     openGraphJSON,
+}
+
+// Open 从启用的 writer 中选取可查询的后端，typ 为空时取第一个
+func Open(cfg *config.StorageConfig, typ string) (LineageReader, error) {
+	for _, wc := range cfg.EnabledWriters() {
+		open, ok := openers[wc.Type]
+		if !ok || (typ != "" && wc.Type != typ) {
+			continue
+		}
+		r, err := open(&writer.WriterContext{Type: wc.Type, Settings: wc.Settings})
+		if err != nil {
+			return nil, fmt.Errorf("open %s reader: %w", wc.Type, err)
+		}
+		return r, nil
+	}
+	if typ != "" {
+		return nil, fmt.Errorf("no enabled %s writer in storage", typ)
+	}
+	return nil, errors.New("no readable writer (neo4j, postgres, sqlite, json) enabled in storage")
+}
+
+func clampDepth(depth int) int {
+	if depth <= 0 || depth > MaxDepth {
+		return MaxDepth
+	}
+	return depth
+}
+
+func hasWildcard(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?")
+}
+
+// likePattern 转为 LIKE 模式，配合 ESCAPE '\' 使用
+func likePattern(pattern string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(pattern))
+	if !hasWildcard(pattern) {
+		return "%" + escaped + "%"
+	}
+	return strings.NewReplacer("*", "%", "?", "_").Replace(escaped)
+}
+
+// regexPattern 转为 Cypher =~ 使用的正则，=~ 要求整体匹配
+func regexPattern(pattern string) string {
+	if !hasWildcard(pattern) {
+		return "(?i).*" + regexp.QuoteMeta(pattern) + ".*"
+	}
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return "(?i)" + quoted
+}
+
+// subgraph 累积节点和边，最后生成 depgraph.Graph；边的端点没有对应节点时补一个只有 ID 的节点
+type subgraph struct {
+	nodes map[string]*Node
+	edges map[[2]string]struct{}
+}
+
+func newSubgraph() *subgraph {
+	return &subgraph{nodes: make(map[string]*Node), edges: make(map[[2]string]struct{})}
+}
+
+func (s *subgraph) addNode(n *Node) {
+	if n != nil {
+		s.nodes[n.ID] = n
+	}
+}
+
+func (s *subgraph) addEdge(up, down string) {
+	if up != down {
+		s.edges[[2]string{up, down}] = struct{}{}
+	}
+}
+
+func (s *subgraph) graph() *depgraph.Graph {
+	g := depgraph.New()
+	node := func(id string) *Node {
+		if n, ok := s.nodes[id]; ok {
+			return n
+		}
+		n := &Node{ID: id}
+		s.nodes[id] = n
+		return n
+	}
+	for e := range s.edges {
+		g.AddNode(node(e[0])).AddNode(node(e[1])).AddEdge(node(e[0]), node(e[1]))
+	}
+	for _, n := range s.nodes {
+		g.AddNode(n)
+	}
+	return g
+}
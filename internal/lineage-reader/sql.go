@@ -0,0 +1,222 @@
+package reader
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	writer "pg_lineage/internal/lineage-writer"
+	"pg_lineage/pkg/config"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// IN 列表的最大长度，超过时分批查询
+const sqlBatchSize = 500
+
+// sqlDialect PGLineageWriter 与 SQLiteLineageWriter 的表结构相同，只有表名和占位符不同
+type sqlDialect struct {
+	nodeTable   string
+	relTable    string
+	attribute   string // 以文本形式读取 attribute 的表达式
+	placeholder func(i int) string
+}
+
+var postgresDialect = sqlDialect{
+	nodeTable:   "manager.data_lineage_node",
+	relTable:    "manager.data_lineage_relationship",
+	attribute:   "attribute::text",
+	placeholder: func(i int) string { return fmt.Sprintf("$%d", i) },
+}
+
+var sqliteDialect = sqlDialect{
+	nodeTable:   "data_lineage_node",
+	relTable:    "data_lineage_relationship",
+	attribute:   "attribute",
+	placeholder: func(int) string { return "?" },
+}
+
+type sqlStore struct {
+	db *sql.DB
+	sqlDialect
+}
+
+func openPostgres(ctx *writer.WriterContext) (LineageReader, error) {
+	var c config.PostgresService
+	if err := ctx.Decode(&c); err != nil {
+		return nil, err
+	}
+	db, err := writer.InitPGClient(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &graphReader{&sqlStore{db: db, sqlDialect: postgresDialect}}, nil
+}
+
+// openSQLite 以只读方式打开，不与正在采集的 writer 争用写锁
+func openSQLite(ctx *writer.WriterContext) (LineageReader, error) {
+	conf := struct {
+		Path string `mapstructure:"path"`
+	}{Path: "pg_lineage.db"}
+	if err := ctx.Decode(&conf); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+conf.Path+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open err: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db.Ping err: %w", err)
+	}
+	return &graphReader{&sqlStore{db: db, sqlDialect: sqliteDialect}}, nil
+}
+
+func (s *sqlStore) close() error {
+	return s.db.Close()
+}
+
+// in 生成从 start 开始编号的 n 个占位符
+func (s *sqlStore) in(start, n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = s.placeholder(start + i)
+	}
+	return strings.Join(ps, ", ")
+}
+
+func (s *sqlStore) nodeColumns() string {
+	return "node_name, service, domain, node, " + s.attribute + ", type"
+}
+
+func (s *sqlStore) nodes(ids []string) (map[string]*Node, error) {
+	out := make(map[string]*Node, len(ids))
+	err := eachBatch(ids, func(batch []any) error {
+		rows, err := s.db.Query(`SELECT `+s.nodeColumns()+` FROM `+s.nodeTable+
+			` WHERE node_name IN (`+s.in(1, len(batch))+`)`, batch...)
+		if err != nil {
+			return err
+		}
+		ns, err := scanNodes(rows)
+		for _, n := range ns {
+			out[n.ID] = n
+		}
+		return err
+	})
+	return out, err
+}
+
+func (s *sqlStore) edges(ids []string, dir direction) ([]edge, error) {
+	column := "up_node_name"
+	if dir == upstream {
+		column = "down_node_name"
+	}
+
+	var out []edge
+	err := eachBatch(ids, func(batch []any) error {
+		rows, err := s.db.Query(`SELECT DISTINCT up_node_name, down_node_name, type FROM `+s.relTable+
+			` WHERE `+column+` IN (`+s.in(1, len(batch))+`)`, batch...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e edge
+			if err := rows.Scan(&e.up, &e.down, &e.typ); err != nil {
+				return err
+			}
+			out = append(out, e)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+func (s *sqlStore) edgeDetails(from, to string) ([]*Edge, error) {
+	rows, err := s.db.Query(`SELECT type, `+s.attribute+` FROM `+s.relTable+
+		` WHERE up_node_name = `+s.placeholder(1)+` AND down_node_name = `+s.placeholder(2)+` ORDER BY name`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Edge
+	for rows.Next() {
+		var (
+			e         = &Edge{From: from, To: to}
+			attribute string
+		)
+		if err := rows.Scan(&e.Kind, &attribute); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(attribute), &e.Attributes); err != nil {
+			return nil, fmt.Errorf("edge %s -> %s attribute: %w", from, to, err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// search 同时匹配节点名和可读名称，PostgreSQL 的 LIKE 区分大小写，两边都转为小写
+func (s *sqlStore) search(pattern string, limit int) ([]*Node, error) {
+	like := likePattern(pattern)
+	rows, err := s.db.Query(`SELECT `+s.nodeColumns()+` FROM `+s.nodeTable+
+		` WHERE lower(node_name) LIKE `+s.placeholder(1)+` ESCAPE '\' OR lower(node) LIKE `+s.placeholder(2)+` ESCAPE '\'`+
+		` ORDER BY node_name LIMIT `+s.placeholder(3), like, like, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanNodes(rows)
+}
+
+func eachBatch(ids []string, fn func(batch []any) error) error {
+	for start := 0; start < len(ids); start += sqlBatchSize {
+		end := min(start+sqlBatchSize, len(ids))
+		batch := make([]any, 0, end-start)
+		for _, id := range ids[start:end] {
+			batch = append(batch, id)
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanNodes(rows *sql.Rows) ([]*Node, error) {
+	defer rows.Close()
+
+	var out []*Node
+	for rows.Next() {
+		var (
+			n         Node
+			attribute string
+			typ       string
+		)
+		if err := rows.Scan(&n.ID, &n.Service, &n.Database, &n.Name, &attribute, &typ); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(attribute), &n.Attributes); err != nil {
+			return nil, fmt.Errorf("node %s attribute: %w", n.ID, err)
+		}
+		n.Kind = sqlNodeKind(typ)
+		out = append(out, &n)
+	}
+	return out, rows.Err()
+}
+
+// sqlNodeKind data_lineage_node.type 为 <数据源类型>-table、dashboard、dashboard-panel
+func sqlNodeKind(typ string) string {
+	switch {
+	case strings.HasSuffix(typ, "-table"):
+		return KindTable
+	case typ == "dashboard":
+		return KindDashboard
+	case typ == "dashboard-panel":
+		return KindPanel
+	}
+	return typ
+}
@@ -0,0 +1,109 @@
+package reader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	writer "pg_lineage/internal/lineage-writer"
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+	"pg_lineage/pkg/log"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "reader-test")
+	if err != nil {
+		panic(err)
+	}
+	// 写入时会写日志
+	if err := log.InitLogger(&config.LogConfig{Level: "error", Path: filepath.Join(dir, "test.log")}); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// TestSQLiteRoundTrip 经 WriterManager 写入 SQLite，再由 SQL 读取端查询：dw.a -> dw.b -> dw.c，dw.f 调用两次
+func TestSQLiteRoundTrip(t *testing.T) {
+	cfg := &config.StorageConfig{Writers: []config.WriterConfig{{
+		Type: "sqlite", Enabled: true, Settings: map[string]any{"path": filepath.Join(t.TempDir(), "lineage.db")},
+	}}}
+	wm, err := writer.InitWriterManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	s := config.PostgresService{Label: "dw", Zone: "z", DBName: "dwdb", Type: service.DBTypePostgres}
+	table := func(name string) *service.Table {
+		return &service.Table{Database: "dw", SchemaName: "dw", RelName: name, RelPersistence: service.REL_PERSIST}
+	}
+	g := depgraph.New()
+	g.SetNamespace("dw")
+	g.DependOn(table("b"), table("a"))
+	g.DependOn(table("c"), table("b"))
+	udf := &service.Udf{Database: "dw", SchemaName: "dw", ProcName: "f", Calls: 2}
+	for i := 0; i < 2; i++ {
+		if err := wm.CreateGraphPostgres(g, udf, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := Open(cfg, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	nodes, err := r.Search("dwdb.dw.", 10)
+	if err != nil || len(nodes) != 3 {
+		t.Fatalf("Search = %v, %v", nodes, err)
+	}
+	ids := map[string]string{}
+	for _, n := range nodes {
+		ids[n.Attributes["tablename"].(string)] = n.ID
+	}
+	a, b, c := ids["a"], ids["b"], ids["c"]
+
+	for _, tc := range []struct {
+		name  string
+		walk  func() (*depgraph.Graph, error)
+		nodes []string
+	}{
+		{"upstream", func() (*depgraph.Graph, error) { return r.Upstream(c, 0) }, []string{a, b, c}},
+		{"upstream depth 1", func() (*depgraph.Graph, error) { return r.Upstream(c, 1) }, []string{b, c}},
+		{"downstream", func() (*depgraph.Graph, error) { return r.Downstream(a, 0) }, []string{a, b, c}},
+		{"path", func() (*depgraph.Graph, error) { return r.Path(a, c) }, []string{a, b, c}},
+	} {
+		sg, err := tc.walk()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(sg.GetNodes()) != len(tc.nodes) {
+			t.Errorf("%s: nodes = %v, want %v", tc.name, sg.NodeIDs(), tc.nodes)
+		}
+		for _, id := range tc.nodes {
+			if _, ok := sg.GetNodes()[id]; !ok {
+				t.Errorf("%s: missing %s", tc.name, id)
+			}
+		}
+	}
+
+	if _, err := r.Path(c, a); !errors.Is(err, ErrNoPath) {
+		t.Errorf("Path against the flow: err = %v, want ErrNoPath", err)
+	}
+
+	// 同一个函数重复写入的边只有一条，calls 累加
+	edges, err := r.Edges(a, b)
+	if err != nil || len(edges) != 1 {
+		t.Fatalf("Edges = %v, %v", edges, err)
+	}
+	if e := edges[0]; e.Attributes["procname"] != "f" || e.Attributes["calls"] != 4.0 {
+		t.Errorf("edge attributes = %v, want procname f and calls 4", e.Attributes)
+	}
+}
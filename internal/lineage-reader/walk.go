@@ -0,0 +1,279 @@
+package reader
+
+import (
+	"fmt"
+
+	"pg_lineage/pkg/depgraph"
+)
+
+// dashboard 到面板的边、ERD 中表间的关联，不表示数据流向，上下游遍历时跳过
+const (
+	edgeContain = "contain"
+	edgeJoin    = "join"
+)
+
+func isDataFlow(typ string) bool {
+	return typ != edgeContain && typ != edgeJoin
+}
+
+type direction int
+
+const (
+	upstream direction = iota
+	downstream
+)
+
+type edge struct {
+	up, down, typ string
+	attrs         map[string]any // 只有内存实现保存
+}
+
+// store 按层遍历所需的查询，SQL 后端实现它，遍历逻辑由 graphReader 统一完成
+type store interface {
+	// nodes 查询存在的节点，不存在的 ID 不出现在结果中
+	nodes(ids []string) (map[string]*Node, error)
+	// edges 与 ids 相连的边，upstream 时 ids 为下游端点，downstream 时为上游端点
+	edges(ids []string, dir direction) ([]edge, error)
+	// edgeDetails from 到 to 的边，含属性
+	edgeDetails(from, to string) ([]*Edge, error)
+	search(pattern string, limit int) ([]*Node, error)
+	close() error
+}
+
+// graphReader 在 store 之上逐层展开，每层一次查询
+type graphReader struct {
+	store
+}
+
+func (r *graphReader) Close() error {
+	return r.close()
+}
+
+func (r *graphReader) Search(pattern string, limit int) ([]*Node, error) {
+	return r.search(pattern, limit)
+}
+
+func (r *graphReader) Edges(from, to string) ([]*Edge, error) {
+	return r.edgeDetails(from, to)
+}
+
+func (r *graphReader) Node(id string) (*Node, error) {
+	ns, err := r.nodes([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	n, ok := ns[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	return n, nil
+}
+
+func (r *graphReader) Upstream(id string, depth int) (*depgraph.Graph, error) {
+	sg, err := r.walk(id, clampDepth(depth), upstream)
+	if err != nil {
+		return nil, err
+	}
+	return sg.graph(), nil
+}
+
+func (r *graphReader) Downstream(id string, depth int) (*depgraph.Graph, error) {
+	sg, err := r.walk(id, clampDepth(depth), downstream)
+	if err != nil {
+		return nil, err
+	}
+	return sg.graph(), nil
+}
+
+func (r *graphReader) walk(id string, depth int, dir direction) (*subgraph, error) {
+	root, err := r.Node(id)
+	if err != nil {
+		return nil, err
+	}
+
+	sg := newSubgraph()
+	sg.addNode(root)
+	seen := map[string]bool{id: true}
+	frontier := []string{id}
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		es, err := r.edges(frontier, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []string
+		for _, e := range es {
+			if !isDataFlow(e.typ) {
+				continue
+			}
+			sg.addEdge(e.up, e.down)
+
+			other := e.down
+			if dir == upstream {
+				other = e.up
+			}
+			if !seen[other] {
+				seen[other] = true
+				next = append(next, other)
+			}
+		}
+		frontier = next
+	}
+
+	return sg, r.fill(sg)
+}
+
+// Path 从 from 向下游逐层展开，记录每个节点在最短层数上的所有前驱，到达 to 后回溯
+func (r *graphReader) Path(from, to string) (*depgraph.Graph, error) {
+	sg := newSubgraph()
+	for _, id := range []string{from, to} {
+		n, err := r.Node(id)
+		if err != nil {
+			return nil, err
+		}
+		sg.addNode(n)
+	}
+	if from == to {
+		return sg.graph(), nil
+	}
+
+	level := map[string]int{from: 0}
+	preds := make(map[string]map[string]struct{})
+	frontier := []string{from}
+	for depth := 1; depth <= MaxDepth && len(frontier) > 0; depth++ {
+		es, err := r.edges(frontier, downstream)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []string
+		for _, e := range es {
+			if !isDataFlow(e.typ) {
+				continue
+			}
+			l, ok := level[e.down]
+			if ok && l < depth {
+				continue
+			}
+			if !ok {
+				level[e.down] = depth
+				preds[e.down] = make(map[string]struct{})
+				next = append(next, e.down)
+			}
+			preds[e.down][e.up] = struct{}{}
+		}
+		if _, ok := level[to]; ok {
+			break
+		}
+		frontier = next
+	}
+	if _, ok := level[to]; !ok {
+		return nil, fmt.Errorf("%s -> %s: %w", from, to, ErrNoPath)
+	}
+
+	visited := map[string]bool{to: true}
+	stack := []string{to}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for p := range preds[n] {
+			sg.addEdge(p, n)
+			if !visited[p] {
+				visited[p] = true
+				stack = append(stack, p)
+			}
+		}
+	}
+
+	if err := r.fill(sg); err != nil {
+		return nil, err
+	}
+	return sg.graph(), nil
+}
+
+// Impact 保留下游子图中能到达面板的部分，再补上面板所属的 dashboard
+func (r *graphReader) Impact(id string) (*depgraph.Graph, error) {
+	sg, err := r.walk(id, MaxDepth, downstream)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[string][]string)
+	for e := range sg.edges {
+		parents[e[1]] = append(parents[e[1]], e[0])
+	}
+
+	var panels []string
+	keep := make(map[string]bool)
+	for nid, n := range sg.nodes {
+		if n.Kind == KindPanel {
+			panels = append(panels, nid)
+			keep[nid] = true
+		}
+	}
+	for stack := append([]string{}, panels...); len(stack) > 0; {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, p := range parents[n] {
+			if !keep[p] {
+				keep[p] = true
+				stack = append(stack, p)
+			}
+		}
+	}
+
+	result := newSubgraph()
+	result.addNode(sg.nodes[id])
+	for e := range sg.edges {
+		if keep[e[0]] && keep[e[1]] {
+			result.addNode(sg.nodes[e[0]])
+			result.addNode(sg.nodes[e[1]])
+			result.addEdge(e[0], e[1])
+		}
+	}
+
+	if len(panels) > 0 {
+		es, err := r.edges(panels, upstream)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range es {
+			if e.typ == edgeContain {
+				result.addEdge(e.up, e.down)
+			}
+		}
+	}
+
+	if err := r.fill(result); err != nil {
+		return nil, err
+	}
+	return result.graph(), nil
+}
+
+// fill 查询子图中尚未取到属性的节点
+func (r *graphReader) fill(sg *subgraph) error {
+	missing := make(map[string]struct{})
+	for e := range sg.edges {
+		for _, id := range e {
+			if _, ok := sg.nodes[id]; !ok {
+				missing[id] = struct{}{}
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(missing))
+	for id := range missing {
+		ids = append(ids, id)
+	}
+	ns, err := r.nodes(ids)
+	if err != nil {
+		return err
+	}
+	for _, n := range ns {
+		sg.addNode(n)
+	}
+	return nil
+}
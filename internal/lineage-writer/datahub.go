@@ -0,0 +1,345 @@
+package writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	metadataFormatDataHub = "datahub" // DataHub MCP，可被 DataHub file source 直接摄取
+	metadataFormatAtlas   = "atlas"   // Purview / Atlas 的 entity bulk JSON
+)
+
+type metadataExportConfig struct {
+	Path     string `mapstructure:"path"`
+	Env      string `mapstructure:"env"`      // DataHub FabricType，默认 PROD
+	Platform string `mapstructure:"platform"` // DataHub dataPlatform，默认按数据源类型推断
+	Actor    string `mapstructure:"actor"`    // auditStamp 中的操作人
+
+	TableType   string `mapstructure:"table_type"`   // Atlas 表实体类型，默认 DataSet
+	ProcessType string `mapstructure:"process_type"` // Atlas 加工过程实体类型，默认 Process
+}
+
+// MetadataExportWriter 在内存中累积血缘图，Close 时导出为 DataHub MCP 或 Purview/Atlas entity JSON，
+// 注册为 datahub 与 purview 两种后端
+type MetadataExportWriter struct {
+	*memGraph
+
+	format string
+	conf   metadataExportConfig
+}
+
+func init() {
+	Register("datahub", func() LineageWriter {
+		return &MetadataExportWriter{memGraph: newMemGraph(), format: metadataFormatDataHub}
+	})
+	Register("purview", func() LineageWriter {
+		return &MetadataExportWriter{memGraph: newMemGraph(), format: metadataFormatAtlas}
+	})
+}
+
+func (w *MetadataExportWriter) Init(ctx *WriterContext) error {
+	w.urn = ctx.urnBuilder()
+	if err := ctx.Decode(&w.conf); err != nil {
+		return err
+	}
+	if w.conf.Path == "" {
+		return fmt.Errorf("%s writer requires path", ctx.Type)
+	}
+
+	w.conf.Env = strings.ToUpper(lo.Ternary(w.conf.Env == "", "PROD", w.conf.Env))
+	w.conf.Actor = lo.Ternary(w.conf.Actor == "", "urn:li:corpuser:datahub", w.conf.Actor)
+	w.conf.TableType = lo.Ternary(w.conf.TableType == "", "DataSet", w.conf.TableType)
+	w.conf.ProcessType = lo.Ternary(w.conf.ProcessType == "", "Process", w.conf.ProcessType)
+
+	return nil
+}
+
+func (w *MetadataExportWriter) Close() error {
+	nodes, edges := w.snapshot()
+
+	var doc any
+	switch w.format {
+	case metadataFormatDataHub:
+		doc = w.dataHubMCPs(nodes, edges, time.Now().UnixMilli())
+	case metadataFormatAtlas:
+		doc = w.atlasEntities(nodes, edges)
+	default:
+		return fmt.Errorf("unknown metadata export format: %q", w.format)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.conf.Path, data, 0o644)
+}
+
+// DataHub Metadata Change Proposal，aspect 以 {"json": ...} 包裹，与 DataHub file sink 的输出一致
+type dhMCP struct {
+	EntityType string       `json:"entityType"`
+	EntityURN  string       `json:"entityUrn"`
+	ChangeType string       `json:"changeType"`
+	AspectName string       `json:"aspectName"`
+	Aspect     dhJSONAspect `json:"aspect"`
+}
+
+type dhJSONAspect struct {
+	JSON any `json:"json"`
+}
+
+type dhAuditStamp struct {
+	Time  int64  `json:"time"`
+	Actor string `json:"actor"`
+}
+
+type dhEdge struct {
+	DestinationURN string `json:"destinationUrn"`
+}
+
+func newMCP(entityType, urn, aspectName string, aspect any) dhMCP {
+	return dhMCP{
+		EntityType: entityType,
+		EntityURN:  urn,
+		ChangeType: "UPSERT",
+		AspectName: aspectName,
+		Aspect:     dhJSONAspect{JSON: aspect},
+	}
+}
+
+// DataHub URN 中 , ( ) 为保留字符，按 DataHub 的约定做百分号编码
+var dhURNEscaper = strings.NewReplacer(",", "%2C", "(", "%28", ")", "%29")
+
+func (w *MetadataExportWriter) datasetURN(n *memNode) string {
+	platform := w.conf.Platform
+	if platform == "" {
+		platform = lo.Ternary(n.Service == "postgresql" || n.Service == "", "postgres", n.Service)
+	}
+
+	// zone.label.schema.table
+	name := n.ID
+	if n.Name != "" {
+		name = strings.Join([]string{n.Zone, n.Domain, n.Name}, ".")
+	}
+	return fmt.Sprintf("urn:li:dataset:(urn:li:dataPlatform:%s,%s,%s)", platform, dhURNEscaper.Replace(name), w.conf.Env)
+}
+
+func dashboardURN(n *memNode) string {
+	uid, _ := n.Attributes["dashboard_uid"].(string)
+	return fmt.Sprintf("urn:li:dashboard:(grafana,%s)", dhURNEscaper.Replace(n.Domain+"."+uid))
+}
+
+func chartURN(n *memNode) string {
+	uid, _ := n.Attributes["dashboard_uid"].(string)
+	return fmt.Sprintf("urn:li:chart:(grafana,%s)", dhURNEscaper.Replace(n.Domain+"."+uid+"."+n.Name))
+}
+
+func (w *MetadataExportWriter) dataHubMCPs(nodes []*memNode, edges []*memEdge, now int64) []dhMCP {
+	stamp := dhAuditStamp{Time: now, Actor: w.conf.Actor}
+	lastModified := map[string]any{"created": stamp, "lastModified": stamp}
+
+	byID := lo.KeyBy(nodes, func(n *memNode) string { return n.ID })
+	urnOf := func(n *memNode) string {
+		switch n.Kind {
+		case memNodeDashboard:
+			return dashboardURN(n)
+		case memNodePanel:
+			return chartURN(n)
+		}
+		return w.datasetURN(n)
+	}
+
+	upstreams := make(map[string][]string) // 下游 ID -> 上游 URN
+	for _, e := range edges {
+		if e.Kind != memEdgeData {
+			continue
+		}
+		if u := urnOf(byID[e.Up]); !lo.Contains(upstreams[e.Down], u) {
+			upstreams[e.Down] = append(upstreams[e.Down], u)
+		}
+	}
+
+	var mcps []dhMCP
+	for _, n := range nodes {
+		urn := urnOf(n)
+		description, _ := n.Attributes["description"].(string)
+
+		switch n.Kind {
+		case memNodeTable:
+			mcps = append(mcps, newMCP("dataset", urn, "datasetProperties", map[string]any{
+				"name":             n.Name,
+				"description":      description,
+				"customProperties": stringAttributes(n.Attributes, "description"),
+			}))
+
+			if calls := toInt64(n.Attributes["calls"]); calls > 0 {
+				mcps = append(mcps, newMCP("dataset", urn, "datasetUsageStatistics", map[string]any{
+					"timestampMillis":  now,
+					"eventGranularity": map[string]any{"unit": "DAY", "multiple": 1},
+					"totalSqlQueries":  calls,
+				}))
+			}
+
+			if ups := upstreams[n.ID]; len(ups) > 0 {
+				mcps = append(mcps, newMCP("dataset", urn, "upstreamLineage", map[string]any{
+					"upstreams": lo.Map(ups, func(u string, _ int) map[string]any {
+						return map[string]any{"dataset": u, "type": "TRANSFORMED", "auditStamp": stamp}
+					}),
+				}))
+			}
+
+		case memNodePanel:
+			mcps = append(mcps, newMCP("chart", urn, "chartInfo", map[string]any{
+				"title":            n.Name,
+				"description":      description,
+				"lastModified":     lastModified,
+				"customProperties": stringAttributes(n.Attributes, "description", "rawsql"),
+				"inputEdges":       lo.Map(upstreams[n.ID], func(u string, _ int) dhEdge { return dhEdge{DestinationURN: u} }),
+			}))
+
+		case memNodeDashboard:
+			var charts []dhEdge
+			for _, e := range edges {
+				if e.Up == n.ID && e.Kind == memEdgeContain {
+					charts = append(charts, dhEdge{DestinationURN: urnOf(byID[e.Down])})
+				}
+			}
+			mcps = append(mcps, newMCP("dashboard", urn, "dashboardInfo", map[string]any{
+				"title":            n.Name,
+				"description":      description,
+				"lastModified":     lastModified,
+				"customProperties": stringAttributes(n.Attributes, "description"),
+				"chartEdges":       charts,
+			}))
+		}
+	}
+
+	return mcps
+}
+
+// Atlas entity，ref 使用 uniqueAttributes 引用，导入顺序无关
+type atlasEntity struct {
+	TypeName         string            `json:"typeName"`
+	GUID             string            `json:"guid"`
+	Attributes       map[string]any    `json:"attributes"`
+	CustomAttributes map[string]string `json:"customAttributes,omitempty"`
+}
+
+type atlasObjectID struct {
+	TypeName         string            `json:"typeName"`
+	UniqueAttributes map[string]string `json:"uniqueAttributes"`
+}
+
+// 表的 qualifiedName，例如 postgresql://zone/label/dbname/schema.table
+func atlasQualifiedName(n *memNode) string {
+	if n.Name == "" {
+		return n.ID
+	}
+	dbname, _ := n.Attributes["dbname"].(string)
+	return fmt.Sprintf("%s://%s/%s/%s/%s", n.Service, n.Zone, n.Domain, dbname, n.Name)
+}
+
+// atlasEntities 表导出为 DataSet，表间血缘按函数聚合为 Process，
+// Grafana 看板与面板在 Atlas 中没有通用类型，不导出
+func (w *MetadataExportWriter) atlasEntities(nodes []*memNode, edges []*memEdge) map[string]any {
+	byID := lo.KeyBy(nodes, func(n *memNode) string { return n.ID })
+	ref := func(n *memNode) atlasObjectID {
+		return atlasObjectID{TypeName: w.conf.TableType, UniqueAttributes: map[string]string{"qualifiedName": atlasQualifiedName(n)}}
+	}
+
+	var entities []atlasEntity
+	for _, n := range nodes {
+		if n.Kind != memNodeTable {
+			continue
+		}
+		description, _ := n.Attributes["description"].(string)
+		entities = append(entities, atlasEntity{
+			TypeName: w.conf.TableType,
+			GUID:     fmt.Sprintf("-%d", len(entities)+1),
+			Attributes: map[string]any{
+				"qualifiedName": atlasQualifiedName(n),
+				"name":          n.Name,
+				"description":   description,
+			},
+			CustomAttributes: stringAttributes(n.Attributes, "description"),
+		})
+	}
+
+	type process struct {
+		name, qualifiedName string
+		inputs, outputs     []*memNode
+		calls               int64
+	}
+	processes := make(map[string]*process)
+	for _, e := range edges {
+		up, down := byID[e.Up], byID[e.Down]
+		if e.Kind != memEdgeData || up.Kind != memNodeTable || down.Kind != memNodeTable {
+			continue
+		}
+
+		// 同一函数的所有边合并为一个 Process，没有函数名的查询血缘按边单独建 Process
+		name := strings.Trim(fmt.Sprintf("%v.%v", e.Attributes["schemaname"], e.Attributes["procname"]), ".")
+		qn := fmt.Sprintf("%s://%s/%s/%v/%s", down.Service, down.Zone, down.Domain, down.Attributes["dbname"], name)
+		if e.Attributes["procname"] == nil || e.Attributes["procname"] == "" {
+			name = up.Name + " -> " + down.Name
+			qn = atlasQualifiedName(up) + "->" + atlasQualifiedName(down)
+		}
+
+		p, ok := processes[qn]
+		if !ok {
+			p = &process{name: name, qualifiedName: qn}
+			processes[qn] = p
+		}
+		if !lo.Contains(p.inputs, up) {
+			p.inputs = append(p.inputs, up)
+		}
+		if !lo.Contains(p.outputs, down) {
+			p.outputs = append(p.outputs, down)
+		}
+		p.calls = max(p.calls, toInt64(e.Attributes["calls"]))
+	}
+
+	keys := lo.Keys(processes)
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := processes[k]
+		entities = append(entities, atlasEntity{
+			TypeName: w.conf.ProcessType,
+			GUID:     fmt.Sprintf("-%d", len(entities)+1),
+			Attributes: map[string]any{
+				"qualifiedName": p.qualifiedName,
+				"name":          p.name,
+				"inputs":        lo.Map(p.inputs, func(n *memNode, _ int) atlasObjectID { return ref(n) }),
+				"outputs":       lo.Map(p.outputs, func(n *memNode, _ int) atlasObjectID { return ref(n) }),
+			},
+			CustomAttributes: map[string]string{"calls": fmt.Sprint(p.calls)},
+		})
+	}
+
+	return map[string]any{"entities": entities}
+}
+
+// stringAttributes 将节点属性转换为 DataHub customProperties / Atlas customAttributes 要求的字符串键值
+func stringAttributes(attrs map[string]any, exclude ...string) map[string]string {
+	out := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		if lo.Contains(exclude, k) || v == nil {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			out[k] = v
+		case []string:
+			out[k] = strings.Join(lo.Compact(v), ",")
+		default:
+			out[k] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package writer
+
+import (
+	"pg_lineage/pkg/log"
+)
+
+// DryRunWriterType 全局 -dry-run 时代替所有已配置的 writer
+const DryRunWriterType = "dryrun"
+
+// DryRunWriter 只在内存中累积血缘图，不写任何存储，Close 时在日志中输出汇总，
+// 点和边的明细在 debug 级别输出
+type DryRunWriter struct {
+	*memGraph
+}
+
+func init() {
+	Register(DryRunWriterType, func() LineageWriter { return &DryRunWriter{memGraph: newMemGraph()} })
+}
+
+func (w *DryRunWriter) Init(ctx *WriterContext) error {
+	w.urn = ctx.urnBuilder()
+	return nil
+}
+
+func (w *DryRunWriter) ResetGraph() error {
+	log.Infof("[dry-run] skip ResetGraph")
+	return nil
+}
+
+func (w *DryRunWriter) Close() error {
+	nodes, edges := w.snapshot()
+	for _, n := range nodes {
+		log.Debugf("[dry-run] node %s (%s) %v", n.ID, n.Kind, n.Attributes)
+	}
+	for _, e := range edges {
+		log.Debugf("[dry-run] edge %s -> %s (%s) %v", e.Up, e.Down, e.Kind, e.Attributes)
+	}
+	log.Infof("[dry-run] %d nodes, %d edges would be written", len(nodes), len(edges))
+	return nil
+}
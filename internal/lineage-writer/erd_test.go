@@ -0,0 +1,67 @@
+package writer
+
+import (
+	"testing"
+
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+)
+
+var erdTestSource = config.PostgresService{Label: "dw", Zone: "z", DBName: "dwdb", Type: service.DBTypePostgres}
+
+// erdTestJoin dw.orders.customer_id = dw.customers.id，两端的表由 erd 构造，不带 relpersistence、calls
+func erdTestJoin() *service.Join {
+	return &service.Join{
+		Database:   "dw",
+		From:       &service.Table{Database: "dw", SchemaName: "dw", RelName: "orders"},
+		To:         &service.Table{Database: "dw", SchemaName: "dw", RelName: "customers"},
+		FromColumn: "customer_id",
+		ToColumn:   "id",
+		Type:       "JOIN_INNER",
+		Calls:      2,
+	}
+}
+
+func TestJoinEdgeKeepsTableNodes(t *testing.T) {
+	w := newSQLiteWriter(t)
+
+	orders := &service.Table{Database: "dw", SchemaName: "dw", RelName: "orders", RelPersistence: service.REL_PERSIST, Calls: 3}
+	if err := w.WriteTableNode(orders, erdTestSource); err != nil {
+		t.Fatalf("WriteTableNode: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.WriteJoinEdge(erdTestJoin(), erdTestSource); err != nil {
+			t.Fatalf("WriteJoinEdge: %v", err)
+		}
+	}
+
+	if attr := sqliteNodeAttribute(t, w, erdTestSource, "dw.orders"); attr["relpersistence"] != service.REL_PERSIST || attr["calls"] != 3.0 {
+		t.Errorf("dw.orders = %v, want relpersistence and calls from the lineage write", attr)
+	}
+	if attr := sqliteNodeAttribute(t, w, erdTestSource, "dw.customers"); attr["calls"] != 0.0 {
+		t.Errorf("dw.customers = %v, want calls 0", attr)
+	}
+
+	var calls float64
+	if err := w.db.QueryRow(`SELECT json_extract(attribute, '$.calls') FROM data_lineage_relationship WHERE type = 'join'`).Scan(&calls); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Errorf("join calls = %v, want 4", calls)
+	}
+}
+
+func TestMemGraphJoinEdgeKeepsTableNodes(t *testing.T) {
+	g := newMemGraph()
+	orders := &service.Table{Database: "dw", SchemaName: "dw", RelName: "orders", RelPersistence: service.REL_PERSIST, Calls: 3}
+	g.WriteTableNode(orders, erdTestSource)
+	g.WriteJoinEdge(erdTestJoin(), erdTestSource)
+
+	n := g.nodes[g.urn.Table(erdTestSource, "dw", "dw.orders")]
+	if n.Attributes["relpersistence"] != service.REL_PERSIST || n.Attributes["calls"] != int64(3) {
+		t.Errorf("dw.orders = %v, want relpersistence and calls from the lineage write", n.Attributes)
+	}
+	if n := g.nodes[g.urn.Table(erdTestSource, "dw", "dw.customers")]; n == nil || n.Attributes["calls"] != int64(0) {
+		t.Errorf("dw.customers = %+v, want a node with calls 0", n)
+	}
+}
@@ -0,0 +1,327 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pg_lineage/pkg/depgraph"
+
+	"github.com/samber/lo"
+)
+
+const (
+	graphFormatGraphML = "graphml"
+	graphFormatDOT     = "dot"
+	graphFormatJSON    = "json"
+	graphFormatCSV     = "csv"
+
+	// 与 docs/lineage-graph.schema.json 保持一致
+	graphJSONVersion = 1
+)
+
+type graphFileConfig struct {
+	Path string `mapstructure:"path"` // csv 格式为输出目录，其余为文件路径
+}
+
+// GraphFileWriter 在内存中累积血缘图，Close 时写成文件，不依赖任何数据库，
+// 适用于 CI、离线分析和对外提供快照
+type GraphFileWriter struct {
+	*memGraph
+
+	format string
+	conf   graphFileConfig
+}
+
+func init() {
+	for _, format := range []string{graphFormatGraphML, graphFormatDOT, graphFormatJSON, graphFormatCSV} {
+		format := format
+		Register(format, func() LineageWriter {
+			return &GraphFileWriter{memGraph: newMemGraph(), format: format}
+		})
+	}
+}
+
+func (w *GraphFileWriter) Init(ctx *WriterContext) error {
+	w.urn = ctx.urnBuilder()
+	if err := ctx.Decode(&w.conf); err != nil {
+		return err
+	}
+	if w.conf.Path == "" {
+		return fmt.Errorf("%s writer requires path", ctx.Type)
+	}
+	return nil
+}
+
+func (w *GraphFileWriter) Close() error {
+	nodes, edges := w.snapshot()
+
+	if w.format == graphFormatCSV {
+		return writeNeo4jCSV(w.conf.Path, nodes, edges)
+	}
+
+	f, err := os.Create(w.conf.Path)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(f)
+
+	switch w.format {
+	case graphFormatGraphML:
+		err = writeGraphML(buf, nodes, edges)
+	case graphFormatDOT:
+		err = writeDOT(buf, nodes, edges)
+	case graphFormatJSON:
+		err = writeGraphJSON(buf, nodes, edges)
+	default:
+		err = fmt.Errorf("unknown graph file format: %q", w.format)
+	}
+
+	return errors.Join(err, buf.Flush(), f.Close())
+}
+
+// attrColumn 节点或边上出现过的属性及其类型，类型按所有取值推断
+type attrColumn struct {
+	name string
+	typ  string // long | string | string[]
+}
+
+func attrColumns[T any](items []T, attrs func(T) map[string]any) []attrColumn {
+	types := make(map[string]string)
+	for _, item := range items {
+		for k, v := range attrs(item) {
+			typ := "string"
+			switch v.(type) {
+			case int, int64:
+				typ = "long"
+			case float64:
+				typ = "double"
+			case []string:
+				typ = "string[]"
+			}
+			if old, ok := types[k]; ok && old != typ {
+				typ = "string"
+			}
+			types[k] = typ
+		}
+	}
+
+	cols := make([]attrColumn, 0, len(types))
+	for k, typ := range types {
+		cols = append(cols, attrColumn{name: k, typ: typ})
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].name < cols[j].name })
+	return cols
+}
+
+func nodeAttrs(n *memNode) map[string]any { return n.Attributes }
+func edgeAttrs(e *memEdge) map[string]any { return e.Attributes }
+
+// formatAttr 数组按 sep 拼接，其余按 fmt.Sprint 输出
+func formatAttr(v any, sep string) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, sep)
+	}
+	return fmt.Sprint(v)
+}
+
+// 与 Neo4j writer 保持一致：表间、表到面板为 downstream，看板到面板为 contain，ERD 中表间的关联为 join
+func relationshipType(e *memEdge) string {
+	switch e.Kind {
+	case memEdgeContain:
+		return "contain"
+	case memEdgeJoin:
+		return "join"
+	}
+	return "downstream"
+}
+
+func writeGraphML(out io.Writer, nodes []*memNode, edges []*memEdge) error {
+	nodeCols := attrColumns(nodes, nodeAttrs)
+	edgeCols := attrColumns(edges, edgeAttrs)
+
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	graphMLType := func(typ string) string {
+		return lo.Ternary(typ == "long" || typ == "double", typ, "string")
+	}
+
+	fmt.Fprintln(out, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(out, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd">`)
+
+	// 固定属性
+	for _, k := range []string{"kind", "service", "zone", "domain", "name"} {
+		fmt.Fprintf(out, "  <key id=\"n_%s\" for=\"node\" attr.name=\"%s\" attr.type=\"string\"/>\n", k, k)
+	}
+	fmt.Fprintln(out, `  <key id="e_type" for="edge" attr.name="type" attr.type="string"/>`)
+	for _, c := range nodeCols {
+		fmt.Fprintf(out, "  <key id=\"n_a_%s\" for=\"node\" attr.name=\"%s\" attr.type=\"%s\"/>\n", esc(c.name), esc(c.name), graphMLType(c.typ))
+	}
+	for _, c := range edgeCols {
+		fmt.Fprintf(out, "  <key id=\"e_a_%s\" for=\"edge\" attr.name=\"%s\" attr.type=\"%s\"/>\n", esc(c.name), esc(c.name), graphMLType(c.typ))
+	}
+
+	fmt.Fprintln(out, `  <graph id="lineage" edgedefault="directed">`)
+	for _, n := range nodes {
+		fmt.Fprintf(out, "    <node id=\"%s\">\n", esc(n.ID))
+		for _, kv := range [][2]string{{"kind", n.Kind}, {"service", n.Service}, {"zone", n.Zone}, {"domain", n.Domain}, {"name", n.Name}} {
+			fmt.Fprintf(out, "      <data key=\"n_%s\">%s</data>\n", kv[0], esc(kv[1]))
+		}
+		for _, c := range nodeCols {
+			if v, ok := n.Attributes[c.name]; ok {
+				fmt.Fprintf(out, "      <data key=\"n_a_%s\">%s</data>\n", esc(c.name), esc(formatAttr(v, ",")))
+			}
+		}
+		fmt.Fprintln(out, "    </node>")
+	}
+	for i, e := range edges {
+		fmt.Fprintf(out, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, esc(e.Up), esc(e.Down))
+		fmt.Fprintf(out, "      <data key=\"e_type\">%s</data>\n", relationshipType(e))
+		for _, c := range edgeCols {
+			if v, ok := e.Attributes[c.name]; ok {
+				fmt.Fprintf(out, "      <data key=\"e_a_%s\">%s</data>\n", esc(c.name), esc(formatAttr(v, ",")))
+			}
+		}
+		fmt.Fprintln(out, "    </edge>")
+	}
+	fmt.Fprintln(out, "  </graph>")
+	_, err := fmt.Fprintln(out, "</graphml>")
+	return err
+}
+
+// writeDOT 按数据源 / Grafana host 分 cluster，表为 box，看板为 folder，面板为 note，文件为 tab，外部系统为 component，
+// 其余为 ellipse
+func writeDOT(out io.Writer, nodes []*memNode, edges []*memEdge) error {
+	shapes := map[string]string{
+		memNodeTable: "box", memNodeDashboard: "folder", memNodePanel: "note",
+		string(depgraph.KindFile): "tab", string(depgraph.KindExternal): "component",
+	}
+
+	fmt.Fprintln(out, "digraph lineage {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	fmt.Fprintln(out, `  node [fontname="Helvetica", fontsize=10];`)
+
+	clusters := lo.GroupBy(nodes, func(n *memNode) string { return n.Zone + "/" + n.Domain })
+	keys := lo.Keys(clusters)
+	sort.Strings(keys)
+	for i, k := range keys {
+		fmt.Fprintf(out, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(out, "    label=%s;\n", strconv.Quote(strings.Trim(k, "/")))
+		for _, n := range clusters[k] {
+			label := lo.Ternary(n.Name == "", n.ID, n.Name)
+			shape := lo.Ternary(shapes[n.Kind] == "", "ellipse", shapes[n.Kind])
+			fmt.Fprintf(out, "    %s [label=%s, shape=%s];\n", strconv.Quote(n.ID), strconv.Quote(label), shape)
+		}
+		fmt.Fprintln(out, "  }")
+	}
+
+	for _, e := range edges {
+		attrs := []string{}
+		if proc, _ := e.Attributes["procname"].(string); proc != "" {
+			attrs = append(attrs, "label="+strconv.Quote(proc))
+		}
+		switch e.Kind {
+		case memEdgeContain:
+			attrs = append(attrs, "style=dashed")
+		case memEdgeJoin:
+			// 关联不是数据流向，不画箭头
+			attrs = append(attrs, "label="+strconv.Quote(fmt.Sprintf("%v = %v", e.Attributes["from_column"], e.Attributes["to_column"])), "style=dotted", "dir=none")
+		}
+		fmt.Fprintf(out, "  %s -> %s", strconv.Quote(e.Up), strconv.Quote(e.Down))
+		if len(attrs) > 0 {
+			fmt.Fprintf(out, " [%s]", strings.Join(attrs, ", "))
+		}
+		fmt.Fprintln(out, ";")
+	}
+
+	_, err := fmt.Fprintln(out, "}")
+	return err
+}
+
+// graphJSON 导出格式，字段说明见 docs/lineage-graph.schema.json
+type graphJSON struct {
+	Version     int        `json:"version"`
+	GeneratedAt string     `json:"generated_at"`
+	Nodes       []*memNode `json:"nodes"`
+	Edges       []*memEdge `json:"edges"`
+}
+
+func writeGraphJSON(out io.Writer, nodes []*memNode, edges []*memEdge) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(graphJSON{
+		Version:     graphJSONVersion,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Nodes:       nodes,
+		Edges:       edges,
+	})
+}
+
+// writeNeo4jCSV 在 dir 下生成 nodes.csv、relationships.csv，表头遵循 neo4j-admin import 的约定
+// (id:ID、:LABEL、:START_ID、:END_ID、:TYPE，数组以 ; 分隔)，LOAD CSV WITH HEADERS 也可直接读取
+func writeNeo4jCSV(dir string, nodes []*memNode, edges []*memEdge) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	nodeCols := attrColumns(nodes, nodeAttrs)
+	header := []string{"id:ID", ":LABEL", "kind", "service", "zone", "domain", "name"}
+	for _, c := range nodeCols {
+		header = append(header, c.name+":"+c.typ)
+	}
+	rows := [][]string{header}
+	for _, n := range nodes {
+		labels := lo.Compact([]string{"lineage", n.Service, n.Kind})
+		row := []string{n.ID, strings.Join(labels, ";"), n.Kind, n.Service, n.Zone, n.Domain, n.Name}
+		for _, c := range nodeCols {
+			row = append(row, formatAttr(n.Attributes[c.name], ";"))
+		}
+		rows = append(rows, row)
+	}
+	if err := writeCSVFile(filepath.Join(dir, "nodes.csv"), rows); err != nil {
+		return err
+	}
+
+	edgeCols := attrColumns(edges, edgeAttrs)
+	header = []string{":START_ID", ":END_ID", ":TYPE"}
+	for _, c := range edgeCols {
+		header = append(header, c.name+":"+c.typ)
+	}
+	rows = [][]string{header}
+	for _, e := range edges {
+		row := []string{e.Up, e.Down, relationshipType(e)}
+		for _, c := range edgeCols {
+			row = append(row, formatAttr(e.Attributes[c.name], ";"))
+		}
+		rows = append(rows, row)
+	}
+	return writeCSVFile(filepath.Join(dir, "relationships.csv"), rows)
+}
+
+func writeCSVFile(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	cw.WriteAll(rows)
+	return errors.Join(cw.Error(), f.Close())
+}
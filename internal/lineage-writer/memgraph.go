@@ -0,0 +1,394 @@
+package writer
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+
+	"github.com/samber/lo"
+)
+
+const (
+	memNodeTable     = "table"
+	memNodeDashboard = "dashboard"
+	memNodePanel     = "panel"
+
+	memEdgeData    = "data_logic"
+	memEdgeContain = "contain"
+	memEdgeJoin    = "join"
+)
+
+// memNode 内存中累积的节点，ID 与 PGLineageWriter 的 node_name 一致
+type memNode struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind"`    // table | dashboard | panel，其他节点为 depgraph.NodeKind
+	Service    string         `json:"service"` // postgresql | greenplum | grafana
+	Zone       string         `json:"zone"`
+	Domain     string         `json:"domain"` // 数据源 label 或 Grafana host
+	Name       string         `json:"name"`   // schema.table、看板标题或面板标题
+	Attributes map[string]any `json:"attributes"`
+}
+
+// memEdge 内存中累积的边，同一对节点间不同函数、不同字段的关联产生的边分别保存
+type memEdge struct {
+	Up         string         `json:"up"`
+	Down       string         `json:"down"`
+	Kind       string         `json:"kind"` // data_logic | contain | join
+	Attributes map[string]any `json:"attributes"`
+}
+
+func (e *memEdge) key() string {
+	proc, _ := e.Attributes["procname"].(string)
+	schema, _ := e.Attributes["schemaname"].(string)
+	key := []string{e.Up, e.Down, e.Kind, schema, proc}
+	if e.Kind == memEdgeJoin {
+		from, _ := e.Attributes["from_column"].(string)
+		to, _ := e.Attributes["to_column"].(string)
+		typ, _ := e.Attributes["join_type"].(string)
+		key = append(key, from, to, typ)
+	}
+	return strings.Join(key, "\x00")
+}
+
+// memGraph 在内存中累积整张血缘图，供需要在 Close 时一次性导出的 writer 复用，
+// upsert 语义与 PGLineageWriter 一致：calls 累加，统计信息以最新为准
+type memGraph struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+	edges map[string]*memEdge
+	urn   *URNBuilder
+}
+
+func newMemGraph() *memGraph {
+	return &memGraph{
+		nodes: make(map[string]*memNode),
+		edges: make(map[string]*memEdge),
+		urn:   defaultURNBuilder(),
+	}
+}
+
+func (g *memGraph) ResetGraph() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nodes = make(map[string]*memNode)
+	g.edges = make(map[string]*memEdge)
+	return nil
+}
+
+// upsertNode 合并属性，已存在的节点只覆盖传入的键
+func (g *memGraph) upsertNode(n *memNode) *memNode {
+	old, ok := g.nodes[n.ID]
+	if !ok {
+		g.nodes[n.ID] = n
+		return n
+	}
+	for k, v := range n.Attributes {
+		old.Attributes[k] = v
+	}
+	return old
+}
+
+func (g *memGraph) upsertEdge(e *memEdge) *memEdge {
+	old, ok := g.edges[e.key()]
+	if !ok {
+		g.edges[e.key()] = e
+		return e
+	}
+	for k, v := range e.Attributes {
+		old.Attributes[k] = v
+	}
+	return old
+}
+
+func (g *memGraph) tableNode(t *service.Table, s config.PostgresService) *memNode {
+	return &memNode{
+		ID:      g.urn.Table(s, t.Database, t.GetID()),
+		Kind:    memNodeTable,
+		Service: s.Type,
+		Zone:    s.Zone,
+		Domain:  t.Database,
+		Name:    t.GetID(),
+		Attributes: map[string]any{
+			"database":  t.Database,
+			"dbname":    s.DBName,
+			"schema":    t.SchemaName,
+			"tablename": t.RelName,
+		},
+	}
+}
+
+func (g *memGraph) WriteTableNode(t *service.Table, s config.PostgresService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.tableNode(t, s)
+	calls := t.Calls
+	if old, ok := g.nodes[n.ID]; ok {
+		calls += toInt64(old.Attributes["calls"])
+	}
+	n.Attributes["relpersistence"] = t.RelPersistence
+	n.Attributes["calls"] = calls
+	g.upsertNode(n)
+	return nil
+}
+
+func (g *memGraph) CompleteTableNode(t *service.Table, s config.PostgresService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.tableNode(t, s)
+	n.Attributes["seq_scan"] = t.SeqScan
+	n.Attributes["seq_tup_read"] = t.SeqTupRead
+	n.Attributes["idx_scan"] = t.IdxScan
+	n.Attributes["idx_tup_fetch"] = t.IdxTupFetch
+	n.Attributes["description"] = strings.TrimPrefix(t.Comment, "0x")
+	if _, ok := g.nodes[n.ID]; !ok {
+		n.Attributes["calls"] = t.Calls
+	}
+	g.upsertNode(n)
+	return nil
+}
+
+// WriteNode 属性原样保存，重复写入时覆盖同名属性
+func (g *memGraph) WriteNode(n depgraph.Node, database string, s config.PostgresService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.upsertNode(&memNode{
+		ID:         g.urn.Node(s, database, n, n.GetID()),
+		Kind:       string(n.GetKind()),
+		Service:    s.Type,
+		Zone:       s.Zone,
+		Domain:     database,
+		Name:       n.GetID(),
+		Attributes: lo.Assign(map[string]any{}, n.GetAttributes()),
+	})
+	return nil
+}
+
+func (g *memGraph) WriteFuncEdge(edge *depgraph.Edge, from, to depgraph.Node, r *service.Udf, s config.PostgresService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e := &memEdge{
+		Up:   g.urn.Node(s, r.Database, from, edge.From),
+		Down: g.urn.Node(s, r.Database, to, edge.To),
+		Kind: memEdgeData,
+		Attributes: map[string]any{
+			"database":   r.Database,
+			"schemaname": r.SchemaName,
+			"procname":   r.ProcName,
+		},
+	}
+	// mean_time 按调用次数加权合并
+	calls, total := r.Calls, r.MeanTime*float64(r.Calls)
+	if old, ok := g.edges[e.key()]; ok {
+		oldCalls := toInt64(old.Attributes["calls"])
+		calls += oldCalls
+		total += toFloat64(old.Attributes["mean_time"]) * float64(oldCalls)
+	}
+	e.Attributes["calls"] = calls
+	e.Attributes["mean_time"] = r.MeanTime
+	if calls > 0 {
+		e.Attributes["mean_time"] = total / float64(calls)
+	}
+	g.upsertEdge(e)
+	return nil
+}
+
+// WriteJoinEdge 表间的关联，calls 累加；两端的表不存在时先创建，已存在的不修改
+func (g *memGraph) WriteJoinEdge(j *service.Join, s config.PostgresService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, t := range []*service.Table{j.From, j.To} {
+		n := g.tableNode(t, s)
+		if _, ok := g.nodes[n.ID]; !ok {
+			n.Attributes["relpersistence"] = t.RelPersistence
+			n.Attributes["calls"] = int64(0)
+			g.nodes[n.ID] = n
+		}
+	}
+
+	e := &memEdge{
+		Up:         g.urn.Table(s, j.Database, j.From.GetID()),
+		Down:       g.urn.Table(s, j.Database, j.To.GetID()),
+		Kind:       memEdgeJoin,
+		Attributes: j.GetAttributes(),
+	}
+	calls := j.Calls
+	if old, ok := g.edges[e.key()]; ok {
+		calls += toInt64(old.Attributes["calls"])
+	}
+	e.Attributes["calls"] = calls
+	g.upsertEdge(e)
+	return nil
+}
+
+func (g *memGraph) WriteDashboardNode(d *service.DashboardFullWithMeta, s config.GrafanaService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.upsertNode(&memNode{
+		ID:      g.urn.Dashboard(d, s),
+		Kind:    memNodeDashboard,
+		Service: "grafana",
+		Zone:    s.Zone,
+		Domain:  s.Host,
+		Name:    d.Dashboard.Title,
+		Attributes: map[string]any{
+			"created":         d.Meta.Created.String(),
+			"updated":         d.Meta.Updated.String(),
+			"created_by":      d.Meta.CreatedBy,
+			"updated_by":      d.Meta.UpdatedBy,
+			"dashboard_title": d.Dashboard.Title,
+			"dashboard_uid":   d.Dashboard.UID,
+			"description":     d.Dashboard.Description,
+			"pic":             lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}),
+		},
+	})
+	return nil
+}
+
+func (g *memGraph) WritePanelNode(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var rawsql []string
+	for _, dep := range dependencies {
+		rawsql = append(rawsql, dep.RawSql)
+	}
+
+	g.upsertNode(&memNode{
+		ID:      g.urn.Panel(p, d, s),
+		Kind:    memNodePanel,
+		Service: "grafana",
+		Zone:    s.Zone,
+		Domain:  s.Host,
+		Name:    p.Title,
+		Attributes: map[string]any{
+			"created":         d.Meta.Created.String(),
+			"updated":         d.Meta.Updated.String(),
+			"created_by":      d.Meta.CreatedBy,
+			"updated_by":      d.Meta.UpdatedBy,
+			"panel_type":      p.Type,
+			"panel_title":     p.Title,
+			"dashboard_uid":   d.Dashboard.UID,
+			"dashboard_title": d.Dashboard.Title,
+			"description":     strings.TrimPrefix(p.Description, "0x"),
+			"pic":             lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}),
+			"rawsql":          rawsql,
+		},
+	})
+	return nil
+}
+
+func (g *memGraph) WriteDash2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.upsertEdge(&memEdge{
+		Up:         g.urn.Dashboard(d, s),
+		Down:       g.urn.Panel(p, d, s),
+		Kind:       memEdgeContain,
+		Attributes: map[string]any{},
+	})
+	return nil
+}
+
+func (g *memGraph) WriteTable2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, dep := range dependencies {
+		for _, t := range dep.Tables {
+			// Panel 依赖的表不一定出现在 UDF 血缘中，先补齐节点
+			g.upsertNode(g.tableNode(t, ds))
+			g.upsertEdge(&memEdge{
+				Up:         g.urn.Table(ds, t.Database, t.GetID()),
+				Down:       g.urn.Panel(p, d, s),
+				Kind:       memEdgeData,
+				Attributes: map[string]any{},
+			})
+		}
+	}
+	return nil
+}
+
+// snapshot 返回按 ID 排序的节点和边的副本，保证导出结果稳定
+// 边引用到但未单独写入的节点（如 Panel 依赖的表）会补齐为只有 ID 的节点
+func (g *memGraph) snapshot() ([]*memNode, []*memEdge) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	nodes := make(map[string]*memNode, len(g.nodes))
+	for id, n := range g.nodes {
+		nodes[id] = cloneNode(n)
+	}
+
+	edges := make([]*memEdge, 0, len(g.edges))
+	for _, e := range g.edges {
+		for _, id := range []string{e.Up, e.Down} {
+			if _, ok := nodes[id]; !ok {
+				nodes[id] = &memNode{ID: id, Kind: memNodeTable, Attributes: map[string]any{}}
+			}
+		}
+		edges = append(edges, &memEdge{Up: e.Up, Down: e.Down, Kind: e.Kind, Attributes: cloneAttributes(e.Attributes)})
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].key() < edges[j].key() })
+
+	sorted := lo.Values(nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	return sorted, edges
+}
+
+func cloneNode(n *memNode) *memNode {
+	c := *n
+	c.Attributes = cloneAttributes(n.Attributes)
+	return &c
+}
+
+func cloneAttributes(attrs map[string]any) map[string]any {
+	c := make(map[string]any, len(attrs))
+	for k, v := range attrs {
+		c[k] = v
+	}
+	return c
+}
+
+func toFloat64(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	}
+	return 0
+}
+
+func toInt64(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case json.Number:
+		i, _ := n.Int64()
+		return i
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package writer
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+// 表结构变更以 migrations/<dialect>/NNNN_说明.sql 的形式追加，版本号从 1 开始连续递增，
+// 已发布的文件不允许修改
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+var (
+	ErrSchemaOutdated = errors.New("lineage schema is outdated")
+	ErrSchemaTooNew   = errors.New("lineage schema is newer than this binary supports")
+)
+
+// SchemaMigrator 可选接口：自带表结构的 writer 实现，migrate 子命令用它代替 Init，
+// 在不检查版本的情况下将表结构升级到最新
+type SchemaMigrator interface {
+	Migrate(ctx *WriterContext) (from, to int, err error)
+}
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrationDialect 各数据库记录版本号的方式
+type migrationDialect struct {
+	dir                string
+	versionTable       string
+	versionTableExists string // 返回一行 bool
+	createVersionTable string
+	insertVersion      string // 参数：version, name
+	lock               string // 事务级锁，防止并发升级，可为空
+}
+
+var postgresMigrations = migrationDialect{
+	dir:                "migrations/postgres",
+	versionTable:       "manager.lineage_schema_version",
+	versionTableExists: `SELECT to_regclass('manager.lineage_schema_version') IS NOT NULL`,
+	createVersionTable: `
+		CREATE SCHEMA IF NOT EXISTS manager;
+		CREATE TABLE IF NOT EXISTS manager.lineage_schema_version (
+			version    integer PRIMARY KEY,
+			name       text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		);`,
+	insertVersion: `INSERT INTO manager.lineage_schema_version (version, name) VALUES ($1, $2)`,
+	lock:          `SELECT pg_advisory_xact_lock(hashtext('pg_lineage.migrate'))`,
+}
+
+var sqliteMigrations = migrationDialect{
+	dir:                "migrations/sqlite",
+	versionTable:       "lineage_schema_version",
+	versionTableExists: `SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'lineage_schema_version'`,
+	createVersionTable: `
+		CREATE TABLE IF NOT EXISTS lineage_schema_version (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+	insertVersion: `INSERT INTO lineage_schema_version (version, name) VALUES (?, ?)`,
+}
+
+func (d migrationDialect) migrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFS, d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms []migration
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		prefix, name, _ := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version prefix", e.Name())
+		}
+		data, err := migrationFS.ReadFile(path.Join(d.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, migration{version: version, name: name, sql: string(data)})
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].version < ms[j].version })
+	for i, m := range ms {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("%s: migration versions must be contiguous from 1, got %d at position %d", d.dir, m.version, i+1)
+		}
+	}
+	return ms, nil
+}
+
+// latestVersion 当前二进制内置的最新版本
+func (d migrationDialect) latestVersion() (int, error) {
+	ms, err := d.migrations()
+	if err != nil {
+		return 0, err
+	}
+	return len(ms), nil
+}
+
+// currentVersion 数据库中已应用的版本，未初始化时为 0
+func (d migrationDialect) currentVersion(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}) (int, error) {
+	var exists bool
+	if err := q.QueryRow(d.versionTableExists).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err := q.QueryRow(`SELECT coalesce(max(version), 0) FROM ` + d.versionTable).Scan(&version)
+	return version, err
+}
+
+// check 版本与内置版本不一致时拒绝写入
+func (d migrationDialect) check(db *sql.DB) error {
+	latest, err := d.latestVersion()
+	if err != nil {
+		return err
+	}
+	current, err := d.currentVersion(db)
+	if err != nil {
+		return fmt.Errorf("read lineage schema version: %w", err)
+	}
+
+	switch {
+	case current < latest:
+		return fmt.Errorf("%w: version %d, want %d, run `pg_lineage migrate` first", ErrSchemaOutdated, current, latest)
+	case current > latest:
+		return fmt.Errorf("%w: version %d, this binary supports up to %d", ErrSchemaTooNew, current, latest)
+	}
+	return nil
+}
+
+// migrate 依次应用未执行的版本，每个版本一个事务
+func (d migrationDialect) migrate(db *sql.DB) (from, to int, err error) {
+	ms, err := d.migrations()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := db.Exec(d.createVersionTable); err != nil {
+		return 0, 0, fmt.Errorf("create schema version table: %w", err)
+	}
+	if from, err = d.currentVersion(db); err != nil {
+		return 0, 0, err
+	}
+	if from > len(ms) {
+		return from, from, fmt.Errorf("%w: version %d, this binary supports up to %d", ErrSchemaTooNew, from, len(ms))
+	}
+
+	to = from
+	for _, m := range ms[from:] {
+		if err := d.apply(db, m); err != nil {
+			return from, to, fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+		log.Infof("Applied lineage schema migration %04d_%s", m.version, m.name)
+		to = m.version
+	}
+	return from, to, nil
+}
+
+func (d migrationDialect) apply(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		if d.lock != "" {
+			if _, err := tx.Exec(d.lock); err != nil {
+				return err
+			}
+		}
+		// 拿到锁后再确认一次，其他进程可能已经执行过
+		current, err := d.currentVersion(tx)
+		if err != nil || current >= m.version {
+			return err
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			return err
+		}
+		_, err = tx.Exec(d.insertVersion, m.version, m.name)
+		return err
+	}()
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+// Migrate 对所有启用且实现了 SchemaMigrator 的 writer 执行表结构升级
+func Migrate(cfg *config.StorageConfig) error {
+	var errs []error
+	for _, wc := range cfg.EnabledWriters() {
+		factory, err := lookup(wc.Type)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		m, ok := factory().(SchemaMigrator)
+		if !ok {
+			log.Infof("Lineage writer %s has no schema to migrate", wc.Type)
+			continue
+		}
+
+		from, to, err := m.Migrate(&WriterContext{Type: wc.Type, Settings: wc.Settings})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migrate %s writer: %w", wc.Type, err))
+			continue
+		}
+		log.Infof("Lineage writer %s schema version: %d -> %d", wc.Type, from, to)
+	}
+	return errors.Join(errs...)
+}
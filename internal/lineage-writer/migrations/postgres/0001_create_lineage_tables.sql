@@ -0,0 +1,99 @@
+-- 血缘点、边及 Grafana 查询分析表
+-- 已有部署中的同名表会被保留，只补齐 writer 依赖的列、唯一约束和索引
+
+CREATE SCHEMA IF NOT EXISTS manager;
+
+CREATE TABLE IF NOT EXISTS manager.data_lineage_node (
+    id        bigserial PRIMARY KEY,
+    node_name text NOT NULL,
+    site      text NOT NULL DEFAULT '',
+    service   text NOT NULL DEFAULT '',
+    domain    text NOT NULL DEFAULT '',
+    node      text NOT NULL DEFAULT '',
+    attribute jsonb NOT NULL DEFAULT '{}'::jsonb,
+    type      text NOT NULL DEFAULT '',
+    cdt       timestamptz NOT NULL DEFAULT now(),
+    udt       timestamptz NOT NULL DEFAULT now(),
+    author    text NOT NULL DEFAULT ''
+);
+-- 已有的表不会经过上面的 CREATE TABLE，补齐 writer 用到的列；已有行的 node_name 无法补出，不加 NOT NULL
+ALTER TABLE manager.data_lineage_node
+    ADD COLUMN IF NOT EXISTS node_name text,
+    ADD COLUMN IF NOT EXISTS site      text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS service   text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS domain    text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS node      text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS attribute jsonb NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN IF NOT EXISTS type      text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cdt       timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS udt       timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS author    text NOT NULL DEFAULT '';
+-- ON CONFLICT (node_name)
+CREATE UNIQUE INDEX IF NOT EXISTS data_lineage_node_node_name_key ON manager.data_lineage_node (node_name);
+CREATE INDEX IF NOT EXISTS data_lineage_node_service_type_idx ON manager.data_lineage_node (service, type);
+
+CREATE TABLE IF NOT EXISTS manager.data_lineage_relationship (
+    id             bigserial PRIMARY KEY,
+    name           text NOT NULL, -- md5(上游_下游_属性)
+    up_node_name   text NOT NULL,
+    down_node_name text NOT NULL,
+    type           text NOT NULL DEFAULT '',
+    attribute      jsonb NOT NULL DEFAULT '{}'::jsonb,
+    cdt            timestamptz NOT NULL DEFAULT now(),
+    udt            timestamptz NOT NULL DEFAULT now(),
+    author         text NOT NULL DEFAULT ''
+);
+ALTER TABLE manager.data_lineage_relationship
+    ADD COLUMN IF NOT EXISTS name           text,
+    ADD COLUMN IF NOT EXISTS up_node_name   text,
+    ADD COLUMN IF NOT EXISTS down_node_name text,
+    ADD COLUMN IF NOT EXISTS type           text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS attribute      jsonb NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN IF NOT EXISTS cdt            timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS udt            timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS author         text NOT NULL DEFAULT '';
+-- ON CONFLICT (name)
+CREATE UNIQUE INDEX IF NOT EXISTS data_lineage_relationship_name_key ON manager.data_lineage_relationship (name);
+CREATE INDEX IF NOT EXISTS data_lineage_relationship_up_idx ON manager.data_lineage_relationship (up_node_name);
+CREATE INDEX IF NOT EXISTS data_lineage_relationship_down_idx ON manager.data_lineage_relationship (down_node_name);
+
+CREATE TABLE IF NOT EXISTS manager.sql_analysis (
+    db_name      text NOT NULL,
+    sql_script   text NOT NULL,
+    sql_hash     text GENERATED ALWAYS AS (md5(sql_script)) STORED, -- sql_script 过长，不能直接放入主键
+    type         text NOT NULL DEFAULT '',
+    name         text NOT NULL,
+    datamap_type text NOT NULL DEFAULT '',
+    input_pic    text NOT NULL DEFAULT '',
+    cdt          timestamptz NOT NULL DEFAULT now(),
+    udt          timestamptz NOT NULL DEFAULT now(),
+    -- ON CONFLICT ON CONSTRAINT sql_analysis_pkey
+    CONSTRAINT sql_analysis_pkey PRIMARY KEY (db_name, name, sql_hash)
+);
+
+-- 已有的 sql_analysis 表同样补齐列，以及 sql_hash 列和 sql_analysis_pkey 约束
+ALTER TABLE manager.sql_analysis
+    ADD COLUMN IF NOT EXISTS type         text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS datamap_type text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS input_pic    text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cdt          timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS udt          timestamptz NOT NULL DEFAULT now();
+ALTER TABLE manager.sql_analysis ADD COLUMN IF NOT EXISTS sql_hash text GENERATED ALWAYS AS (md5(sql_script)) STORED;
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'manager.sql_analysis'::regclass AND conname = 'sql_analysis_pkey'
+    ) THEN
+        IF EXISTS (
+            SELECT 1 FROM pg_constraint
+            WHERE conrelid = 'manager.sql_analysis'::regclass AND contype = 'p'
+        ) THEN
+            -- 已有其他主键时以唯一约束代替，ON CONFLICT ON CONSTRAINT 同样适用
+            ALTER TABLE manager.sql_analysis ADD CONSTRAINT sql_analysis_pkey UNIQUE (db_name, name, sql_hash);
+        ELSE
+            ALTER TABLE manager.sql_analysis ADD CONSTRAINT sql_analysis_pkey PRIMARY KEY (db_name, name, sql_hash);
+        END IF;
+    END IF;
+END
+$$;
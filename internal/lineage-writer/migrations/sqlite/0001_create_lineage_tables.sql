@@ -0,0 +1,39 @@
+-- 与 PGLineageWriter 写入的 manager.* 表结构一致，attribute 以 JSON 文本保存
+CREATE TABLE IF NOT EXISTS data_lineage_node (
+    node_name TEXT PRIMARY KEY,
+    site      TEXT NOT NULL DEFAULT '',
+    service   TEXT NOT NULL DEFAULT '',
+    domain    TEXT NOT NULL DEFAULT '',
+    node      TEXT NOT NULL DEFAULT '',
+    attribute TEXT NOT NULL DEFAULT '{}',
+    type      TEXT NOT NULL DEFAULT '',
+    cdt       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    udt       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    author    TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS data_lineage_node_service_type_idx ON data_lineage_node (service, type);
+
+CREATE TABLE IF NOT EXISTS data_lineage_relationship (
+    name           TEXT PRIMARY KEY,
+    up_node_name   TEXT NOT NULL,
+    down_node_name TEXT NOT NULL,
+    type           TEXT NOT NULL DEFAULT '',
+    attribute      TEXT NOT NULL DEFAULT '{}',
+    cdt            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    udt            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    author         TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS data_lineage_relationship_up_idx ON data_lineage_relationship (up_node_name);
+CREATE INDEX IF NOT EXISTS data_lineage_relationship_down_idx ON data_lineage_relationship (down_node_name);
+
+CREATE TABLE IF NOT EXISTS sql_analysis (
+    db_name      TEXT NOT NULL,
+    sql_script   TEXT NOT NULL,
+    type         TEXT NOT NULL DEFAULT '',
+    name         TEXT NOT NULL,
+    datamap_type TEXT NOT NULL DEFAULT '',
+    input_pic    TEXT NOT NULL DEFAULT '',
+    cdt          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    udt          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (db_name, name, sql_script)
+);
@@ -1,141 +1,280 @@
 package writer
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
 	"pg_lineage/internal/service"
 	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
 	"pg_lineage/pkg/log"
 
-	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
+// 每批次写入的最大行数，超过后自动 flush
+const defaultNeo4jBatchSize = 1000
+
+// 批次连续失败的最大次数，超过后丢弃并在错误中报告，避免无法写入的批次在每次 flush 时重试
+const maxNeo4jBatchAttempts = 3
+
+// 约束与索引，在 Init 时幂等创建
+var neo4jSchemaStatements = []string{
+	"CREATE CONSTRAINT lineage_id_unique IF NOT EXISTS FOR (n:lineage) REQUIRE n.id IS UNIQUE",
+	"CREATE INDEX lineage_relname IF NOT EXISTS FOR (n:lineage) ON (n.relname)",
+	"CREATE INDEX lineage_downstream_id IF NOT EXISTS FOR ()-[e:downstream]-() ON (e.id)",
+	"CREATE INDEX lineage_join_id IF NOT EXISTS FOR ()-[e:join]-() ON (e.id)",
+}
+
+// neo4jBatch 同一条 UNWIND 语句下累积的参数行
+type neo4jBatch struct {
+	cypher   string
+	rows     []map[string]any
+	attempts int // 已失败的次数
+}
+
+// Neo4jLineageWriter 不持有长连接的 Session，每个工作单元（一次 flush、一次 reset）
+// 单独开 Session，并通过 ExecuteWrite 托管事务，由驱动负责瞬时错误的重试
 type Neo4jLineageWriter struct {
-	session neo4j.Session // 已在初始化时创建
+	driver   neo4j.DriverWithContext
+	database string
+
+	batchSize int
+	pending   int // 上次 flush 之后新加入的行数，失败保留的行不计入
+	// 点与边分开缓存，flush 时先写点再写边，保证边的 MATCH 能找到点
+	nodes     map[string]*neo4jBatch
+	nodeOrder []string
+	edges     map[string]*neo4jBatch
+	edgeOrder []string
 }
 
-func InitNeo4jDriver(c *config.Neo4jService) (neo4j.Driver, error) {
+func InitNeo4jDriver(c *config.Neo4jService) (neo4j.DriverWithContext, error) {
 	if c == nil {
-		return nil, fmt.Errorf("postgres config is nil")
+		return nil, fmt.Errorf("neo4j config is nil")
+	}
+
+	target, err := neo4jTarget(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if c.CACertFile != "" {
+		pem, err := os.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_cert_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CACertFile)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
 	}
 
-	return neo4j.NewDriver(c.URL, neo4j.BasicAuth(c.User, c.Password, ""))
+	return neo4j.NewDriverWithContext(target, neo4j.BasicAuth(c.User, c.Password, ""), func(conf *neo4j.Config) {
+		if c.MaxTransactionRetryTime > 0 {
+			conf.MaxTransactionRetryTime = c.MaxTransactionRetryTime
+		}
+		if tlsConfig != nil {
+			conf.TlsConfig = tlsConfig
+		}
+	})
+}
+
+// 加密方式由 URL scheme 决定，这里根据 encrypted/trust_strategy 补全 scheme
+// neo4j:// -> neo4j+s:// (校验证书) 或 neo4j+ssc:// (信任所有证书)
+func neo4jTarget(c *config.Neo4jService) (string, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid neo4j url %q: %w", c.URL, err)
+	}
+	if !c.Encrypted || (u.Scheme != "neo4j" && u.Scheme != "bolt") {
+		return c.URL, nil
+	}
+
+	switch c.TrustStrategy {
+	case "", "system":
+		u.Scheme += "+s"
+	case "all":
+		u.Scheme += "+ssc"
+	default:
+		return "", fmt.Errorf("unknown neo4j trust_strategy: %s", c.TrustStrategy)
+	}
+
+	return u.String(), nil
+}
+
+func init() {
+	Register("neo4j", func() LineageWriter { return &Neo4jLineageWriter{} })
 }
 
 func (w *Neo4jLineageWriter) Init(ctx *WriterContext) error {
-	if ctx.Neo4jDriver == nil {
-		return errors.New("Neo4j driver not provided")
+	var c config.Neo4jService
+	if err := ctx.Decode(&c); err != nil {
+		return err
 	}
 
-	w.session = ctx.Neo4jDriver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	driver, err := InitNeo4jDriver(&c)
+	if err != nil {
+		return err
+	}
 
+	w.driver = driver
+	w.database = c.Database
+	w.batchSize = defaultNeo4jBatchSize
+	if c.BatchSize > 0 {
+		w.batchSize = c.BatchSize
+	}
+	w.nodes = make(map[string]*neo4jBatch)
+	w.edges = make(map[string]*neo4jBatch)
+
+	if err := w.createSchema(); err != nil {
+		driver.Close(context.Background())
+		return err
+	}
 	return nil
 }
 
-func (w *Neo4jLineageWriter) ResetGraph() error {
+// Close 写完缓存中的批次后关闭驱动
+func (w *Neo4jLineageWriter) Close() error {
+	if w.driver == nil {
+		return nil
+	}
+	// Close 时仍失败的批次不再重试，错误中带未写入的行数
+	flushErr := w.Flush()
+	return errors.Join(flushErr, w.driver.Close(context.Background()))
+}
 
-	_, err := w.session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-		return tx.Run("MATCH (n:lineage) DETACH DELETE n", nil)
+func (w *Neo4jLineageWriter) newSession(ctx context.Context) neo4j.SessionWithContext {
+	return w.driver.NewSession(ctx, neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: w.database,
 	})
+}
 
+// 托管事务内执行一条语句，失败时由驱动按 MaxTransactionRetryTime 重试
+func executeWrite(ctx context.Context, session neo4j.SessionWithContext, cypher string, params map[string]any) error {
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(ctx, cypher, params)
+		if err != nil {
+			return nil, err
+		}
+		return result.Consume(ctx)
+	})
 	return err
 }
 
+// 创建唯一约束及索引，IF NOT EXISTS 保证可重复执行
+func (w *Neo4jLineageWriter) createSchema() error {
+	ctx := context.Background()
+	session := w.newSession(ctx)
+	defer session.Close(ctx)
+
+	for _, stmt := range neo4jSchemaStatements {
+		if err := executeWrite(ctx, session, stmt, nil); err != nil {
+			return fmt.Errorf("neo4j schema %q: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+func (w *Neo4jLineageWriter) ResetGraph() error {
+	ctx := context.Background()
+	session := w.newSession(ctx)
+	defer session.Close(ctx)
+
+	return executeWrite(ctx, session, "MATCH (n:lineage) DETACH DELETE n", nil)
+}
+
 func (w *Neo4jLineageWriter) WriteDashboardNode(d *service.DashboardFullWithMeta, s config.GrafanaService) error {
-	_, err := w.session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-		return tx.Run(`
-				MERGE (d:lineage:grafana:`+escapeLabel(s.Host)+`:`+escapeLabel(d.Meta.FolderTitle)+`:dashboard {id: $id})
-				ON CREATE SET d.title = $title, d.uid = $uid, d.created = $created, d.created_by = $created_by
-				ON MATCH SET d.updated = $updated, d.updated_by = $updated_by
-				RETURN d.id
-			`, map[string]any{
-			"id":         fmt.Sprintf("%s>%d", s.Host, d.Dashboard.ID),
-			"uid":        d.Dashboard.UID,
-			"title":      d.Dashboard.Title,
-			"created":    d.Meta.Created.String(),
-			"created_by": d.Meta.CreatedBy,
-			"updated":    d.Meta.Updated.String(),
-			"updated_by": d.Meta.UpdatedBy,
-		})
+	return w.addNode(`
+		UNWIND $rows AS row
+		MERGE (d:lineage:grafana`+labels(s.Host, d.Meta.FolderTitle)+`:dashboard {id: row.id})
+		ON CREATE SET d.title = row.title, d.uid = row.uid, d.created = row.created, d.created_by = row.created_by
+		ON MATCH SET d.updated = row.updated, d.updated_by = row.updated_by
+	`, map[string]any{
+		"id":         fmt.Sprintf("%s>%d", s.Host, d.Dashboard.ID),
+		"uid":        d.Dashboard.UID,
+		"title":      d.Dashboard.Title,
+		"created":    d.Meta.Created.String(),
+		"created_by": d.Meta.CreatedBy,
+		"updated":    d.Meta.Updated.String(),
+		"updated_by": d.Meta.UpdatedBy,
 	})
-	return err
 }
 
 func (w *Neo4jLineageWriter) WritePanelNode(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
-	_, err := w.session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-
-		// 需要将 ID 作为唯一主键
-		// CREATE CONSTRAINT ON (cc:lineage:grafana) ASSERT cc.id IS UNIQUE
-		return tx.Run(`
-				MERGE (n:lineage:grafana:`+escapeLabel(s.Host)+`:`+escapeLabel(d.Meta.FolderTitle)+`:panel {id: $id}) 
-				ON CREATE SET n.dashboard_title = $dashboard_title, n.dashboard_uid = $dashboard_uid,
-							n.panel_type = $panel_type, n.panel_title = $panel_title, n.panel_description = $panel_description,
-							n.created = $created, n.created_by = $created_by, n.updated = $updated, n.updated_by = $updated_by,
-							n.rawsql = $rawsql, n.udt = timestamp()
-				ON MATCH SET n.udt = timestamp()
-				RETURN n.id
-			`,
-			map[string]any{
-				"id":                fmt.Sprintf("%s>%d>%d", s.Host, d.Dashboard.ID, p.ID),
-				"dashboard_title":   d.Dashboard.Title,
-				"dashboard_uid":     d.Dashboard.UID,
-				"panel_type":        p.Type,
-				"panel_title":       p.Title,
-				"panel_description": p.Description,
-				"rawsql":            "",
-				"created":           d.Meta.Created.String(),
-				"created_by":        d.Meta.CreatedBy,
-				"updated":           d.Meta.Updated.String(),
-				"updated_by":        d.Meta.UpdatedBy,
-			})
-
+	return w.addNode(`
+		UNWIND $rows AS row
+		MERGE (n:lineage:grafana`+labels(s.Host, d.Meta.FolderTitle)+`:panel {id: row.id})
+		ON CREATE SET n.dashboard_title = row.dashboard_title, n.dashboard_uid = row.dashboard_uid,
+					n.panel_type = row.panel_type, n.panel_title = row.panel_title, n.panel_description = row.panel_description,
+					n.created = row.created, n.created_by = row.created_by, n.updated = row.updated, n.updated_by = row.updated_by,
+					n.rawsql = row.rawsql, n.udt = timestamp()
+		ON MATCH SET n.udt = timestamp()
+	`, map[string]any{
+		"id":                fmt.Sprintf("%s>%d>%d", s.Host, d.Dashboard.ID, p.ID),
+		"dashboard_title":   d.Dashboard.Title,
+		"dashboard_uid":     d.Dashboard.UID,
+		"panel_type":        p.Type,
+		"panel_title":       p.Title,
+		"panel_description": p.Description,
+		"rawsql":            "",
+		"created":           d.Meta.Created.String(),
+		"created_by":        d.Meta.CreatedBy,
+		"updated":           d.Meta.Updated.String(),
+		"updated_by":        d.Meta.UpdatedBy,
 	})
-	return err
 }
 
 func (w *Neo4jLineageWriter) WriteTable2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
-	_, err := w.session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-		// 实际写入逻辑
-		for _, dep := range dependencies {
-			for _, t := range dep.Tables {
-
-				_, err := tx.Run(`
-					MATCH (pnode:lineage:`+ds.Type+` {id: $pid}), (cnode:lineage:grafana {id: $cid})
-					CREATE (pnode)-[e:downstream {udt: timestamp()}]->(cnode)
-					RETURN e
-				`, map[string]any{
-					"pid": fmt.Sprintf("%s.%s.%s", t.Database, t.SchemaName, t.RelName),
-					"cid": fmt.Sprintf("%s>%d>%d", s.Host, d.Dashboard.ID, p.ID),
-				})
-				if err != nil {
-					log.Error(err)
-				}
+	cypher := `
+		UNWIND $rows AS row
+		MATCH (pnode:lineage` + labels(ds.Type) + ` {id: row.pid}), (cnode:lineage:grafana {id: row.cid})
+		MERGE (pnode)-[e:downstream]->(cnode)
+		SET e.udt = timestamp()
+	`
+	for _, dep := range dependencies {
+		for _, t := range dep.Tables {
+			if err := w.addEdge(cypher, map[string]any{
+				"pid": fmt.Sprintf("%s.%s.%s", t.Database, t.SchemaName, t.RelName),
+				"cid": fmt.Sprintf("%s>%d>%d", s.Host, d.Dashboard.ID, p.ID),
+			}); err != nil {
+				return err
 			}
 		}
-		return nil, nil
-	})
-	return err
+	}
+	return nil
 }
 
 func (w *Neo4jLineageWriter) WriteDash2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService) error {
-	_, err := w.session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-		// 需要将 ID 作为唯一主键
-		return tx.Run(`
-				MATCH (pnode:lineage:grafana:dashboard {id: $pid}), (cnode:lineage:grafana:panel {id: $cid})
-				CREATE (pnode)-[e:contain {udt: timestamp()}]->(cnode)
-				RETURN e
-			`,
-
-			map[string]any{
-				"pid": fmt.Sprintf("%s>%d", s.Host, d.Dashboard.ID),
-				"cid": fmt.Sprintf("%s>%d>%d", s.Host, d.Dashboard.ID, p.ID),
-			})
+	return w.addEdge(`
+		UNWIND $rows AS row
+		MATCH (pnode:lineage:grafana:dashboard {id: row.pid}), (cnode:lineage:grafana:panel {id: row.cid})
+		MERGE (pnode)-[e:contain]->(cnode)
+		SET e.udt = timestamp()
+	`, map[string]any{
+		"pid": fmt.Sprintf("%s>%d", s.Host, d.Dashboard.ID),
+		"cid": fmt.Sprintf("%s>%d>%d", s.Host, d.Dashboard.ID, p.ID),
 	})
-	return err
 }
 
-func escapeLabel(label string) string {
-	return "`" + label + "`"
+// labels 拼接节点的 label，如 :`postgresql`:`dw`；空的 label 在 Cypher 中非法，整个批次都会失败，直接跳过
+func labels(names ...string) string {
+	var b strings.Builder
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		b.WriteString(":`" + strings.ReplaceAll(name, "`", "``") + "`")
+	}
+	return b.String()
 }
 
 // 针对 Neo4j 建模，暂定的建模方案：
@@ -145,78 +284,211 @@ func escapeLabel(label string) string {
 
 // 创建图中节点
 func (w *Neo4jLineageWriter) WriteTableNode(r *service.Table, s config.PostgresService) error {
-	_, err := w.session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-		// 需要将 ID 作为唯一主键
-		// CREATE CONSTRAINT ON (cc:lineage:postgresql) ASSERT cc.id IS UNIQUE
-		return tx.Run(`
-				MERGE (n:lineage:`+s.Type+`:`+escapeLabel(r.Database)+`:`+r.SchemaName+` {id: $id})
-				ON CREATE SET n.database = $database, n.schemaname = $schemaname, n.relname = $relname, n.udt = timestamp(),
-							n.relpersistence = $relpersistence, n.calls = $calls
-				ON MATCH SET n.udt = timestamp(), n.relpersistence = $relpersistence, n.calls = n.calls + $calls
-				RETURN n.id
-			`,
-			map[string]any{
-				"id":             r.Database + "." + r.GetID(),
-				"database":       r.Database,
-				"schemaname":     r.SchemaName,
-				"relname":        r.RelName,
-				"relpersistence": r.RelPersistence,
-				"calls":          r.Calls,
-			})
+	return w.addNode(`
+		UNWIND $rows AS row
+		MERGE (n:lineage`+labels(s.Type, r.Database, r.SchemaName)+` {id: row.id})
+		ON CREATE SET n.database = row.database, n.schemaname = row.schemaname, n.relname = row.relname, n.udt = timestamp(),
+					n.relpersistence = row.relpersistence, n.calls = row.calls
+		ON MATCH SET n.udt = timestamp(), n.relpersistence = row.relpersistence, n.calls = coalesce(n.calls, 0) + row.calls
+	`, map[string]any{
+		"id":             r.Database + "." + r.GetID(),
+		"database":       r.Database,
+		"schemaname":     r.SchemaName,
+		"relname":        r.RelName,
+		"relpersistence": r.RelPersistence,
+		"calls":          r.Calls,
+	})
+}
+
+// 创建表之外的节点，label 为节点种类，属性原样写入；id 与表一样带 database 前缀，边可按 id 匹配
+func (w *Neo4jLineageWriter) WriteNode(n depgraph.Node, database string, s config.PostgresService) error {
+	return w.addNode(`
+		UNWIND $rows AS row
+		MERGE (n:lineage`+labels(string(n.GetKind()))+` {id: row.id})
+		ON CREATE SET n.database = row.database, n.kind = row.kind
+		SET n += coalesce(row.attributes, {}), n.udt = timestamp()
+	`, map[string]any{
+		"id":         database + "." + n.GetID(),
+		"database":   database,
+		"kind":       string(n.GetKind()),
+		"attributes": n.GetAttributes(),
 	})
-	return err
 }
 
 // 创建图中边
-func (w *Neo4jLineageWriter) WriteFuncEdge(r *service.Udf, s config.PostgresService) error {
-	_, err := w.session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
-		return tx.Run(`
-		MATCH (pnode {id: $pid}), (cnode {id: $cid})
-		CREATE (pnode)-[e:downstream {id: $id, database: $database, schemaname: $schemaname, procname: $procname, calls: $calls, udt: timestamp()}]->(cnode)
-		RETURN e
+// 以 (上游, 下游, id) 做 MERGE，重复运行不会产生重复的 downstream 关系
+func (w *Neo4jLineageWriter) WriteFuncEdge(e *depgraph.Edge, from, to depgraph.Node, r *service.Udf, s config.PostgresService) error {
+	return w.addEdge(`
+		UNWIND $rows AS row
+		MATCH (pnode:lineage {id: row.pid}), (cnode:lineage {id: row.cid})
+		MERGE (pnode)-[e:downstream {id: row.id}]->(cnode)
+		ON CREATE SET e.database = row.database, e.schemaname = row.schemaname, e.procname = row.procname,
+					e.calls = row.calls, e.mean_time = row.mean_time, e.udt = timestamp()
+		ON MATCH SET e.mean_time = (coalesce(e.mean_time, 0) * coalesce(e.calls, 0) + row.mean_time * row.calls) /
+						CASE WHEN coalesce(e.calls, 0) + row.calls = 0 THEN 1 ELSE coalesce(e.calls, 0) + row.calls END,
+					e.calls = coalesce(e.calls, 0) + row.calls, e.udt = timestamp()
 	`, map[string]any{
-			"pid":        r.Database + "." + r.SrcID,
-			"cid":        r.Database + "." + r.DestID,
-			"id":         r.Database + "." + r.GetID(),
-			"database":   r.Database,
-			"schemaname": r.SchemaName,
-			"procname":   r.ProcName,
-			"calls":      r.Calls,
-		})
+		"pid":        r.Database + "." + e.From,
+		"cid":        r.Database + "." + e.To,
+		"id":         r.Database + "." + r.GetID(),
+		"database":   r.Database,
+		"schemaname": r.SchemaName,
+		"procname":   r.ProcName,
+		"calls":      r.Calls,
+		"mean_time":  r.MeanTime,
 	})
+}
 
-	return err
+// 创建 ERD 中的关联，两端按表的 id 匹配，与血缘共用节点；以 (表, 表, id) 做 MERGE，calls 累加。
+// 两端的表不存在时先创建，已存在的不修改，relpersistence、calls 以血缘写入的为准
+func (w *Neo4jLineageWriter) WriteJoinEdge(j *service.Join, s config.PostgresService) error {
+	for _, t := range []*service.Table{j.From, j.To} {
+		if err := w.addNode(`
+			UNWIND $rows AS row
+			MERGE (n:lineage`+labels(s.Type, j.Database, t.SchemaName)+` {id: row.id})
+			ON CREATE SET n.database = row.database, n.schemaname = row.schemaname, n.relname = row.relname, n.udt = timestamp(),
+						n.relpersistence = row.relpersistence, n.calls = 0
+		`, map[string]any{
+			"id":             j.Database + "." + t.GetID(),
+			"database":       j.Database,
+			"schemaname":     t.SchemaName,
+			"relname":        t.RelName,
+			"relpersistence": t.RelPersistence,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return w.addEdge(`
+		UNWIND $rows AS row
+		MATCH (snode:lineage {id: row.sid}), (tnode:lineage {id: row.tid})
+		MERGE (snode)-[e:join {id: row.id}]->(tnode)
+		ON CREATE SET e.database = row.database, e.from_column = row.from_column, e.to_column = row.to_column,
+					e.join_type = row.join_type, e.calls = row.calls, e.udt = timestamp()
+		ON MATCH SET e.calls = coalesce(e.calls, 0) + row.calls, e.udt = timestamp()
+	`, map[string]any{
+		"sid":         j.Database + "." + j.From.GetID(),
+		"tid":         j.Database + "." + j.To.GetID(),
+		"id":          j.Database + "." + j.GetID(),
+		"database":    j.Database,
+		"from_column": j.FromColumn,
+		"to_column":   j.ToColumn,
+		"join_type":   j.Type,
+		"calls":       j.Calls,
+	})
 }
 
 func (w *Neo4jLineageWriter) CompleteTableNode(r *service.Table, s config.PostgresService) error {
 	// Create or update Neo4j node with PostgreSQL data
-	cypher := `
-		MERGE (n:lineage:` + s.Type + `:` + escapeLabel(r.Database) + `:` + r.SchemaName + ` {id: $id})
-		ON CREATE SET n.database = $database, n.schemaname = $schemaname, n.relname = $relname,
-					n.udt = timestamp(), n.description = $description,
-					n.seq_scan = $seq_scan, n.seq_tup_read = $seq_tup_read,
-					n.idx_scan = $idx_scan, n.idx_tup_fetch = $idx_tup_fetch
-		ON MATCH SET n.udt = timestamp(), n.description = $description,
-					n.seq_scan = $seq_scan, n.seq_tup_read = $seq_tup_read,
-					n.idx_scan = $idx_scan, n.idx_tup_fetch = $idx_tup_fetch
-	`
-	_, err := w.session.WriteTransaction(func(transaction neo4j.Transaction) (any, error) {
-		result, err := transaction.Run(cypher, map[string]any{
-			"id":            r.Database + "." + r.GetID(),
-			"database":      r.Database,
-			"schemaname":    r.SchemaName,
-			"relname":       r.RelName,
-			"seq_scan":      r.SeqScan,
-			"seq_tup_read":  r.SeqTupRead,
-			"idx_scan":      r.IdxScan,
-			"idx_tup_fetch": r.IdxTupFetch,
-			"description":   r.Comment,
-		})
-		if err != nil {
-			return nil, err
-		}
-		return result.Consume()
+	return w.addNode(`
+		UNWIND $rows AS row
+		MERGE (n:lineage`+labels(s.Type, r.Database, r.SchemaName)+` {id: row.id})
+		ON CREATE SET n.database = row.database, n.schemaname = row.schemaname, n.relname = row.relname,
+					n.udt = timestamp(), n.description = row.description,
+					n.seq_scan = row.seq_scan, n.seq_tup_read = row.seq_tup_read,
+					n.idx_scan = row.idx_scan, n.idx_tup_fetch = row.idx_tup_fetch
+		ON MATCH SET n.udt = timestamp(), n.description = row.description,
+					n.seq_scan = row.seq_scan, n.seq_tup_read = row.seq_tup_read,
+					n.idx_scan = row.idx_scan, n.idx_tup_fetch = row.idx_tup_fetch
+	`, map[string]any{
+		"id":            r.Database + "." + r.GetID(),
+		"database":      r.Database,
+		"schemaname":    r.SchemaName,
+		"relname":       r.RelName,
+		"seq_scan":      r.SeqScan,
+		"seq_tup_read":  r.SeqTupRead,
+		"idx_scan":      r.IdxScan,
+		"idx_tup_fetch": r.IdxTupFetch,
+		"description":   r.Comment,
 	})
+}
 
-	return err
+func (w *Neo4jLineageWriter) addNode(cypher string, row map[string]any) error {
+	w.nodeOrder = appendBatch(w.nodes, w.nodeOrder, cypher, row)
+	return w.afterAdd()
+}
+
+func (w *Neo4jLineageWriter) addEdge(cypher string, row map[string]any) error {
+	w.edgeOrder = appendBatch(w.edges, w.edgeOrder, cypher, row)
+	return w.afterAdd()
+}
+
+func (w *Neo4jLineageWriter) afterAdd() error {
+	w.pending++
+	if w.pending >= w.batchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+func appendBatch(batches map[string]*neo4jBatch, order []string, cypher string, row map[string]any) []string {
+	b, ok := batches[cypher]
+	if !ok {
+		b = &neo4jBatch{cypher: cypher}
+		batches[cypher] = b
+		order = append(order, cypher)
+	}
+	b.rows = append(b.rows, row)
+	return order
+}
+
+// Flush 将缓存的点和边通过 UNWIND 批量写入，先点后边。写入成功的批次才从缓存中去掉，
+// 失败的批次留到下次 Flush 重试，连续失败 maxNeo4jBatchAttempts 次后丢弃；
+// 点有失败时边的 MATCH 找不到点，边也留到下次
+func (w *Neo4jLineageWriter) Flush() error {
+	if len(w.nodeOrder) == 0 && len(w.edgeOrder) == 0 {
+		return nil
+	}
+	w.pending = 0
+
+	ctx := context.Background()
+	session := w.newSession(ctx)
+	defer session.Close(ctx)
+
+	if err := w.flushBatches(ctx, session, w.nodes, &w.nodeOrder); err != nil {
+		return fmt.Errorf("%w (%d rows kept for retry)", err, w.buffered())
+	}
+	if err := w.flushBatches(ctx, session, w.edges, &w.edgeOrder); err != nil {
+		return fmt.Errorf("%w (%d rows kept for retry)", err, w.buffered())
+	}
+	return nil
+}
+
+// flushBatches 依次写入各批次，互不影响；成功的及失败次数达到上限的从 batches、order 中去掉，其余保留
+func (w *Neo4jLineageWriter) flushBatches(ctx context.Context, session neo4j.SessionWithContext, batches map[string]*neo4jBatch, order *[]string) error {
+	var (
+		errs []error
+		kept []string
+	)
+	for _, k := range *order {
+		b := batches[k]
+		err := executeWrite(ctx, session, b.cypher, map[string]any{"rows": b.rows})
+		if err == nil {
+			delete(batches, k)
+			continue
+		}
+
+		log.Debugf("Failed batch: %s", b.cypher)
+		if b.attempts++; b.attempts >= maxNeo4jBatchAttempts {
+			log.Errorf("Drop neo4j batch after %d attempts (%d rows): %s", b.attempts, len(b.rows), b.cypher)
+			errs = append(errs, fmt.Errorf("neo4j batch write (%d rows dropped after %d attempts): %w", len(b.rows), b.attempts, err))
+			delete(batches, k)
+			continue
+		}
+		errs = append(errs, fmt.Errorf("neo4j batch write (%d rows): %w", len(b.rows), err))
+		kept = append(kept, k)
+	}
+	*order = kept
+	return errors.Join(errs...)
+}
+
+// buffered 缓存中尚未写入的行数
+func (w *Neo4jLineageWriter) buffered() int {
+	n := 0
+	for _, batches := range []map[string]*neo4jBatch{w.nodes, w.edges} {
+		for _, b := range batches {
+			n += len(b.rows)
+		}
+	}
+	return n
 }
@@ -0,0 +1,19 @@
+package writer
+
+import "testing"
+
+func TestNeo4jLabels(t *testing.T) {
+	for _, tc := range []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"postgresql", "dw", "public"}, ":`postgresql`:`dw`:`public`"},
+		{[]string{"postgresql", "", "public"}, ":`postgresql`:`public`"},
+		{[]string{""}, ""},
+		{[]string{"a`b"}, ":`a``b`"},
+	} {
+		if got := labels(tc.names...); got != tc.want {
+			t.Errorf("labels(%q) = %s, want %s", tc.names, got, tc.want)
+		}
+	}
+}
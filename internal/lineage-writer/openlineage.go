@@ -0,0 +1,480 @@
+package writer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pg_lineage/internal/lineage"
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+	"pg_lineage/pkg/log"
+
+	"github.com/google/uuid"
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	openLineageProducer       = "https://github.com/cobolbaby/pg_lineage"
+	openLineageRunEventSchema = "https://openlineage.io/spec/2-0-2/OpenLineage.json#/$defs/RunEvent"
+
+	olSQLJobFacetSchema        = "https://openlineage.io/spec/facets/1-1-0/SQLJobFacet.json#/$defs/SQLJobFacet"
+	olJobTypeFacetSchema       = "https://openlineage.io/spec/facets/2-0-3/JobTypeJobFacet.json#/$defs/JobTypeJobFacet"
+	olSchemaFacetSchema        = "https://openlineage.io/spec/facets/1-1-1/SchemaDatasetFacet.json#/$defs/SchemaDatasetFacet"
+	olColumnLineageFacetSchema = "https://openlineage.io/spec/facets/1-2-0/ColumnLineageDatasetFacet.json#/$defs/ColumnLineageDatasetFacet"
+	olStatementsFacetSchema    = openLineageProducer + "/blob/master/docs/PgStatStatementsRunFacet.json#/$defs/PgStatStatementsRunFacet"
+)
+
+// OpenLineage RunEvent，仅包含用到的字段
+type olRunEvent struct {
+	EventType string      `json:"eventType"`
+	EventTime string      `json:"eventTime"`
+	Producer  string      `json:"producer"`
+	SchemaURL string      `json:"schemaURL"`
+	Run       olRun       `json:"run"`
+	Job       olJob       `json:"job"`
+	Inputs    []olDataset `json:"inputs"`
+	Outputs   []olDataset `json:"outputs"`
+}
+
+type olRun struct {
+	RunID  string         `json:"runId"`
+	Facets map[string]any `json:"facets,omitempty"`
+}
+
+type olJob struct {
+	Namespace string         `json:"namespace"`
+	Name      string         `json:"name"`
+	Facets    map[string]any `json:"facets,omitempty"`
+}
+
+type olDataset struct {
+	Namespace string         `json:"namespace"`
+	Name      string         `json:"name"`
+	Facets    map[string]any `json:"facets,omitempty"`
+}
+
+type olInputField struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Field     string `json:"field"`
+}
+
+type openLineageConfig struct {
+	Transport string        `mapstructure:"transport"` // http | file
+	URL       string        `mapstructure:"url"`       // e.g. http://marquez:5000/api/v1/lineage
+	APIKey    string        `mapstructure:"api_key"`   // 以 Bearer Token 方式携带
+	Timeout   time.Duration `mapstructure:"timeout"`
+	Path      string        `mapstructure:"path"` // NDJSON 文件路径，追加写入
+}
+
+// OpenLineageWriter 将每次 UDF 调用 / 查询、每个 Grafana Panel 转换为一个 OpenLineage RunEvent，
+// 通过 HTTP 推送给 Marquez / DataHub，或以 NDJSON 格式写入文件
+type OpenLineageWriter struct {
+	conf   openLineageConfig
+	client *http.Client
+
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+}
+
+func init() {
+	Register("openlineage", func() LineageWriter { return &OpenLineageWriter{} })
+}
+
+func (w *OpenLineageWriter) Init(ctx *WriterContext) error {
+	if err := ctx.Decode(&w.conf); err != nil {
+		return err
+	}
+
+	switch w.conf.Transport {
+	case "http":
+		if w.conf.URL == "" {
+			return errors.New("openlineage http transport requires url")
+		}
+		timeout := w.conf.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		w.client = &http.Client{Timeout: timeout}
+	case "file":
+		if w.conf.Path == "" {
+			return errors.New("openlineage file transport requires path")
+		}
+		f, err := os.OpenFile(w.conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		w.file = f
+		w.buf = bufio.NewWriter(f)
+	default:
+		return fmt.Errorf("unknown openlineage transport: %q", w.conf.Transport)
+	}
+
+	return nil
+}
+
+func (w *OpenLineageWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	flushErr := w.buf.Flush()
+	return errors.Join(flushErr, w.file.Close())
+}
+
+// 事件只追加不删除，重置无需处理
+func (w *OpenLineageWriter) ResetGraph() error {
+	return nil
+}
+
+// 点、边由 WriteGraph 整体转换为 RunEvent
+func (w *OpenLineageWriter) WriteTableNode(t *service.Table, s config.PostgresService) error {
+	return nil
+}
+
+func (w *OpenLineageWriter) WriteNode(n depgraph.Node, database string, s config.PostgresService) error {
+	return nil
+}
+
+func (w *OpenLineageWriter) WriteFuncEdge(e *depgraph.Edge, from, to depgraph.Node, t *service.Udf, s config.PostgresService) error {
+	return nil
+}
+
+// WriteJoinEdge 表间的关联不是数据流向，OpenLineage 中没有对应的概念
+func (w *OpenLineageWriter) WriteJoinEdge(j *service.Join, s config.PostgresService) error {
+	return nil
+}
+
+func (w *OpenLineageWriter) CompleteTableNode(t *service.Table, s config.PostgresService) error {
+	return nil
+}
+
+func (w *OpenLineageWriter) WriteDashboardNode(d *service.DashboardFullWithMeta, s config.GrafanaService) error {
+	return nil
+}
+
+func (w *OpenLineageWriter) WritePanelNode(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
+	return nil
+}
+
+func (w *OpenLineageWriter) WriteDash2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService) error {
+	return nil
+}
+
+// Panel 视为一个只读的 Job，依赖的表作为 inputs
+func (w *OpenLineageWriter) WriteTable2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
+	if len(dependencies) == 0 {
+		return nil
+	}
+
+	var (
+		inputs []olDataset
+		seen   = make(map[string]bool)
+		sqls   []string
+	)
+	for _, dep := range dependencies {
+		sqls = append(sqls, dep.RawSql)
+		for _, t := range dep.Tables {
+			name := olDatasetName(ds, t)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			inputs = append(inputs, olDataset{Namespace: olNamespace(ds), Name: name})
+		}
+	}
+
+	ev := newRunEvent(olJob{
+		Namespace: "grafana://" + s.Host,
+		Name:      fmt.Sprintf("%s>%s>%s", d.Meta.FolderTitle, d.Dashboard.Title, p.Title),
+		Facets: map[string]any{
+			"sql":     olFacet(olSQLJobFacetSchema, map[string]any{"query": strings.Join(sqls, ";\n")}),
+			"jobType": olJobTypeFacet("GRAFANA", "DASHBOARD_PANEL"),
+		},
+	})
+	ev.Inputs = inputs
+
+	return w.emit(ev)
+}
+
+func (w *OpenLineageWriter) WriteGraph(graph *depgraph.Graph, udf *service.Udf, s config.PostgresService) error {
+	// 有出边的是上游，有入边的是下游；孤立节点多来自普通查询，视为读取
+	parents := make(map[string]bool)
+	children := make(map[string]bool)
+	for k, v := range graph.GetRelationships() {
+		parents[k] = true
+		for kk := range v {
+			children[kk] = true
+		}
+	}
+
+	var inputTables, outputTables []*service.Table
+	for id, v := range graph.GetNodes() {
+		t, ok := v.(*service.Table)
+		if !ok || t.IsTemp() {
+			continue
+		}
+		if children[id] {
+			outputTables = append(outputTables, t)
+		}
+		if parents[id] || !children[id] {
+			inputTables = append(inputTables, t)
+		}
+	}
+	if len(inputTables) == 0 && len(outputTables) == 0 {
+		return nil
+	}
+	sortTables(inputTables)
+	sortTables(outputTables)
+
+	sqlText, columns := w.columnLineage(udf)
+
+	jobName, jobType := queryJobName(udf.Query), "QUERY"
+	if udf.ProcName != "" {
+		jobName, jobType = udf.GetID(), "FUNCTION"
+	}
+
+	jobFacets := map[string]any{"jobType": olJobTypeFacet("POSTGRESQL", jobType)}
+	if sqlText != "" {
+		jobFacets["sql"] = olFacet(olSQLJobFacetSchema, map[string]any{"query": sqlText})
+	}
+
+	ev := newRunEvent(olJob{Namespace: olNamespace(s), Name: jobName, Facets: jobFacets})
+	if udf.Calls > 0 {
+		ev.Run.Facets = map[string]any{
+			"pgStatStatements": olFacet(olStatementsFacetSchema, map[string]any{"calls": udf.Calls}),
+		}
+	}
+
+	for _, t := range inputTables {
+		ev.Inputs = append(ev.Inputs, olDataset{
+			Namespace: olNamespace(s),
+			Name:      olDatasetName(s, t),
+			Facets:    olSchemaFacets(t, observedColumns(columns, t, true)),
+		})
+	}
+	for _, t := range outputTables {
+		ds := olDataset{
+			Namespace: olNamespace(s),
+			Name:      olDatasetName(s, t),
+			Facets:    olSchemaFacets(t, observedColumns(columns, t, false)),
+		}
+		if facet := olColumnLineageFacet(columns, t, s); facet != nil {
+			if ds.Facets == nil {
+				ds.Facets = make(map[string]any)
+			}
+			ds.Facets["columnLineage"] = facet
+		}
+		ev.Outputs = append(ev.Outputs, ds)
+	}
+
+	return w.emit(ev)
+}
+
+// 函数取其定义，普通查询取原始 SQL，并据此解析字段级血缘
+func (w *OpenLineageWriter) columnLineage(udf *service.Udf) (string, []*lineage.ColumnLineage) {
+	var (
+		sqlText string
+		columns []*lineage.ColumnLineage
+		err     error
+	)
+
+	if udf.Definition != "" {
+		sqlText = udf.Definition
+		columns, err = lineage.ParseUDFColumnLineage(lineage.FilterUnhandledCommands(udf.Definition))
+	} else if udf.Query != "" {
+		sqlText = udf.Query
+		columns, err = lineage.ParseColumnLineage(udf.Query)
+	}
+	if err != nil {
+		log.Debugf("Column lineage unavailable for %s: %v", udf.GetID(), err)
+	}
+
+	return sqlText, columns
+}
+
+func (w *OpenLineageWriter) emit(ev *olRunEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	if w.client != nil {
+		return w.post(data)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.buf.Write(data); err != nil {
+		return err
+	}
+	return w.buf.WriteByte('\n')
+}
+
+func (w *OpenLineageWriter) post(data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.conf.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.conf.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+w.conf.APIKey)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("openlineage endpoint returned %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+func newRunEvent(job olJob) *olRunEvent {
+	runID, err := uuid.NewV7()
+	if err != nil {
+		runID = uuid.New()
+	}
+
+	return &olRunEvent{
+		EventType: "COMPLETE",
+		EventTime: time.Now().UTC().Format(time.RFC3339Nano),
+		Producer:  openLineageProducer,
+		SchemaURL: openLineageRunEventSchema,
+		Run:       olRun{RunID: runID.String()},
+		Job:       job,
+		Inputs:    []olDataset{},
+		Outputs:   []olDataset{},
+	}
+}
+
+func olFacet(schemaURL string, fields map[string]any) map[string]any {
+	fields["_producer"] = openLineageProducer
+	fields["_schemaURL"] = schemaURL
+	return fields
+}
+
+func olJobTypeFacet(integration, jobType string) map[string]any {
+	return olFacet(olJobTypeFacetSchema, map[string]any{
+		"processingType": "BATCH",
+		"integration":    integration,
+		"jobType":        jobType,
+	})
+}
+
+// 数据集命名遵循 OpenLineage 对 Postgres 的约定：namespace 为实例，name 为 库.模式.表
+func olNamespace(s config.PostgresService) string {
+	return fmt.Sprintf("postgres://%s/%s", s.Zone, s.Label)
+}
+
+func olDatasetName(s config.PostgresService, t *service.Table) string {
+	if s.DBName == "" {
+		return t.GetID()
+	}
+	return s.DBName + "." + t.GetID()
+}
+
+// 非管道查询无法确定执行的是哪段逻辑，以 SQL 指纹作为 Job 名
+func queryJobName(query string) string {
+	fp, err := pg_query.Fingerprint(query)
+	if err != nil || fp == "" {
+		return "query"
+	}
+	return "query_" + fp
+}
+
+// schema facet 优先使用表的字段列表，否则退化为本次 SQL 中出现过的字段
+func olSchemaFacets(t *service.Table, observed []string) map[string]any {
+	columns := t.Columns
+	if len(columns) == 0 {
+		columns = observed
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	fields := make([]map[string]any, 0, len(columns))
+	for _, c := range columns {
+		fields = append(fields, map[string]any{"name": c})
+	}
+	return map[string]any{
+		"schema": olFacet(olSchemaFacetSchema, map[string]any{"fields": fields}),
+	}
+}
+
+func observedColumns(columns []*lineage.ColumnLineage, t *service.Table, asSource bool) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(ref lineage.ColumnRef) {
+		if ref.Table.GetID() == t.GetID() && !seen[ref.Column] {
+			seen[ref.Column] = true
+			names = append(names, ref.Column)
+		}
+	}
+
+	for _, c := range columns {
+		if asSource {
+			for _, src := range c.Sources {
+				add(src)
+			}
+		} else {
+			add(c.Target)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func olColumnLineageFacet(columns []*lineage.ColumnLineage, t *service.Table, s config.PostgresService) map[string]any {
+	fields := make(map[string]any)
+	for _, c := range columns {
+		if c.Target.Table.GetID() != t.GetID() {
+			continue
+		}
+
+		var inputs []olInputField
+		for _, src := range c.Sources {
+			if src.Table.IsTemp() {
+				continue
+			}
+			inputs = append(inputs, olInputField{
+				Namespace: olNamespace(s),
+				Name:      olDatasetName(s, src.Table),
+				Field:     src.Column,
+			})
+		}
+		if len(inputs) > 0 {
+			fields[c.Target.Column] = map[string]any{"inputFields": inputs}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return olFacet(olColumnLineageFacetSchema, map[string]any{"fields": fields})
+}
+
+func sortTables(tables []*service.Table) {
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].GetID() < tables[j].GetID()
+	})
+}
@@ -0,0 +1,178 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+)
+
+var olTestSource = config.PostgresService{Label: "dw", Zone: "z", DBName: "dwdb", Type: service.DBTypePostgres}
+
+// olTestGraph dw.src -> dw.dst，由函数 dw.f 产生
+func olTestGraph() (*depgraph.Graph, *service.Udf) {
+	g := depgraph.New()
+	g.DependOn(
+		&service.Table{SchemaName: "dw", RelName: "dst", RelPersistence: service.REL_PERSIST},
+		&service.Table{SchemaName: "dw", RelName: "src", RelPersistence: service.REL_PERSIST},
+	)
+	return g, &service.Udf{SchemaName: "dw", ProcName: "f", Calls: 3}
+}
+
+func newOpenLineageWriter(t *testing.T, settings map[string]any) *OpenLineageWriter {
+	t.Helper()
+	w := &OpenLineageWriter{}
+	if err := w.Init(&WriterContext{Type: "openlineage", Settings: settings}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func checkRunEvent(t *testing.T, ev olRunEvent) {
+	t.Helper()
+	if ev.EventType != "COMPLETE" || ev.Producer != openLineageProducer || ev.SchemaURL != openLineageRunEventSchema {
+		t.Errorf("event header = %s %s %s", ev.EventType, ev.Producer, ev.SchemaURL)
+	}
+	if ev.Run.RunID == "" {
+		t.Error("empty runId")
+	}
+	if ev.Job.Namespace != "postgres://z/dw" || ev.Job.Name != "dw.f" {
+		t.Errorf("job = %s %s", ev.Job.Namespace, ev.Job.Name)
+	}
+	if len(ev.Inputs) != 1 || ev.Inputs[0].Name != "dwdb.dw.src" {
+		t.Errorf("inputs = %+v", ev.Inputs)
+	}
+	if len(ev.Outputs) != 1 || ev.Outputs[0].Name != "dwdb.dw.dst" {
+		t.Errorf("outputs = %+v", ev.Outputs)
+	}
+	if _, ok := ev.Run.Facets["pgStatStatements"]; !ok {
+		t.Errorf("run facets = %v", ev.Run.Facets)
+	}
+}
+
+func TestOpenLineageHTTP(t *testing.T) {
+	var (
+		events  []olRunEvent
+		headers []http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/lineage" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		var ev olRunEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		events = append(events, ev)
+		headers = append(headers, r.Header.Clone())
+		rw.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	w := newOpenLineageWriter(t, map[string]any{
+		"transport": "http",
+		"url":       srv.URL + "/api/v1/lineage",
+		"api_key":   "secret",
+		"timeout":   "2s",
+	})
+
+	g, udf := olTestGraph()
+	if err := w.WriteGraph(g, udf, olTestSource); err != nil {
+		t.Fatalf("WriteGraph: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	checkRunEvent(t, events[0])
+	if got := headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := headers[0].Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+}
+
+func TestOpenLineageHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Error(rw, "invalid event", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := newOpenLineageWriter(t, map[string]any{"transport": "http", "url": srv.URL})
+
+	g, udf := olTestGraph()
+	err := w.WriteGraph(g, udf, olTestSource)
+	if err == nil {
+		t.Fatal("WriteGraph: want error for 400 response")
+	}
+	if !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "invalid event") {
+		t.Errorf("error = %v, want status and body", err)
+	}
+}
+
+func TestOpenLineageFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	// 两次打开同一文件，事件追加写入
+	for i := 0; i < 2; i++ {
+		w := &OpenLineageWriter{}
+		if err := w.Init(&WriterContext{Type: "openlineage", Settings: map[string]any{"transport": "file", "path": path}}); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+		g, udf := olTestGraph()
+		if err := w.WriteGraph(g, udf, olTestSource); err != nil {
+			t.Fatalf("WriteGraph: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines int
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines++
+		var ev olRunEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("line %d: %v", lines, err)
+		}
+		checkRunEvent(t, ev)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if lines != 2 {
+		t.Errorf("got %d lines, want 2", lines)
+	}
+}
+
+func TestOpenLineageInitErrors(t *testing.T) {
+	for _, settings := range []map[string]any{
+		{"transport": "http"},
+		{"transport": "file"},
+		{"transport": "kafka"},
+	} {
+		w := &OpenLineageWriter{}
+		if err := w.Init(&WriterContext{Type: "openlineage", Settings: settings}); err == nil {
+			t.Errorf("Init(%v): want error", settings)
+		}
+	}
+}
@@ -2,18 +2,20 @@ package writer
 
 import (
 	"database/sql"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"strings"
+
 	"pg_lineage/internal/service"
 	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
 	"pg_lineage/pkg/log"
 
 	"github.com/samber/lo"
 )
 
 type PGLineageWriter struct {
-	db *sql.DB // 在 init 时初始化好的连接池
+	db  *sql.DB // 在 init 时初始化好的连接池
+	urn *URNBuilder
 }
 
 func InitPGClient(c *config.PostgresService) (*sql.DB, error) {
@@ -35,30 +37,121 @@ func InitPGClient(c *config.PostgresService) (*sql.DB, error) {
 	return db, nil
 }
 
+func init() {
+	Register("postgres", func() LineageWriter { return &PGLineageWriter{} })
+}
+
+type pgWriterConfig struct {
+	config.PostgresService `mapstructure:",squash"`
+
+	AutoMigrate bool `mapstructure:"auto_migrate"` // Init 时自动升级表结构，默认只检查版本
+}
+
+// Init 检查 manager.* 的表结构版本，与内置版本不一致时拒绝写入
 func (p *PGLineageWriter) Init(ctx *WriterContext) error {
-	if ctx.PgDriver == nil {
-		return errors.New("Postgres DB not provided")
+	var c pgWriterConfig
+	if err := ctx.Decode(&c); err != nil {
+		return err
+	}
+
+	db, err := InitPGClient(&c.PostgresService)
+	if err != nil {
+		return err
 	}
-	p.db = ctx.PgDriver
+
+	if c.AutoMigrate {
+		_, _, err = postgresMigrations.migrate(db)
+	} else {
+		err = postgresMigrations.check(db)
+	}
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	p.db = db
+	p.urn = ctx.urnBuilder()
 	return nil
 }
 
+func (p *PGLineageWriter) Migrate(ctx *WriterContext) (int, int, error) {
+	var c config.PostgresService
+	if err := ctx.Decode(&c); err != nil {
+		return 0, 0, err
+	}
+
+	db, err := InitPGClient(&c)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	return postgresMigrations.migrate(db)
+}
+
+func (p *PGLineageWriter) Rename(ctx *WriterContext, from *URNBuilder) (RenameResult, error) {
+	var c config.PostgresService
+	if err := ctx.Decode(&c); err != nil {
+		return RenameResult{}, err
+	}
+
+	db, err := InitPGClient(&c)
+	if err != nil {
+		return RenameResult{}, err
+	}
+	defer db.Close()
+
+	if err := postgresMigrations.check(db); err != nil {
+		return RenameResult{}, err
+	}
+	return postgresRename.rename(db, from, ctx.urnBuilder())
+}
+
+func (p *PGLineageWriter) Close() error {
+	if p.db == nil {
+		return nil
+	}
+	return p.db.Close()
+}
+
+// ResetGraph 只删除本部署（service 与 author 均匹配）写入的点，以及本部署写入的、下游节点已被删除的边
 func (w *PGLineageWriter) ResetGraph() error {
+	author, err := w.urn.ResetAuthor()
+	if err != nil {
+		return err
+	}
 
 	tx, err := w.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer rollbackOnError(tx, err)
-
-	smt := `
-		DELETE FROM manager.data_lineage_node WHERE service = 'greenplum' and type = 'greenplum-table';
-		DELETE FROM manager.data_lineage_node WHERE service = 'postgresql' and type = 'postgresql-table';
-		DELETE FROM manager.data_lineage_node WHERE service = 'grafana';
-		DELETE FROM manager.data_lineage_relationship WHERE down_node_name like '%:grafana:%';
-	`
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
 
-	if _, err = tx.Exec(smt); err != nil {
+	if _, err = tx.Exec(`
+		DELETE FROM manager.data_lineage_node WHERE service = $1 and type = 'greenplum-table' and author = $2;`,
+		w.urn.Service("greenplum"), author,
+	); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`
+		DELETE FROM manager.data_lineage_node WHERE service = $1 and type = 'postgresql-table' and author = $2;`,
+		w.urn.Service("postgresql"), author,
+	); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`
+		DELETE FROM manager.data_lineage_node WHERE service = $1 and author = $2;`,
+		w.urn.Service("grafana"), author,
+	); err != nil {
+		return err
+	}
+	// 节点名可配置后不能再按 '%:grafana:%' 匹配，改为清理下游节点已被删除的边
+	if _, err = tx.Exec(`
+		DELETE FROM manager.data_lineage_relationship r
+		WHERE r.author = $1
+		  AND NOT EXISTS (SELECT 1 FROM manager.data_lineage_node n WHERE n.node_name = r.down_node_name);`,
+		author,
+	); err != nil {
 		return err
 	}
 
@@ -70,44 +163,34 @@ func (w *PGLineageWriter) WriteDashboardNode(d *service.DashboardFullWithMeta, s
 	if err != nil {
 		return err
 	}
-	defer rollbackOnError(tx, err)
-
-	pics, _ := json.Marshal(lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}))
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
 
-	smt := fmt.Sprintf(`
+	smt := `
 		INSERT INTO manager.data_lineage_node(
 			node_name, site, service, domain, node, attribute, type, cdt, udt, author
 		) VALUES (
-			'%s:grafana:%s:%s>%s', 
-			'%s', 'grafana', '%s', '%s>%s',
-			jsonb_build_object(
-				'created', '%s',
-				'updated', '%s',
-				'created_by', '%s',
-				'updated_by', '%s',
-				'dashboard_title', '%s',
-				'dashboard_uid', '%s',
-				'description', '%s',
-				'pic', '%s'::jsonb
-			),
-			'dashboard', now(), now(), 'ITC180012'
+			$1, $2, $3, $4, $5, $6::jsonb, 'dashboard', now(), now(), $7
 		)
-		ON CONFLICT (node_name) DO NOTHING;`,
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title,
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title,
-		d.Meta.Created,
-		d.Meta.Updated,
-		d.Meta.CreatedBy,
-		d.Meta.UpdatedBy,
-		d.Dashboard.Title,
-		d.Dashboard.UID,
-		d.Dashboard.Description,
-		pics,
-	)
+		ON CONFLICT (node_name) DO NOTHING;`
+
+	attribute := mustJSON(map[string]any{
+		"created":         d.Meta.Created.String(),
+		"updated":         d.Meta.Updated.String(),
+		"created_by":      d.Meta.CreatedBy,
+		"updated_by":      d.Meta.UpdatedBy,
+		"dashboard_title": d.Dashboard.Title,
+		"dashboard_uid":   d.Dashboard.UID,
+		"description":     d.Dashboard.Description,
+		"pic":             lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}),
+	})
 
 	log.Debug(smt)
 
-	if _, err = tx.Exec(smt); err != nil {
+	if _, err = tx.Exec(smt,
+		w.urn.Dashboard(d, s), w.urn.Site(s.Zone), w.urn.Service("grafana"), s.Host,
+		fmt.Sprintf("%s>%s", d.Meta.FolderTitle, d.Dashboard.Title),
+		attribute, w.urn.Author(),
+	); err != nil {
 		return err
 	}
 
@@ -119,48 +202,38 @@ func (w *PGLineageWriter) WritePanelNode(p *service.Panel, d *service.DashboardF
 	if err != nil {
 		return err
 	}
-	defer rollbackOnError(tx, err)
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
 
-	pics, _ := json.Marshal(lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}))
+	nodeName := w.urn.Panel(p, d, s)
 
-	smt := fmt.Sprintf(`
+	smt := `
 		INSERT INTO manager.data_lineage_node(
 			node_name, site, service, domain, node, attribute, type, cdt, udt, author)
 		VALUES (
-			'%s:grafana:%s:%s>%s>%s', 
-			'%s', 'grafana', '%s', '%s>%s>%s', 
-			jsonb_build_object(
-				'created', '%s',
-				'updated', '%s',
-				'created_by', '%s',
-				'updated_by', '%s',
-				'panel_type', '%s',
-				'panel_title', '%s',
-				'dashboard_uid', '%s',
-				'dashboard_title', '%s',
-				'description', regexp_replace('%s', '^0x', ''),
-				'pic', '%s'::jsonb
-			),
-			'dashboard-panel', now(), now(), 'ITC180012'
+			$1, $2, $3, $4, $5, $6::jsonb, 'dashboard-panel', now(), now(), $7
 		)
-		ON CONFLICT (node_name) DO NOTHING;`,
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title, p.Title, // node_name
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title, p.Title, // domain, node
-		d.Meta.Created,
-		d.Meta.Updated,
-		d.Meta.CreatedBy,
-		d.Meta.UpdatedBy,
-		p.Type,
-		p.Title,
-		d.Dashboard.UID,
-		d.Dashboard.Title,
-		p.Description,
-		pics,
-	)
+		ON CONFLICT (node_name) DO NOTHING;`
+
+	attribute := mustJSON(map[string]any{
+		"created":         d.Meta.Created.String(),
+		"updated":         d.Meta.Updated.String(),
+		"created_by":      d.Meta.CreatedBy,
+		"updated_by":      d.Meta.UpdatedBy,
+		"panel_type":      p.Type,
+		"panel_title":     p.Title,
+		"dashboard_uid":   d.Dashboard.UID,
+		"dashboard_title": d.Dashboard.Title,
+		"description":     strings.TrimPrefix(p.Description, "0x"),
+		"pic":             lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}),
+	})
 
 	// log.Debug(smt)
 
-	if _, err = tx.Exec(smt); err != nil {
+	if _, err = tx.Exec(smt,
+		nodeName, w.urn.Site(s.Zone), w.urn.Service("grafana"), s.Host,
+		fmt.Sprintf("%s>%s>%s", d.Meta.FolderTitle, d.Dashboard.Title, p.Title),
+		attribute, w.urn.Author(),
+	); err != nil {
 		return err
 	}
 
@@ -169,14 +242,12 @@ func (w *PGLineageWriter) WritePanelNode(p *service.Panel, d *service.DashboardF
 			INSERT INTO manager.sql_analysis (
 				db_name, sql_script, type, name, datamap_type, input_pic, cdt, udt)
 			VALUES (
-				$1, $2, 'query', $3, 'node', 'ITC180012', now(), now()
+				$1, $2, 'query', $3, 'node', $4, now(), now()
 			)
 			ON CONFLICT ON CONSTRAINT sql_analysis_pkey DO NOTHING;
 		`
 
-		nodeName := fmt.Sprintf("%s:grafana:%s:%s>%s>%s", s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title, p.Title)
-
-		if _, err := tx.Exec(stmt, ds.Label, dep.RawSql, nodeName); err != nil {
+		if _, err := tx.Exec(stmt, ds.Label, dep.RawSql, nodeName, w.urn.Author()); err != nil {
 			return err
 		}
 	}
@@ -184,45 +255,36 @@ func (w *PGLineageWriter) WritePanelNode(p *service.Panel, d *service.DashboardF
 	return tx.Commit()
 }
 
+const pgInsertRelationship = `
+	INSERT INTO manager.data_lineage_relationship(
+		up_node_name,
+		down_node_name,
+		type,
+		attribute,
+		cdt,
+		udt,
+		name,
+		author
+	) VALUES (
+		$1, $2, $3, '{}', now(), now(), $4, $5
+	)
+	ON CONFLICT (name) DO NOTHING;`
+
 func (w *PGLineageWriter) WriteTable2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
 	tx, err := w.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer rollbackOnError(tx, err)
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
 
+	down := w.urn.Panel(p, d, s)
 	for _, dep := range dependencies {
 		for _, t := range dep.Tables {
-			smt := fmt.Sprintf(`
-				INSERT INTO manager.data_lineage_relationship(
-					up_node_name, 
-					down_node_name, 
-					type, 
-					attribute, 
-					cdt, 
-					udt, 
-					name, 
-					author
-				) VALUES (
-					'%s:%s:%s:%s.%s.%s', 
-					'%s:grafana:%s:%s>%s>%s', 
-					'data_logic', 
-					'{}', 
-					now(), 
-					now(), 
-					md5('%s:%s:%s:%s.%s.%s' || '_' || '%s:grafana:%s:%s>%s>%s' || '_' || '{}'::varchar), 
-					'ITC180012'
-				)
-				ON CONFLICT (name) DO NOTHING;`,
-				ds.Zone, ds.Type, t.Database, ds.DBName, t.SchemaName, t.RelName,
-				s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title, p.Title,
-				ds.Zone, ds.Type, t.Database, ds.DBName, t.SchemaName, t.RelName,
-				s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title, p.Title,
-			)
-
-			// log.Debug(smt)
+			up := w.urn.Table(ds, t.Database, t.GetID())
 
-			if _, err = tx.Exec(smt); err != nil {
+			if _, err = tx.Exec(pgInsertRelationship,
+				up, down, "data_logic", w.urn.EdgeName(up, down, "{}"), w.urn.Author(),
+			); err != nil {
 				return err
 			}
 		}
@@ -237,163 +299,238 @@ func (w *PGLineageWriter) WriteDash2PanelEdge(p *service.Panel, d *service.Dashb
 	if err != nil {
 		return err
 	}
-	defer rollbackOnError(tx, err)
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
 
-	smt := fmt.Sprintf(`
-		INSERT INTO manager.data_lineage_relationship(
-			up_node_name, 
-			down_node_name, 
-			type, 
-			attribute, 
-			cdt, 
-			udt, 
-			name, 
-			author
-		) VALUES (
-			'%s:grafana:%s:%s>%s', 
-			'%s:grafana:%s:%s>%s>%s', 
-			'contain', 
-			'{}', 
-			now(),
-			now(),
-			md5('%s:grafana:%s:%s>%s' || '_' || '%s:grafana:%s:%s>%s>%s' || '_' || '{}'::varchar), 
-			'ITC180012'
-		)
-		ON CONFLICT (name) DO NOTHING;`,
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title,
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title, p.Title,
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title,
-		s.Zone, s.Host, d.Meta.FolderTitle, d.Dashboard.Title, p.Title,
-	)
-
-	// log.Debug(smt)
+	up, down := w.urn.Dashboard(d, s), w.urn.Panel(p, d, s)
 
-	if _, err = tx.Exec(smt); err != nil {
+	if _, err = tx.Exec(pgInsertRelationship,
+		up, down, "contain", w.urn.EdgeName(up, down, "{}"), w.urn.Author(),
+	); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
-func rollbackOnError(tx *sql.Tx, err error) {
-	if p := recover(); p != nil {
-		tx.Rollback()
-		panic(p)
-	}
-	if err != nil {
-		tx.Rollback()
-	}
-}
-
-// 创建图中节点
+// 创建图中节点，重复写入时 calls 累加
 func (w *PGLineageWriter) WriteTableNode(r *service.Table, s config.PostgresService) error {
 	tx, err := w.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer rollbackOnError(tx, err)
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
 
-	smt := fmt.Sprintf(`
+	smt := `
 		INSERT INTO manager.data_lineage_node(
 			node_name, site, service, domain, node, attribute, type, cdt, udt, author)
 		VALUES (
-			'%s:%s:%s:%s.%s.%s',
-			'%s', '%s', '%s', '%s.%s.%s',
-			jsonb_build_object(
-				'site', '%s',
-				'pic', '',
-				'database', '%s',
-				'schema', '%s',
-				'tablename', '%s',
-				'relpersistence', '%s',
-				'calls', %d,
-				'seq_scan', 0,
-				'seq_tup_read', 0,
-				'idx_scan', 0,
-				'idx_tup_fetch', 0,
-				'description', ''
-			),
-			'%s-table', now(), now(), 'ITC180012'
+			$1, $2, $3, $4, $5, $6::jsonb, $7, now(), now(), $8
 		)
 		ON CONFLICT (node_name) DO UPDATE
 		SET udt = now(),
 			attribute = jsonb_set(
 				EXCLUDED.attribute,
 				'{calls}',
-				to_jsonb( ((EXCLUDED.attribute->>'calls')::bigint + %d) )
-		);`,
-		s.Zone, s.Type, r.Database, s.DBName, r.SchemaName, r.RelName,
-		s.Zone, s.Type, r.Database, s.DBName, r.SchemaName, r.RelName,
-		s.Zone, s.DBName, r.SchemaName, r.RelName, r.RelPersistence, r.Calls,
-		s.Type,
-		r.Calls,
-	)
+				to_jsonb(coalesce((data_lineage_node.attribute->>'calls')::bigint, 0) + $9)
+		);`
+
+	attribute := mustJSON(tableAttribute(w.urn.Site(s.Zone), r, s))
 
 	// log.Debug(smt)
 
-	if _, err = tx.Exec(smt); err != nil {
+	if _, err = tx.Exec(smt,
+		w.urn.Table(s, r.Database, r.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), r.Database,
+		fmt.Sprintf("%s.%s.%s", s.DBName, r.SchemaName, r.RelName),
+		attribute, s.Type+"-table", w.urn.Author(),
+		r.Calls,
+	); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
-// 创建图中边
-func (w *PGLineageWriter) WriteFuncEdge(r *service.Udf, s config.PostgresService) error {
+// tableAttribute 表节点初次写入时的属性，postgres、sqlite 共用
+func tableAttribute(site string, r *service.Table, s config.PostgresService) map[string]any {
+	return map[string]any{
+		"site":           site,
+		"pic":            "",
+		"database":       s.DBName,
+		"schema":         r.SchemaName,
+		"tablename":      r.RelName,
+		"relpersistence": r.RelPersistence,
+		"calls":          r.Calls,
+		"seq_scan":       0,
+		"seq_tup_read":   0,
+		"idx_scan":       0,
+		"idx_tup_fetch":  0,
+		"description":    "",
+	}
+}
 
-	return nil
+// 创建表之外的节点，type 为节点种类，重复写入时合并属性
+func (w *PGLineageWriter) WriteNode(n depgraph.Node, database string, s config.PostgresService) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
+
+	smt := `
+		INSERT INTO manager.data_lineage_node(
+			node_name, site, service, domain, node, attribute, type, cdt, udt, author)
+		VALUES (
+			$1, $2, $3, $4, $5, $6::jsonb, $7, now(), now(), $8
+		)
+		ON CONFLICT (node_name) DO UPDATE SET
+			udt = now(),
+			attribute = data_lineage_node.attribute || EXCLUDED.attribute;`
+
+	attribute := mustJSON(lo.Assign(map[string]any{
+		"site":     w.urn.Site(s.Zone),
+		"database": database,
+	}, n.GetAttributes()))
+
+	if _, err = tx.Exec(smt,
+		w.urn.Node(s, database, n, n.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), database,
+		n.GetID(), attribute, string(n.GetKind()), w.urn.Author(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// 创建图中边，同一个函数产生的同一对表之间只有一条边，calls 累加，与 SQLite 一致
+func (w *PGLineageWriter) WriteFuncEdge(e *depgraph.Edge, from, to depgraph.Node, r *service.Udf, s config.PostgresService) error {
+	up := w.urn.Node(s, r.Database, from, e.From)
+	down := w.urn.Node(s, r.Database, to, e.To)
+	attribute := mustJSON(map[string]any{
+		"database":   r.Database,
+		"schemaname": r.SchemaName,
+		"procname":   r.ProcName,
+	})
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
+
+	if _, err = tx.Exec(`
+		INSERT INTO manager.data_lineage_relationship(
+			up_node_name, down_node_name, type, attribute, cdt, udt, name, author)
+		VALUES (
+			$1, $2, 'data_logic', jsonb_set($3::jsonb, '{calls}', to_jsonb($4::bigint)), now(), now(), $5, $6
+		)
+		ON CONFLICT (name) DO UPDATE SET
+			udt = now(),
+			attribute = jsonb_set(
+				data_lineage_relationship.attribute,
+				'{calls}',
+				to_jsonb(coalesce((data_lineage_relationship.attribute->>'calls')::bigint, 0) + $4)
+		);`,
+		up, down, attribute, r.Calls, w.urn.EdgeName(up, down, attribute), w.urn.Author(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 创建 ERD 中的关联，type 为 join，同一对字段、同一种关联只有一条边，calls 累加；
+// 两端的表不存在时先创建，已存在的不修改，relpersistence、calls 以血缘写入的为准
+func (w *PGLineageWriter) WriteJoinEdge(j *service.Join, s config.PostgresService) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
+
+	for _, t := range []*service.Table{j.From, j.To} {
+		if _, err = tx.Exec(`
+			INSERT INTO manager.data_lineage_node(
+				node_name, site, service, domain, node, attribute, type, cdt, udt, author)
+			VALUES (
+				$1, $2, $3, $4, $5, $6::jsonb, $7, now(), now(), $8
+			)
+			ON CONFLICT (node_name) DO NOTHING;`,
+			w.urn.Table(s, j.Database, t.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), j.Database,
+			fmt.Sprintf("%s.%s.%s", s.DBName, t.SchemaName, t.RelName),
+			mustJSON(tableAttribute(w.urn.Site(s.Zone), t, s)), s.Type+"-table", w.urn.Author(),
+		); err != nil {
+			return err
+		}
+	}
+
+	up := w.urn.Table(s, j.Database, j.From.GetID())
+	down := w.urn.Table(s, j.Database, j.To.GetID())
+	attribute := mustJSON(j.GetAttributes())
+
+	if _, err = tx.Exec(`
+		INSERT INTO manager.data_lineage_relationship(
+			up_node_name, down_node_name, type, attribute, cdt, udt, name, author)
+		VALUES (
+			$1, $2, 'join', jsonb_set($3::jsonb, '{calls}', to_jsonb($4::bigint)), now(), now(), $5, $6
+		)
+		ON CONFLICT (name) DO UPDATE SET
+			udt = now(),
+			attribute = jsonb_set(
+				data_lineage_relationship.attribute,
+				'{calls}',
+				to_jsonb(coalesce((data_lineage_relationship.attribute->>'calls')::bigint, 0) + $4)
+		);`,
+		up, down, attribute, j.Calls, w.urn.EdgeName(up, down, attribute), w.urn.Author(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 补充表的统计信息和注释，已存在的节点只更新统计信息，保留累计的 calls，与 SQLite 一致
 func (w *PGLineageWriter) CompleteTableNode(r *service.Table, s config.PostgresService) error {
 	tx, err := w.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer rollbackOnError(tx, err)
+	defer tx.Rollback() // 出错或 panic 时回滚，Commit 之后为空操作
 
-	smt := fmt.Sprintf(`
+	smt := `
 		INSERT INTO manager.data_lineage_node(
 			node_name, site, service, domain, node, attribute, type, cdt, udt, author)
 		VALUES (
-			'%s:%s:%s:%s.%s.%s',
-			'%s', '%s', '%s', '%s.%s.%s',
-			jsonb_build_object(
-				'site', '%s',
-				'pic', '',
-				'database', '%s',
-				'schema', '%s',
-				'tablename', '%s',
-				'relpersistence', '%s',
-				'calls', %d,
-				'seq_scan', %d,
-				'seq_tup_read', %d,
-				'idx_scan', %d,
-				'idx_tup_fetch', %d,
-				'description', regexp_replace('%s', '^0x', '')
-			),
-			'%s-table', now(), now(), 'ITC180012'
+			$1, $2, $3, $4, $5, $6::jsonb, $7, now(), now(), $8
 		)
 		ON CONFLICT (node_name) DO UPDATE SET
 			udt = now(),
-			attribute = EXCLUDED.attribute || jsonb_build_object(
-				'calls', %d,
-				'seq_scan', %d,
-				'seq_tup_read', %d,
-				'idx_scan', %d,
-				'idx_tup_fetch', %d,
-				'description', regexp_replace('%s', '^0x', '')
-		);`,
-		s.Zone, s.Type, r.Database, s.DBName, r.SchemaName, r.RelName,
-		s.Zone, s.Type, r.Database, s.DBName, r.SchemaName, r.RelName,
-		s.Zone, r.Database, r.SchemaName, r.RelName, r.RelPersistence,
-		r.Calls, r.SeqScan, r.SeqTupRead, r.IdxScan, r.IdxTupFetch, r.Comment,
-		s.Type,
-		r.Calls, r.SeqScan, r.SeqTupRead, r.IdxScan, r.IdxTupFetch, r.Comment,
-	)
+			attribute = data_lineage_node.attribute || $9::jsonb;`
+
+	stats := map[string]any{
+		"seq_scan":      r.SeqScan,
+		"seq_tup_read":  r.SeqTupRead,
+		"idx_scan":      r.IdxScan,
+		"idx_tup_fetch": r.IdxTupFetch,
+		"description":   strings.TrimPrefix(r.Comment, "0x"),
+	}
+	attribute := mustJSON(lo.Assign(map[string]any{
+		"site":           w.urn.Site(s.Zone),
+		"pic":            "",
+		"database":       r.Database,
+		"schema":         r.SchemaName,
+		"tablename":      r.RelName,
+		"relpersistence": r.RelPersistence,
+		"calls":          r.Calls,
+	}, stats))
 
 	// log.Debug(smt)
 
-	if _, err = tx.Exec(smt); err != nil {
+	if _, err = tx.Exec(smt,
+		w.urn.Table(s, r.Database, r.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), r.Database,
+		fmt.Sprintf("%s.%s.%s", s.DBName, r.SchemaName, r.RelName),
+		attribute, s.Type+"-table", w.urn.Author(),
+		mustJSON(stats),
+	); err != nil {
 		return err
 	}
 
@@ -0,0 +1,89 @@
+package writer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Factory 返回一个未初始化的 writer，连接等资源在 Init 中根据配置创建
+type Factory func() LineageWriter
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register 注册一种存储后端，通常在各 writer 文件的 init 中调用
+// 与 database/sql 的驱动注册一致，重复注册或 factory 为空时直接 panic
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("writer: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("writer: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// Writers 返回已注册的后端名称，按字母序排列
+func Writers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (Factory, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	f, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown writer type %q (registered: %v)", name, Writers())
+	}
+	return f, nil
+}
+
+// WriterContext 传给 writer.Init 的上下文
+type WriterContext struct {
+	Type     string         // 后端类型，即注册名
+	Settings map[string]any // 该后端的专属配置，由 writer 自行解码
+	URN      *URNBuilder    // 点、边命名规则，所有 writer 共用
+}
+
+func (c *WriterContext) urnBuilder() *URNBuilder {
+	if c.URN != nil {
+		return c.URN
+	}
+	return defaultURNBuilder()
+}
+
+// Decode 将 Settings 解码到 writer 自己的配置结构体，字段按 mapstructure tag 匹配
+func (c *WriterContext) Decode(out any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(c.Settings); err != nil {
+		return fmt.Errorf("%s settings: %w", c.Type, err)
+	}
+	return nil
+}
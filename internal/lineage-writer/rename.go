@@ -0,0 +1,245 @@
+package writer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+// NodeRenamer 可选接口：按节点名去重的 writer 实现，命名规则变更后将已有数据迁移到新的命名
+type NodeRenamer interface {
+	Rename(ctx *WriterContext, from *URNBuilder) (RenameResult, error)
+}
+
+type RenameResult struct {
+	Nodes         int // 改名的节点数
+	Relationships int // 改名的边数
+	Skipped       int // 无法按旧模板解析的节点数
+}
+
+// renameDialect 各数据库的表名与占位符
+type renameDialect struct {
+	nodeTable     string
+	relTable      string
+	analysisTable string
+	attribute     string // 以文本形式读取 attribute 的表达式
+	placeholder   func(i int) string
+}
+
+var postgresRename = renameDialect{
+	nodeTable:     "manager.data_lineage_node",
+	relTable:      "manager.data_lineage_relationship",
+	analysisTable: "manager.sql_analysis",
+	attribute:     "attribute::text",
+	placeholder:   func(i int) string { return fmt.Sprintf("$%d", i) },
+}
+
+var sqliteRename = renameDialect{
+	nodeTable:     "data_lineage_node",
+	relTable:      "data_lineage_relationship",
+	analysisTable: "sql_analysis",
+	attribute:     "attribute",
+	placeholder:   func(int) string { return "?" },
+}
+
+// nodeKind 由 data_lineage_node.type 推断模板种类
+func nodeKind(typ string) string {
+	switch {
+	case strings.HasSuffix(typ, "-table"):
+		return memNodeTable
+	case typ == "dashboard":
+		return memNodeDashboard
+	case typ == "dashboard-panel":
+		return memNodePanel
+	}
+	// 其他种类写入时 type 即为 depgraph.NodeKind
+	return typ
+}
+
+// identityAttribute 边名只对不随写入变化的属性取 md5，calls 等累计值不参与；
+// 重新序列化以消除不同数据库 JSON 文本格式的差异
+func identityAttribute(attribute string) string {
+	var attrs map[string]any
+	if err := json.Unmarshal([]byte(attribute), &attrs); err != nil {
+		return attribute
+	}
+	delete(attrs, "calls")
+	return mustJSON(attrs)
+}
+
+// renameTemp 两步改名时的临时前缀，不会出现在按模板生成的名称中
+const renameTemp = "\x01pg_lineage_rename:"
+
+// renameNode 更新节点名及 sql_analysis 中引用它的行
+func (d renameDialect) renameNode(tx *sql.Tx, oldName, newName string) error {
+	p1, p2 := d.placeholder(1), d.placeholder(2)
+	if _, err := tx.Exec(`UPDATE `+d.nodeTable+` SET node_name = `+p1+` WHERE node_name = `+p2, newName, oldName); err != nil {
+		return fmt.Errorf("rename node %q: %w", strings.TrimPrefix(oldName, renameTemp), err)
+	}
+	if _, err := tx.Exec(`UPDATE `+d.analysisTable+` SET name = `+p1+` WHERE name = `+p2, newName, oldName); err != nil {
+		return fmt.Errorf("rename sql_analysis %q: %w", strings.TrimPrefix(oldName, renameTemp), err)
+	}
+	return nil
+}
+
+// rename 用旧模板反解节点名、新模板重新生成，在一个事务中更新点、边及 sql_analysis
+func (d renameDialect) rename(db *sql.DB, from, to *URNBuilder) (res RenameResult, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		}
+	}()
+
+	p1, p2, p3 := d.placeholder(1), d.placeholder(2), d.placeholder(3)
+
+	renamed := make(map[string]string)
+	rows, err := tx.Query(`SELECT node_name, type FROM ` + d.nodeTable)
+	if err != nil {
+		return res, err
+	}
+	for rows.Next() {
+		var name, typ string
+		if err = rows.Scan(&name, &typ); err != nil {
+			rows.Close()
+			return res, err
+		}
+		kind := nodeKind(typ)
+		vars, ok := from.Parse(kind, name)
+		if !ok {
+			log.Warnf("Rename skip node %q: does not match the old %s template", name, kind)
+			res.Skipped++
+			continue
+		}
+		if newName := to.Render(kind, vars); newName != name {
+			renamed[name] = newName
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	// 先改为临时名再改为新名，链式改名（A→B、B→C）或互换时不会在中途与唯一索引冲突
+	olds := make([]string, 0, len(renamed))
+	for oldName := range renamed {
+		olds = append(olds, oldName)
+	}
+	sort.Strings(olds)
+	for _, oldName := range olds {
+		if err = d.renameNode(tx, oldName, renameTemp+oldName); err != nil {
+			return res, err
+		}
+	}
+	for _, oldName := range olds {
+		if err = d.renameNode(tx, renameTemp+oldName, renamed[oldName]); err != nil {
+			return res, err
+		}
+		res.Nodes++
+	}
+
+	type relationship struct{ name, up, down, attribute string }
+	var rels []relationship
+	rows, err = tx.Query(`SELECT name, up_node_name, down_node_name, ` + d.attribute + ` FROM ` + d.relTable)
+	if err != nil {
+		return res, err
+	}
+	for rows.Next() {
+		var r relationship
+		if err = rows.Scan(&r.name, &r.up, &r.down, &r.attribute); err != nil {
+			rows.Close()
+			return res, err
+		}
+		rels = append(rels, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	type relRename struct{ oldName, name, up, down string }
+	var relRenames []relRename
+	for _, r := range rels {
+		attribute := identityAttribute(r.attribute)
+		// 只处理按旧规则生成的边，其他来源写入的边保持不变
+		if from.EdgeName(r.up, r.down, attribute) != r.name {
+			continue
+		}
+
+		up, down := r.up, r.down
+		if n, ok := renamed[up]; ok {
+			up = n
+		}
+		if n, ok := renamed[down]; ok {
+			down = n
+		}
+		name := to.EdgeName(up, down, attribute)
+		if name == r.name && up == r.up && down == r.down {
+			continue
+		}
+		relRenames = append(relRenames, relRename{oldName: r.name, name: name, up: up, down: down})
+	}
+
+	// 边名同样分两步更新
+	for _, r := range relRenames {
+		if _, err = tx.Exec(`UPDATE `+d.relTable+` SET name = `+p1+` WHERE name = `+p2, renameTemp+r.oldName, r.oldName); err != nil {
+			return res, fmt.Errorf("rename relationship %s: %w", r.oldName, err)
+		}
+	}
+	for _, r := range relRenames {
+		if _, err = tx.Exec(
+			`UPDATE `+d.relTable+` SET name = `+p1+`, up_node_name = `+p2+`, down_node_name = `+p3+` WHERE name = `+d.placeholder(4),
+			r.name, r.up, r.down, renameTemp+r.oldName,
+		); err != nil {
+			return res, fmt.Errorf("rename relationship %s: %w", r.oldName, err)
+		}
+		res.Relationships++
+	}
+
+	return res, tx.Commit()
+}
+
+// Rename 对所有启用且实现了 NodeRenamer 的 writer，将按 from 规则命名的数据迁移到当前配置的规则
+func Rename(cfg *config.StorageConfig, from config.NamingConfig) error {
+	fromURN, err := NewURNBuilder(from)
+	if err != nil {
+		return fmt.Errorf("old naming: %w", err)
+	}
+	toURN, err := NewURNBuilder(cfg.Naming)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, wc := range cfg.EnabledWriters() {
+		factory, err := lookup(wc.Type)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		r, ok := factory().(NodeRenamer)
+		if !ok {
+			log.Infof("Lineage writer %s does not support rename", wc.Type)
+			continue
+		}
+
+		res, err := r.Rename(&WriterContext{Type: wc.Type, Settings: wc.Settings, URN: toURN}, fromURN)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rename %s writer: %w", wc.Type, err))
+			continue
+		}
+		log.Infof("Lineage writer %s renamed %d nodes, %d relationships, skipped %d nodes",
+			wc.Type, res.Nodes, res.Relationships, res.Skipped)
+	}
+	return errors.Join(errs...)
+}
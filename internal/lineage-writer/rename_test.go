@@ -0,0 +1,87 @@
+package writer
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"pg_lineage/pkg/config"
+)
+
+func TestRenameChainAndSwap(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to string
+		nodes    []string
+		want     []string
+	}{
+		// a -> ax、ax -> axx，按 a 先改时会与尚未改名的 ax 冲突
+		{"chain", "{{.Name}}", "{{.Name}}x", []string{"a", "ax"}, []string{"ax", "axx"}},
+		// p:q 与 q:p 互换
+		{"swap", "{{.Zone}}:{{.Name}}", "{{.Name}}:{{.Zone}}", []string{"p:q", "q:p"}, []string{"p:q", "q:p"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			from, err := NewURNBuilder(config.NamingConfig{Node: tc.from})
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := NewURNBuilder(config.NamingConfig{Node: tc.to})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := newSQLiteWriter(t)
+			for _, n := range tc.nodes {
+				if _, err := w.db.Exec(sqliteInsertNode, n, "", "", "", n, "{}", "file", ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			edge := from.EdgeName(tc.nodes[0], tc.nodes[1], "{}")
+			if _, err := w.db.Exec(sqliteInsertRelationship, edge, tc.nodes[0], tc.nodes[1], "data_logic", "{}", ""); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := sqliteRename.rename(w.db, from, to)
+			if err != nil {
+				t.Fatalf("rename: %v", err)
+			}
+			if res.Nodes != 2 || res.Relationships != 1 {
+				t.Errorf("result = %+v", res)
+			}
+
+			var names []string
+			rows, err := w.db.Query(`SELECT node_name FROM data_lineage_node`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var n string
+				rows.Scan(&n)
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("nodes = %v, want %v", names, tc.want)
+			}
+
+			var name, up, down string
+			if err := w.db.QueryRow(`SELECT name, up_node_name, down_node_name FROM data_lineage_relationship`).Scan(&name, &up, &down); err != nil {
+				t.Fatal(err)
+			}
+			wantUp, wantDown := to.Render("file", mustParse(t, from, tc.nodes[0])), to.Render("file", mustParse(t, from, tc.nodes[1]))
+			if up != wantUp || down != wantDown || name != to.EdgeName(wantUp, wantDown, "{}") {
+				t.Errorf("relationship = %s %s -> %s", name, up, down)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, b *URNBuilder, name string) URNVars {
+	t.Helper()
+	v, ok := b.Parse("file", name)
+	if !ok {
+		t.Fatalf("parse %q", name)
+	}
+	return v
+}
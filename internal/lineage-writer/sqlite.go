@@ -0,0 +1,367 @@
+package writer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+
+	"github.com/samber/lo"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type sqliteConfig struct {
+	Path string `mapstructure:"path"` // 数据库文件路径，不存在时自动创建
+}
+
+// SQLiteLineageWriter 将血缘写入本地 SQLite 文件，点、边模型与 upsert 语义同 PGLineageWriter，
+// 适合没有 Neo4j 和 manager 库的单机部署
+type SQLiteLineageWriter struct {
+	db  *sql.DB
+	urn *URNBuilder
+}
+
+func init() {
+	Register("sqlite", func() LineageWriter { return &SQLiteLineageWriter{} })
+}
+
+func openSQLite(ctx *WriterContext) (*sql.DB, error) {
+	conf := sqliteConfig{Path: "pg_lineage.db"}
+	if err := ctx.Decode(&conf); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+conf.Path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open err: %w", err)
+	}
+	// SQLite 只允许单个写连接，避免 database is locked
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// 本地文件只有本进程使用，Init 时直接升级到最新版本，版本比二进制新时拒绝写入
+func (w *SQLiteLineageWriter) Init(ctx *WriterContext) error {
+	db, err := openSQLite(ctx)
+	if err != nil {
+		return err
+	}
+	if _, _, err := sqliteMigrations.migrate(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	w.db = db
+	w.urn = ctx.urnBuilder()
+	return nil
+}
+
+func (w *SQLiteLineageWriter) Migrate(ctx *WriterContext) (int, int, error) {
+	db, err := openSQLite(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	return sqliteMigrations.migrate(db)
+}
+
+func (w *SQLiteLineageWriter) Rename(ctx *WriterContext, from *URNBuilder) (RenameResult, error) {
+	db, err := openSQLite(ctx)
+	if err != nil {
+		return RenameResult{}, err
+	}
+	defer db.Close()
+
+	if err := sqliteMigrations.check(db); err != nil {
+		return RenameResult{}, err
+	}
+	return sqliteRename.rename(db, from, ctx.urnBuilder())
+}
+
+func (w *SQLiteLineageWriter) Close() error {
+	if w.db == nil {
+		return nil
+	}
+	return w.db.Close()
+}
+
+// exec 在一个事务中执行多条语句，任一失败则回滚
+func (w *SQLiteLineageWriter) exec(fn func(tx *sql.Tx) error) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+// ResetGraph 与 postgres 一致，只删除本部署（service 与 author 均匹配）写入的数据
+func (w *SQLiteLineageWriter) ResetGraph() error {
+	author, err := w.urn.ResetAuthor()
+	if err != nil {
+		return err
+	}
+
+	return w.exec(func(tx *sql.Tx) error {
+		for _, stmt := range []struct {
+			query string
+			args  []any
+		}{
+			{`DELETE FROM data_lineage_node WHERE service = ? AND type = 'greenplum-table' AND author = ?`, []any{w.urn.Service("greenplum"), author}},
+			{`DELETE FROM data_lineage_node WHERE service = ? AND type = 'postgresql-table' AND author = ?`, []any{w.urn.Service("postgresql"), author}},
+			{`DELETE FROM data_lineage_node WHERE service = ? AND author = ?`, []any{w.urn.Service("grafana"), author}},
+			{`DELETE FROM data_lineage_relationship
+			  WHERE author = ?
+			    AND (up_node_name NOT IN (SELECT node_name FROM data_lineage_node)
+			     OR down_node_name NOT IN (SELECT node_name FROM data_lineage_node))`, []any{author}},
+		} {
+			if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func mustJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+const sqliteInsertNode = `
+	INSERT INTO data_lineage_node (node_name, site, service, domain, node, attribute, type, author)
+	VALUES (?, ?, ?, ?, ?, json(?), ?, ?)
+`
+
+const sqliteInsertRelationship = `
+	INSERT INTO data_lineage_relationship (name, up_node_name, down_node_name, type, attribute, author)
+	VALUES (?, ?, ?, ?, json(?), ?)
+`
+
+func (w *SQLiteLineageWriter) WriteDashboardNode(d *service.DashboardFullWithMeta, s config.GrafanaService) error {
+	return w.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteInsertNode+` ON CONFLICT (node_name) DO NOTHING`,
+			w.urn.Dashboard(d, s), w.urn.Site(s.Zone), w.urn.Service("grafana"), s.Host,
+			fmt.Sprintf("%s>%s", d.Meta.FolderTitle, d.Dashboard.Title),
+			mustJSON(map[string]any{
+				"created":         d.Meta.Created.String(),
+				"updated":         d.Meta.Updated.String(),
+				"created_by":      d.Meta.CreatedBy,
+				"updated_by":      d.Meta.UpdatedBy,
+				"dashboard_title": d.Dashboard.Title,
+				"dashboard_uid":   d.Dashboard.UID,
+				"description":     d.Dashboard.Description,
+				"pic":             lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}),
+			}),
+			"dashboard", w.urn.Author(),
+		)
+		return err
+	})
+}
+
+func (w *SQLiteLineageWriter) WritePanelNode(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
+	nodeName := w.urn.Panel(p, d, s)
+
+	return w.exec(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(sqliteInsertNode+` ON CONFLICT (node_name) DO NOTHING`,
+			nodeName, w.urn.Site(s.Zone), w.urn.Service("grafana"), s.Host,
+			fmt.Sprintf("%s>%s>%s", d.Meta.FolderTitle, d.Dashboard.Title, p.Title),
+			mustJSON(map[string]any{
+				"created":         d.Meta.Created.String(),
+				"updated":         d.Meta.Updated.String(),
+				"created_by":      d.Meta.CreatedBy,
+				"updated_by":      d.Meta.UpdatedBy,
+				"panel_type":      p.Type,
+				"panel_title":     p.Title,
+				"dashboard_uid":   d.Dashboard.UID,
+				"dashboard_title": d.Dashboard.Title,
+				"description":     strings.TrimPrefix(p.Description, "0x"),
+				"pic":             lo.Uniq([]string{d.Meta.CreatedBy, d.Meta.UpdatedBy}),
+			}),
+			"dashboard-panel", w.urn.Author(),
+		); err != nil {
+			return err
+		}
+
+		for _, dep := range dependencies {
+			if _, err := tx.Exec(`
+				INSERT INTO sql_analysis (db_name, sql_script, type, name, datamap_type, input_pic)
+				VALUES (?, ?, 'query', ?, 'node', ?)
+				ON CONFLICT DO NOTHING`,
+				ds.Label, dep.RawSql, nodeName, w.urn.Author(),
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (w *SQLiteLineageWriter) WriteDash2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService) error {
+	up, down := w.urn.Dashboard(d, s), w.urn.Panel(p, d, s)
+
+	return w.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteInsertRelationship+` ON CONFLICT (name) DO NOTHING`,
+			w.urn.EdgeName(up, down, "{}"), up, down, "contain", "{}", w.urn.Author(),
+		)
+		return err
+	})
+}
+
+func (w *SQLiteLineageWriter) WriteTable2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, dependencies []*service.SqlTableDependency, ds config.PostgresService) error {
+	down := w.urn.Panel(p, d, s)
+
+	return w.exec(func(tx *sql.Tx) error {
+		for _, dep := range dependencies {
+			for _, t := range dep.Tables {
+				up := w.urn.Table(ds, t.Database, t.GetID())
+				if _, err := tx.Exec(sqliteInsertRelationship+` ON CONFLICT (name) DO NOTHING`,
+					w.urn.EdgeName(up, down, "{}"), up, down, "data_logic", "{}", w.urn.Author(),
+				); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// 创建图中节点，重复写入时与 postgres 一致：属性以本次写入的为准，calls 累加
+func (w *SQLiteLineageWriter) WriteTableNode(r *service.Table, s config.PostgresService) error {
+	return w.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteInsertNode+`
+			ON CONFLICT (node_name) DO UPDATE SET
+				udt = CURRENT_TIMESTAMP,
+				attribute = json_set(
+					json_patch(data_lineage_node.attribute, excluded.attribute),
+					'$.calls', coalesce(json_extract(data_lineage_node.attribute, '$.calls'), 0) + json_extract(excluded.attribute, '$.calls')
+				)`,
+			w.urn.Table(s, r.Database, r.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), r.Database,
+			fmt.Sprintf("%s.%s.%s", s.DBName, r.SchemaName, r.RelName),
+			mustJSON(tableAttribute(w.urn.Site(s.Zone), r, s)),
+			s.Type+"-table", w.urn.Author(),
+		)
+		return err
+	})
+}
+
+// 创建表之外的节点，type 为节点种类，重复写入时合并属性
+func (w *SQLiteLineageWriter) WriteNode(n depgraph.Node, database string, s config.PostgresService) error {
+	return w.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteInsertNode+`
+			ON CONFLICT (node_name) DO UPDATE SET
+				udt = CURRENT_TIMESTAMP,
+				attribute = json_patch(data_lineage_node.attribute, excluded.attribute)`,
+			w.urn.Node(s, database, n, n.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), database,
+			n.GetID(),
+			mustJSON(lo.Assign(map[string]any{
+				"site":     w.urn.Site(s.Zone),
+				"database": database,
+			}, n.GetAttributes())),
+			string(n.GetKind()), w.urn.Author(),
+		)
+		return err
+	})
+}
+
+// 创建图中边，同一函数在同一对节点间只保留一条边，calls 累加
+func (w *SQLiteLineageWriter) WriteFuncEdge(e *depgraph.Edge, from, to depgraph.Node, r *service.Udf, s config.PostgresService) error {
+	up := w.urn.Node(s, r.Database, from, e.From)
+	down := w.urn.Node(s, r.Database, to, e.To)
+	attribute := mustJSON(map[string]any{
+		"database":   r.Database,
+		"schemaname": r.SchemaName,
+		"procname":   r.ProcName,
+	})
+
+	return w.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO data_lineage_relationship (name, up_node_name, down_node_name, type, attribute, author)
+			VALUES (?, ?, ?, 'data_logic', json_set(json(?), '$.calls', ?), ?)
+			ON CONFLICT (name) DO UPDATE SET
+				udt = CURRENT_TIMESTAMP,
+				attribute = json_set(
+					data_lineage_relationship.attribute,
+					'$.calls', coalesce(json_extract(data_lineage_relationship.attribute, '$.calls'), 0) + json_extract(excluded.attribute, '$.calls')
+				)`,
+			w.urn.EdgeName(up, down, attribute), up, down, attribute, r.Calls, w.urn.Author(),
+		)
+		return err
+	})
+}
+
+// 创建 ERD 中的关联，type 为 join，同一对字段、同一种关联只有一条边，calls 累加；
+// 两端的表不存在时先创建，已存在的不修改
+func (w *SQLiteLineageWriter) WriteJoinEdge(j *service.Join, s config.PostgresService) error {
+	up := w.urn.Table(s, j.Database, j.From.GetID())
+	down := w.urn.Table(s, j.Database, j.To.GetID())
+	attribute := mustJSON(j.GetAttributes())
+
+	return w.exec(func(tx *sql.Tx) error {
+		for _, t := range []*service.Table{j.From, j.To} {
+			if _, err := tx.Exec(sqliteInsertNode+`ON CONFLICT (node_name) DO NOTHING`,
+				w.urn.Table(s, j.Database, t.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), j.Database,
+				fmt.Sprintf("%s.%s.%s", s.DBName, t.SchemaName, t.RelName),
+				mustJSON(tableAttribute(w.urn.Site(s.Zone), t, s)), s.Type+"-table", w.urn.Author(),
+			); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO data_lineage_relationship (name, up_node_name, down_node_name, type, attribute, author)
+			VALUES (?, ?, ?, 'join', json_set(json(?), '$.calls', ?), ?)
+			ON CONFLICT (name) DO UPDATE SET
+				udt = CURRENT_TIMESTAMP,
+				attribute = json_set(
+					data_lineage_relationship.attribute,
+					'$.calls', coalesce(json_extract(data_lineage_relationship.attribute, '$.calls'), 0) + json_extract(excluded.attribute, '$.calls')
+				)`,
+			w.urn.EdgeName(up, down, attribute), up, down, attribute, j.Calls, w.urn.Author(),
+		)
+		return err
+	})
+}
+
+// 补充表的统计信息和注释，已存在的节点保留累计的 calls
+func (w *SQLiteLineageWriter) CompleteTableNode(r *service.Table, s config.PostgresService) error {
+	stats := map[string]any{
+		"seq_scan":      r.SeqScan,
+		"seq_tup_read":  r.SeqTupRead,
+		"idx_scan":      r.IdxScan,
+		"idx_tup_fetch": r.IdxTupFetch,
+		"description":   strings.TrimPrefix(r.Comment, "0x"),
+	}
+	attribute := lo.Assign(map[string]any{
+		"site":           w.urn.Site(s.Zone),
+		"pic":            "",
+		"database":       r.Database,
+		"schema":         r.SchemaName,
+		"tablename":      r.RelName,
+		"relpersistence": r.RelPersistence,
+		"calls":          r.Calls,
+	}, stats)
+
+	return w.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteInsertNode+`
+			ON CONFLICT (node_name) DO UPDATE SET
+				udt = CURRENT_TIMESTAMP,
+				attribute = json_patch(data_lineage_node.attribute, json(?))`,
+			w.urn.Table(s, r.Database, r.GetID()), w.urn.Site(s.Zone), w.urn.Service(s.Type), r.Database,
+			fmt.Sprintf("%s.%s.%s", s.DBName, r.SchemaName, r.RelName),
+			mustJSON(attribute),
+			s.Type+"-table", w.urn.Author(),
+			mustJSON(stats),
+		)
+		return err
+	})
+}
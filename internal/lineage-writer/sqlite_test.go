@@ -0,0 +1,120 @@
+package writer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "writer-test")
+	if err != nil {
+		panic(err)
+	}
+	// migrate 时会写日志
+	if err := log.InitLogger(&config.LogConfig{Level: "error", Path: filepath.Join(dir, "test.log")}); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newSQLiteWriter(t *testing.T) *SQLiteLineageWriter {
+	t.Helper()
+	w := &SQLiteLineageWriter{}
+	if err := w.Init(&WriterContext{Type: "sqlite", Settings: map[string]any{"path": filepath.Join(t.TempDir(), "lineage.db")}}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+// sqliteNodeAttribute 表节点的 attribute，id 为 schema.table
+func sqliteNodeAttribute(t *testing.T, w *SQLiteLineageWriter, s config.PostgresService, id string) map[string]any {
+	t.Helper()
+	var raw string
+	if err := w.db.QueryRow(`SELECT attribute FROM data_lineage_node WHERE node_name = ?`, w.urn.Table(s, s.Label, id)).Scan(&raw); err != nil {
+		t.Fatalf("%s: %v", id, err)
+	}
+	var attr map[string]any
+	if err := json.Unmarshal([]byte(raw), &attr); err != nil {
+		t.Fatal(err)
+	}
+	return attr
+}
+
+func TestSQLiteWriteTableNodeRefreshesAttributes(t *testing.T) {
+	w := newSQLiteWriter(t)
+	s := config.PostgresService{Label: "dw", Zone: "z", DBName: "dwdb", Type: service.DBTypePostgres}
+
+	if err := w.WriteTableNode(&service.Table{Database: "dw", SchemaName: "dw", RelName: "t", RelPersistence: service.REL_PERSIST, Calls: 2}, s); err != nil {
+		t.Fatalf("WriteTableNode: %v", err)
+	}
+	if err := w.CompleteTableNode(&service.Table{Database: "dw", SchemaName: "dw", RelName: "t", SeqScan: 7, Comment: "old"}, s); err != nil {
+		t.Fatalf("CompleteTableNode: %v", err)
+	}
+	// 与 postgres 一致，再次写入时属性以本次为准，只有 calls 累加
+	if err := w.WriteTableNode(&service.Table{Database: "dw", SchemaName: "dw", RelName: "t", RelPersistence: service.REL_PERSIST_UNLOGGED, Calls: 3}, s); err != nil {
+		t.Fatalf("WriteTableNode: %v", err)
+	}
+
+	attr := sqliteNodeAttribute(t, w, s, "dw.t")
+	if attr["calls"] != 5.0 {
+		t.Errorf("calls = %v, want 5", attr["calls"])
+	}
+	if attr["relpersistence"] != service.REL_PERSIST_UNLOGGED || attr["seq_scan"] != 0.0 || attr["description"] != "" {
+		t.Errorf("attribute = %v, want the second write", attr)
+	}
+}
+
+func TestSQLiteResetGraphScopedByAuthor(t *testing.T) {
+	w := newSQLiteWriter(t)
+	s := config.PostgresService{Label: "dw", Zone: "z", DBName: "dwdb", Type: service.DBTypePostgres}
+
+	if err := w.ResetGraph(); err == nil {
+		t.Fatal("ResetGraph: want error with the default author")
+	}
+
+	// 另一个部署写入的表
+	other, err := NewURNBuilder(config.NamingConfig{Author: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.urn = other
+	if err := w.WriteTableNode(&service.Table{Database: "dw", SchemaName: "dw", RelName: "kept"}, s); err != nil {
+		t.Fatal(err)
+	}
+
+	mine, err := NewURNBuilder(config.NamingConfig{Author: "me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.urn = mine
+	if err := w.WriteTableNode(&service.Table{Database: "dw", SchemaName: "dw", RelName: "dropped"}, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ResetGraph(); err != nil {
+		t.Fatalf("ResetGraph: %v", err)
+	}
+
+	var names []string
+	rows, err := w.db.Query(`SELECT author FROM data_lineage_node`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n string
+		rows.Scan(&n)
+		names = append(names, n)
+	}
+	if len(names) != 1 || names[0] != "other" {
+		t.Errorf("authors left = %v, want [other]", names)
+	}
+}
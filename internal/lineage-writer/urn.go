@@ -0,0 +1,320 @@
+package writer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+)
+
+// 默认命名与历史数据保持一致
+const (
+	DefaultTableURN     = "{{.Zone}}:{{.Type}}:{{.Label}}:{{.DBName}}.{{.Schema}}.{{.Table}}"
+	DefaultDashboardURN = "{{.Zone}}:grafana:{{.Host}}:{{.Folder}}>{{.Dashboard}}"
+	DefaultPanelURN     = "{{.Zone}}:grafana:{{.Host}}:{{.Folder}}>{{.Dashboard}}>{{.Panel}}"
+	DefaultNodeURN      = "{{.Zone}}:{{.Kind}}:{{.Label}}:{{.Name}}"
+	DefaultEdgeName     = "{{.Up}}_{{.Down}}_{{.Attribute}}"
+	DefaultAuthor       = "ITC180012"
+)
+
+// URNVars 命名模板中可用的变量
+type URNVars struct {
+	Zone   string // 数据源或 Grafana 的 zone
+	Type   string // 数据源类型：postgresql | greenplum
+	Label  string // 数据源 label，即 Table.Database
+	DBName string
+	Schema string
+	Table  string
+
+	Host         string // Grafana host
+	Folder       string
+	Dashboard    string
+	DashboardUID string
+	Panel        string
+
+	Kind string // 表、看板、面板之外的节点种类：file | external | function 等
+	Name string // 此类节点在图中的 ID
+}
+
+// EdgeVars 边名模板中可用的变量
+type EdgeVars struct {
+	Up        string
+	Down      string
+	Attribute string // 边属性的 JSON 文本
+}
+
+// URNBuilder 按配置的模板生成点、边的唯一标识，以及写入时附带的 author / site / service
+type URNBuilder struct {
+	conf      config.NamingConfig
+	authorSet bool // author 是否为配置的值，而非默认值
+
+	table, dashboard, panel, node, edge *template.Template
+}
+
+// NewURNBuilder 未配置的模板、author 使用默认值
+func NewURNBuilder(c config.NamingConfig) (*URNBuilder, error) {
+	if c.Table == "" {
+		c.Table = DefaultTableURN
+	}
+	if c.Dashboard == "" {
+		c.Dashboard = DefaultDashboardURN
+	}
+	if c.Panel == "" {
+		c.Panel = DefaultPanelURN
+	}
+	if c.Node == "" {
+		c.Node = DefaultNodeURN
+	}
+	if c.Edge == "" {
+		c.Edge = DefaultEdgeName
+	}
+	authorSet := c.Author != ""
+	if !authorSet {
+		c.Author = DefaultAuthor
+	}
+
+	b := &URNBuilder{conf: c, authorSet: authorSet}
+	for _, t := range []struct {
+		name string
+		text string
+		vars any
+		dst  **template.Template
+	}{
+		{"table", c.Table, URNVars{}, &b.table},
+		{"dashboard", c.Dashboard, URNVars{}, &b.dashboard},
+		{"panel", c.Panel, URNVars{}, &b.panel},
+		{"node", c.Node, URNVars{}, &b.node},
+		{"edge", c.Edge, EdgeVars{}, &b.edge},
+	} {
+		tpl, err := template.New(t.name).Parse(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("naming.%s: %w", t.name, err)
+		}
+		// 用空变量试渲染一次，尽早暴露字段名拼写错误
+		if err := tpl.Execute(&bytes.Buffer{}, t.vars); err != nil {
+			return nil, fmt.Errorf("naming.%s: %w", t.name, err)
+		}
+		*t.dst = tpl
+	}
+	return b, nil
+}
+
+// defaultURNBuilder 供未经 InitWriterManager 创建的 writer 使用
+func defaultURNBuilder() *URNBuilder {
+	b, err := NewURNBuilder(config.NamingConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func render(t *template.Template, data any) string {
+	var buf bytes.Buffer
+	// 模板在 NewURNBuilder 中已校验过
+	_ = t.Execute(&buf, data)
+	return buf.String()
+}
+
+// splitTableID 将 Table.GetID() 的结果拆为 schema 和表名
+func splitTableID(id string) (string, string) {
+	if schema, table, ok := strings.Cut(id, "."); ok {
+		return schema, table
+	}
+	return "", id
+}
+
+func (b *URNBuilder) TableVars(s config.PostgresService, database, id string) URNVars {
+	schema, table := splitTableID(id)
+	return URNVars{Zone: s.Zone, Type: s.Type, Label: database, DBName: s.DBName, Schema: schema, Table: table}
+}
+
+func (b *URNBuilder) DashboardVars(d *service.DashboardFullWithMeta, s config.GrafanaService) URNVars {
+	return URNVars{Zone: s.Zone, Host: s.Host, Folder: d.Meta.FolderTitle, Dashboard: d.Dashboard.Title, DashboardUID: d.Dashboard.UID}
+}
+
+// Table 表节点名，id 为 schema.table
+func (b *URNBuilder) Table(s config.PostgresService, database, id string) string {
+	return render(b.table, b.TableVars(s, database, id))
+}
+
+func (b *URNBuilder) Dashboard(d *service.DashboardFullWithMeta, s config.GrafanaService) string {
+	return render(b.dashboard, b.DashboardVars(d, s))
+}
+
+func (b *URNBuilder) Panel(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService) string {
+	v := b.DashboardVars(d, s)
+	v.Panel = p.Title
+	return render(b.panel, v)
+}
+
+// Node 图中任意节点的名字，表、视图及未加入图的边端点（n 为 nil）与 Table 一致，其余种类用 node 模板
+func (b *URNBuilder) Node(s config.PostgresService, database string, n depgraph.Node, id string) string {
+	if n == nil || isTableKind(n.GetKind()) {
+		return b.Table(s, database, id)
+	}
+	return render(b.node, URNVars{Zone: s.Zone, Type: s.Type, Label: database, DBName: s.DBName, Kind: string(n.GetKind()), Name: id})
+}
+
+// isTableKind 视图与表共用表的命名和写入方式
+func isTableKind(kind depgraph.NodeKind) bool {
+	return kind == "" || kind == depgraph.KindTable || kind == depgraph.KindView
+}
+
+// EdgeName 边的唯一名：按模板拼接后取 md5
+func (b *URNBuilder) EdgeName(up, down, attribute string) string {
+	sum := md5.Sum([]byte(render(b.edge, EdgeVars{Up: up, Down: down, Attribute: attribute})))
+	return hex.EncodeToString(sum[:])
+}
+
+func (b *URNBuilder) Author() string {
+	return b.conf.Author
+}
+
+// ResetAuthor ResetGraph 按 author 删除数据，使用默认 author 的部署会互相删除对方写入的行，必须显式配置
+func (b *URNBuilder) ResetAuthor() (string, error) {
+	if !b.authorSet {
+		return "", fmt.Errorf("reset requires storage.naming.author to be set explicitly, the default %q may be shared with other deployments", DefaultAuthor)
+	}
+	return b.conf.Author, nil
+}
+
+// Site 未配置时取 zone
+func (b *URNBuilder) Site(zone string) string {
+	if b.conf.Site != "" {
+		return b.conf.Site
+	}
+	return zone
+}
+
+// Service 数据源类型对应的 service 标签，未配置映射时原样返回
+func (b *URNBuilder) Service(typ string) string {
+	if label, ok := b.conf.Services[typ]; ok {
+		return label
+	}
+	return typ
+}
+
+// Parse 按模板反解节点名，rename 时用旧模板取出变量再用新模板渲染；
+// kind 为 table | dashboard | panel，其余非空的种类按 node 模板
+func (b *URNBuilder) Parse(kind, name string) (URNVars, bool) {
+	var text string
+	switch kind {
+	case "":
+		return URNVars{}, false
+	case memNodeTable:
+		text = b.conf.Table
+	case memNodeDashboard:
+		text = b.conf.Dashboard
+	case memNodePanel:
+		text = b.conf.Panel
+	default:
+		text = b.conf.Node
+	}
+
+	re, fields, err := templateRegexp(text)
+	if err != nil {
+		return URNVars{}, false
+	}
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return URNVars{}, false
+	}
+
+	var v URNVars
+	for i, f := range fields {
+		if ptr := v.field(f); ptr != nil {
+			*ptr = m[i+1]
+		}
+	}
+	return v, true
+}
+
+// Render 用指定种类的模板渲染变量
+func (b *URNBuilder) Render(kind string, v URNVars) string {
+	switch kind {
+	case memNodeDashboard:
+		return render(b.dashboard, v)
+	case memNodePanel:
+		return render(b.panel, v)
+	case memNodeTable, "":
+		return render(b.table, v)
+	}
+	return render(b.node, v)
+}
+
+func (v *URNVars) field(name string) *string {
+	switch name {
+	case "Zone":
+		return &v.Zone
+	case "Type":
+		return &v.Type
+	case "Label":
+		return &v.Label
+	case "DBName":
+		return &v.DBName
+	case "Schema":
+		return &v.Schema
+	case "Table":
+		return &v.Table
+	case "Host":
+		return &v.Host
+	case "Folder":
+		return &v.Folder
+	case "Dashboard":
+		return &v.Dashboard
+	case "DashboardUID":
+		return &v.DashboardUID
+	case "Panel":
+		return &v.Panel
+	case "Kind":
+		return &v.Kind
+	case "Name":
+		return &v.Name
+	}
+	return nil
+}
+
+var templateField = regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`)
+
+// templateRegexp 只支持由 {{.Field}} 和普通文本组成的模板，相邻字段之间必须有分隔符
+func templateRegexp(text string) (*regexp.Regexp, []string, error) {
+	var (
+		pattern strings.Builder
+		fields  []string
+		last    int
+	)
+	literal := func(s string) error {
+		if strings.Contains(s, "{{") {
+			return fmt.Errorf("template %q uses actions other than {{.Field}}", text)
+		}
+		pattern.WriteString(regexp.QuoteMeta(s))
+		return nil
+	}
+
+	pattern.WriteString("^")
+	for _, loc := range templateField.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] == last && last > 0 {
+			return nil, nil, fmt.Errorf("adjacent fields in template %q cannot be parsed", text)
+		}
+		if err := literal(text[last:loc[0]]); err != nil {
+			return nil, nil, err
+		}
+		pattern.WriteString("(.*?)")
+		fields = append(fields, text[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	if err := literal(text[last:]); err != nil {
+		return nil, nil, err
+	}
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	return re, fields, err
+}
@@ -1,7 +1,8 @@
 package writer
 
 import (
-	"database/sql"
+	"errors"
+	"fmt"
 	"pg_lineage/internal/service"
 	"pg_lineage/pkg/config"
 	"pg_lineage/pkg/depgraph"
@@ -9,35 +10,38 @@ import (
 	"strings"
 
 	"sync"
-
-	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 )
 
-type WriterContext struct {
-	Neo4jDriver neo4j.Driver // 可选
-	PgDriver    *sql.DB      // 可选：标准 Go SQL DB 接口
-}
-
-func InitWriterManager(ctx *WriterContext) *WriterManager {
+// InitWriterManager 按配置创建并初始化所有启用的 writer，任一失败则关闭已创建的并返回错误
+func InitWriterManager(cfg *config.StorageConfig) (*WriterManager, error) {
 	defaultWriterManager := &WriterManager{}
 
 	defaultWriterManager.mu.Lock()
 	defer defaultWriterManager.mu.Unlock()
 
-	// 根据上下文注册需要的 writer
-	if ctx.Neo4jDriver != nil {
-		w := &Neo4jLineageWriter{}
-		w.Init(ctx)
-
-		defaultWriterManager.writers = append(defaultWriterManager.writers, w)
+	urn, err := NewURNBuilder(cfg.Naming)
+	if err != nil {
+		return nil, err
 	}
-	if ctx.PgDriver != nil {
-		w := &PGLineageWriter{}
-		w.Init(ctx)
-		defaultWriterManager.writers = append(defaultWriterManager.writers, w)
+
+	for _, wc := range cfg.EnabledWriters() {
+		factory, err := lookup(wc.Type)
+		if err != nil {
+			defaultWriterManager.closeWriters()
+			return nil, err
+		}
+
+		w := factory()
+		if err := w.Init(&WriterContext{Type: wc.Type, Settings: wc.Settings, URN: urn}); err != nil {
+			defaultWriterManager.closeWriters()
+			return nil, fmt.Errorf("init %s writer: %w", wc.Type, err)
+		}
+
+		log.Infof("Lineage writer enabled: %s", wc.Type)
+		defaultWriterManager.writers = append(defaultWriterManager.writers, namedWriter{name: wc.Type, LineageWriter: w})
 	}
 
-	return defaultWriterManager
+	return defaultWriterManager, nil
 }
 
 type LineageWriter interface {
@@ -47,36 +51,67 @@ type LineageWriter interface {
 	WriteDash2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService) error
 	WriteTable2PanelEdge(p *service.Panel, d *service.DashboardFullWithMeta, s config.GrafanaService, t []*service.SqlTableDependency, ds config.PostgresService) error
 	WriteTableNode(t *service.Table, s config.PostgresService) error
-	WriteFuncEdge(t *service.Udf, s config.PostgresService) error
+	// WriteNode 写入表之外的节点（文件、外部系统、函数等），按 GetKind / GetAttributes 序列化，database 为图的 namespace
+	WriteNode(n depgraph.Node, database string, s config.PostgresService) error
+	// WriteFuncEdge e 的两端为不含 namespace 的节点 ID，from / to 为对应的节点，未加入图的端点为 nil，按表处理
+	WriteFuncEdge(e *depgraph.Edge, from, to depgraph.Node, udf *service.Udf, s config.PostgresService) error
+	// WriteJoinEdge ERD 中两张表按字段的关联，两端的表与血缘共用节点，重复写入时 calls 累加；
+	// 两端的表不存在时以 calls 为 0 创建，已存在的不修改
+	WriteJoinEdge(j *service.Join, s config.PostgresService) error
 	CompleteTableNode(t *service.Table, s config.PostgresService) error
 	ResetGraph() error
+	Close() error // 写完缓存并释放连接
+}
+
+// GraphWriter 可选接口：需要以一次 UDF 调用或一条查询为单位处理整张血缘图的 writer 实现，
+// 例如 OpenLineage 的 RunEvent。CreateGraphPostgres 在写完点和边后调用
+type GraphWriter interface {
+	WriteGraph(graph *depgraph.Graph, udf *service.Udf, s config.PostgresService) error
 }
 
 type LineageWriterFunc func(LineageWriter) error
 
+// namedWriter 记录 writer 的注册名，便于在错误信息中定位后端
+type namedWriter struct {
+	name string
+	LineageWriter
+}
+
 type WriterManager struct {
-	writers []LineageWriter
+	writers []namedWriter
 	mu      sync.RWMutex
 }
 
-func (w *WriterManager) Close() {
+func (w *WriterManager) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.closeWriters()
+}
+
+func (w *WriterManager) closeWriters() error {
+	var errs []error
 	for _, writer := range w.writers {
-		if neo4jWriter, ok := writer.(*Neo4jLineageWriter); ok {
-			neo4jWriter.session.Close()
-		}
-		if pgWriter, ok := writer.(*PGLineageWriter); ok {
-			pgWriter.db.Close()
+		if err := writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s writer: %w", writer.name, err))
 		}
 	}
+	w.writers = nil
+	return errors.Join(errs...)
 }
 
+// apply 依次调用每个 writer，单个失败不影响其余 writer，错误汇总后返回
 func (w *WriterManager) apply(fn LineageWriterFunc) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var errs []error
 	for _, writer := range w.writers {
-		if err := fn(writer); err != nil {
-			log.Error(err)
+		if err := fn(writer.LineageWriter); err != nil {
+			errs = append(errs, fmt.Errorf("%s writer: %w", writer.name, err))
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func (w *WriterManager) writeDashboardNode(d *service.DashboardFullWithMeta, s config.GrafanaService) error {
@@ -109,9 +144,30 @@ func (w *WriterManager) writeTableNode(t *service.Table, s config.PostgresServic
 	})
 }
 
-func (w *WriterManager) writeFuncEdge(t *service.Udf, s config.PostgresService) error {
+func (w *WriterManager) writeNode(n depgraph.Node, database string, s config.PostgresService) error {
+	return w.apply(func(writer LineageWriter) error {
+		return writer.WriteNode(n, database, s)
+	})
+}
+
+func (w *WriterManager) writeFuncEdge(e *depgraph.Edge, from, to depgraph.Node, udf *service.Udf, s config.PostgresService) error {
 	return w.apply(func(writer LineageWriter) error {
-		return writer.WriteFuncEdge(t, s)
+		return writer.WriteFuncEdge(e, from, to, udf, s)
+	})
+}
+
+func (w *WriterManager) writeJoinEdge(j *service.Join, s config.PostgresService) error {
+	return w.apply(func(writer LineageWriter) error {
+		return writer.WriteJoinEdge(j, s)
+	})
+}
+
+func (w *WriterManager) writeGraph(g *depgraph.Graph, udf *service.Udf, s config.PostgresService) error {
+	return w.apply(func(writer LineageWriter) error {
+		if gw, ok := writer.(GraphWriter); ok {
+			return gw.WriteGraph(g, udf, s)
+		}
+		return nil
 	})
 }
 
@@ -153,38 +209,71 @@ func (w *WriterManager) CreateGraphGrafana(p *service.Panel, d *service.Dashboar
 func (w *WriterManager) CreateGraphPostgres(graph *depgraph.Graph, udf *service.Udf, s config.PostgresService) error {
 
 	log.Infof("ShrinkGraph: %+v", graph)
-	for i, layer := range graph.TopoSortedLayers() {
+	layers, err := graph.TopoSortedLayers()
+	for i, layer := range layers {
 		log.Infof("ShrinkGraph %d: %s", i, strings.Join(layer, ", "))
 	}
+	if err != nil {
+		log.Warnf("ShrinkGraph of %s: %v", udf.GetID(), err)
+	}
 
-	// 创建点
-	for _, v := range graph.GetNodes() {
-		r, _ := v.(*service.Table)
+	var errs []error
 
+	// 创建点
+	nodes := graph.GetNodes()
+	for _, v := range nodes {
 		// Graph 中可能出现临时节点，该临时节点就是最终生成的数据集合
-		if r.IsTemp() {
-			log.Warnf("Ignore temp node: %+v", r)
+		if v.IsTemp() {
+			log.Warnf("Ignore temp node: %+v", v)
+			continue
+		}
+
+		// 表需累计 calls，保留原有的写入方式；其余种类的节点按 kind 和属性通用写入
+		r, ok := v.(*service.Table)
+		if !ok {
+			if err := w.writeNode(v, graph.GetNamespace(), s); err != nil {
+				errs = append(errs, err)
+			}
 			continue
 		}
 
 		r.Database = graph.GetNamespace()
 		r.Calls = udf.Calls
 
-		w.writeTableNode(r, s)
+		if err := w.writeTableNode(r, s); err != nil {
+			errs = append(errs, err)
+		}
 	}
 	// 创建线
-	for k, v := range graph.GetRelationships() {
-		for kk := range v {
+	udf.Database = graph.GetNamespace()
+	for _, e := range graph.Edges() {
+		// 自环只用于报告环，不写入存储
+		if e.From == e.To {
+			continue
+		}
+		if err := w.writeFuncEdge(e, nodes[e.From], nodes[e.To], udf, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-			udf.SrcID = k // 不含 namespace
-			udf.DestID = kk
-			udf.Database = graph.GetNamespace()
+	if err := w.writeGraph(graph, udf, s); err != nil {
+		errs = append(errs, err)
+	}
 
-			w.writeFuncEdge(udf, s)
+	return errors.Join(errs...)
+}
+
+// CreateGraphERD 写入一条查询（或一个函数）中表间的关联，两端的表与 CreateGraphPostgres 写入的为同一节点；
+// 表节点不经 WriteTableNode 写入，以免覆盖血缘中的 relpersistence、calls
+func (w *WriterManager) CreateGraphERD(joins []*service.Join, s config.PostgresService) error {
+	var errs []error
+	for _, j := range joins {
+		if err := w.writeJoinEdge(j, s); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // func filterEmptySchema(dependencies []*service.Table) []*service.Table {
@@ -0,0 +1,236 @@
+package lineage
+
+import (
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/log"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// ColumnRef 指向某张表的某个字段
+type ColumnRef struct {
+	Table  *service.Table
+	Column string
+}
+
+// ColumnLineage 目标字段及其来源字段
+type ColumnLineage struct {
+	Target  ColumnRef
+	Sources []ColumnRef
+}
+
+// ParseColumnLineage 解析 INSERT INTO ... (cols) SELECT / CREATE TABLE ... AS 的字段级血缘
+// 只处理能静态确定来源的字段：带表别名的字段，或 FROM 中只有一张表时的裸字段
+// INSERT 未写字段列表时，目标字段依赖表结构，暂不处理
+func ParseColumnLineage(sql string) ([]*ColumnLineage, error) {
+	result, err := pg_query.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*ColumnLineage
+	for _, s := range result.Stmts {
+		if ctas := s.Stmt.GetCreateTableAsStmt(); ctas != nil {
+			target := parseRangeVar(ctas.GetInto().GetRel())
+			colNames := resTargetNames(ctas.GetInto().GetColNames())
+			records = append(records, selectColumnLineage(target, colNames, ctas.GetQuery().GetSelectStmt())...)
+		}
+
+		if is := s.Stmt.GetInsertStmt(); is != nil && len(is.GetCols()) > 0 {
+			target := parseRangeVar(is.GetRelation())
+			colNames := resTargetNames(is.GetCols())
+			records = append(records, selectColumnLineage(target, colNames, is.GetSelectStmt().GetSelectStmt())...)
+		}
+	}
+
+	return records, nil
+}
+
+// ParseUDFColumnLineage 对函数体内的每条 SQL 做字段级血缘解析
+func ParseUDFColumnLineage(plpgsql string) ([]*ColumnLineage, error) {
+	stmts, err := UDFStatements(plpgsql)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*ColumnLineage
+	for _, stmt := range stmts {
+		r, err := ParseColumnLineage(stmt)
+		if err != nil {
+			log.Debugf("ParseColumnLineage err: %s, sql: %s", err, stmt)
+			continue
+		}
+		records = append(records, r...)
+	}
+
+	return records, nil
+}
+
+func resTargetNames(nodes []*pg_query.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if rt := n.GetResTarget(); rt != nil {
+			names = append(names, rt.GetName())
+		} else if s := n.GetString_(); s != nil {
+			names = append(names, s.GetSval())
+		}
+	}
+	return names
+}
+
+// 按位置将目标字段与 SELECT 输出列对应
+func selectColumnLineage(target *service.Table, colNames []string, ss *pg_query.SelectStmt) []*ColumnLineage {
+	if ss == nil {
+		return nil
+	}
+
+	outputs := selectOutputs(ss)
+
+	var records []*ColumnLineage
+	for i, out := range outputs {
+		name := out.name
+		if i < len(colNames) {
+			name = colNames[i]
+		} else if len(colNames) > 0 {
+			break
+		}
+		if name == "" || len(out.sources) == 0 {
+			continue
+		}
+
+		records = append(records, &ColumnLineage{
+			Target:  ColumnRef{Table: target, Column: name},
+			Sources: out.sources,
+		})
+	}
+
+	return records
+}
+
+type selectOutput struct {
+	name    string
+	sources []ColumnRef
+}
+
+// SELECT 的输出列，UNION 时左右两侧同位置的来源合并
+func selectOutputs(ss *pg_query.SelectStmt) []selectOutput {
+	if ss.GetOp() != pg_query.SetOperation_SETOP_NONE {
+		left := selectOutputs(ss.GetLarg())
+		right := selectOutputs(ss.GetRarg())
+		for i := range left {
+			if i < len(right) {
+				left[i].sources = append(left[i].sources, right[i].sources...)
+			}
+		}
+		return left
+	}
+
+	scope := make(map[string]*service.Table)
+	for _, fc := range ss.GetFromClause() {
+		collectFromScope(fc, scope)
+	}
+
+	var outputs []selectOutput
+	for _, t := range ss.GetTargetList() {
+		rt := t.GetResTarget()
+		if rt == nil {
+			continue
+		}
+
+		out := selectOutput{name: rt.GetName()}
+		if out.name == "" {
+			if fields := rt.GetVal().GetColumnRef().GetFields(); len(fields) > 0 {
+				out.name = fields[len(fields)-1].GetString_().GetSval()
+			}
+		}
+
+		for _, ref := range exprColumnRefs(rt.GetVal()) {
+			if c, ok := resolveColumnRef(ref, scope); ok {
+				out.sources = append(out.sources, c)
+			}
+		}
+		outputs = append(outputs, out)
+	}
+
+	return outputs
+}
+
+// 记录 FROM 中可见的表及其别名，子查询无法直接对应到物理表，跳过
+func collectFromScope(node *pg_query.Node, scope map[string]*service.Table) {
+	if rv := node.GetRangeVar(); rv != nil {
+		t := parseRangeVar(rv)
+		alias := rv.GetAlias().GetAliasname()
+		if alias == "" {
+			alias = rv.GetRelname()
+		}
+		scope[alias] = t
+	}
+	if je := node.GetJoinExpr(); je != nil {
+		collectFromScope(je.GetLarg(), scope)
+		collectFromScope(je.GetRarg(), scope)
+	}
+}
+
+func resolveColumnRef(ref *pg_query.ColumnRef, scope map[string]*service.Table) (ColumnRef, bool) {
+	fields := ref.GetFields()
+
+	switch len(fields) {
+	case 1:
+		// 裸字段只有在 FROM 中仅有一张表时才能确定归属
+		if len(scope) != 1 || fields[0].GetString_() == nil {
+			return ColumnRef{}, false
+		}
+		for _, t := range scope {
+			return ColumnRef{Table: t, Column: fields[0].GetString_().GetSval()}, true
+		}
+	case 2:
+		t, ok := scope[fields[0].GetString_().GetSval()]
+		if !ok || fields[1].GetString_() == nil {
+			return ColumnRef{}, false
+		}
+		return ColumnRef{Table: t, Column: fields[1].GetString_().GetSval()}, true
+	}
+
+	return ColumnRef{}, false
+}
+
+// 收集表达式中引用到的字段，子查询不展开
+func exprColumnRefs(node *pg_query.Node) []*pg_query.ColumnRef {
+	if node == nil {
+		return nil
+	}
+
+	var refs []*pg_query.ColumnRef
+	walk := func(nodes ...*pg_query.Node) {
+		for _, n := range nodes {
+			refs = append(refs, exprColumnRefs(n)...)
+		}
+	}
+
+	switch {
+	case node.GetColumnRef() != nil:
+		refs = append(refs, node.GetColumnRef())
+	case node.GetAExpr() != nil:
+		walk(node.GetAExpr().GetLexpr(), node.GetAExpr().GetRexpr())
+	case node.GetFuncCall() != nil:
+		walk(node.GetFuncCall().GetArgs()...)
+	case node.GetTypeCast() != nil:
+		walk(node.GetTypeCast().GetArg())
+	case node.GetCoalesceExpr() != nil:
+		walk(node.GetCoalesceExpr().GetArgs()...)
+	case node.GetMinMaxExpr() != nil:
+		walk(node.GetMinMaxExpr().GetArgs()...)
+	case node.GetBoolExpr() != nil:
+		walk(node.GetBoolExpr().GetArgs()...)
+	case node.GetNullTest() != nil:
+		walk(node.GetNullTest().GetArg())
+	case node.GetCaseExpr() != nil:
+		ce := node.GetCaseExpr()
+		walk(ce.GetArg(), ce.GetDefresult())
+		for _, w := range ce.GetArgs() {
+			walk(w.GetCaseWhen().GetExpr(), w.GetCaseWhen().GetResult())
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,91 @@
+package lineage
+
+import (
+	"errors"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/internal/service"
+	"pg_lineage/pkg/depgraph"
+	"pg_lineage/pkg/log"
+)
+
+// ResolveTables 用 catalog 补全表名：不带 schema 的表按 search_path 找到所在 schema，分区、子表记到最顶层的父表上。
+// CTE、临时表不处理；catalog 中找不到的表保持原样，之后仍按未解析的表去掉
+func ResolveTables(c catalog.Catalog, g *depgraph.Graph) *depgraph.Graph {
+	if c == nil || g == nil {
+		return g
+	}
+
+	resolved := make(map[string]depgraph.Node, len(g.GetNodes()))
+	changed := false
+	for id, n := range g.GetNodes() {
+		resolved[id] = n
+		t, ok := n.(*service.Table)
+		if !ok {
+			continue
+		}
+		if r := resolveTable(c, t); r != nil {
+			resolved[id] = r
+			changed = changed || r.GetID() != id
+		}
+	}
+	if !changed {
+		return g
+	}
+
+	out := depgraph.New()
+	out.SetNamespace(g.GetNamespace())
+	for _, n := range resolved {
+		if _, ok := out.GetNodes()[n.GetID()]; !ok {
+			out.AddNode(n)
+		}
+	}
+	// 多个分区合并到父表后，同一对表之间的边按 MergeEdge 累加
+	for _, e := range g.Edges() {
+		out.MergeEdge(out.GetNodes()[resolved[e.From].GetID()], out.GetNodes()[resolved[e.To].GetID()], *e)
+	}
+	return out
+}
+
+// resolveTable 返回补全后的表，无需改动或 catalog 中找不到时返回 nil
+func resolveTable(c catalog.Catalog, t *service.Table) *service.Table {
+	switch t.Class() {
+	case depgraph.ClassCTE, depgraph.ClassTemp:
+		return nil
+	}
+
+	schema := t.SchemaName
+	if schema == "" {
+		r, err := catalog.ResolveRelation(c, t.RelName)
+		if err != nil {
+			logLookup(t, err)
+			return nil
+		}
+		schema = r.Schema
+	}
+
+	r, err := catalog.PartitionRoot(c, schema, t.RelName)
+	if err != nil {
+		logLookup(t, err)
+		return nil
+	}
+	if r.Schema == t.SchemaName && r.Name == t.RelName {
+		return nil
+	}
+
+	return &service.Table{
+		Database:       t.Database,
+		SchemaName:     r.Schema,
+		RelName:        r.Name,
+		RelPersistence: r.Persistence,
+		RelKind:        r.Kind,
+	}
+}
+
+func logLookup(t *service.Table, err error) {
+	if errors.Is(err, catalog.ErrNotFound) {
+		log.Debugf("ResolveTables: %s: %v", t.GetID(), err)
+		return
+	}
+	log.Warnf("ResolveTables: %s: %v", t.GetID(), err)
+}
@@ -0,0 +1,101 @@
+package lineage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/depgraph"
+	"pg_lineage/pkg/log"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "lineage-test")
+	if err != nil {
+		panic(err)
+	}
+	// 解析 SQL 时会写日志
+	if err := log.InitLogger(&config.LogConfig{Level: "error", Path: filepath.Join(dir, "test.log")}); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func testCatalog() *catalog.Snapshot {
+	return &catalog.Snapshot{
+		Version: catalog.SnapshotVersion,
+		Schemas: []string{"ods", "public"},
+		Relations: []catalog.Relation{
+			{Schema: "dw", Name: "orders", Kind: catalog.RelKindPartitionedTable},
+			{Schema: "dw", Name: "orders_2024_01", Kind: catalog.RelKindTable, Parents: []string{"dw.orders"}},
+			{Schema: "dw", Name: "orders_2024_02", Kind: catalog.RelKindTable, Parents: []string{"dw.orders"}},
+			{Schema: "ods", Name: "users", Kind: catalog.RelKindTable},
+			{Schema: "public", Name: "items", Kind: catalog.RelKindTable},
+		},
+	}
+}
+
+func nodeIDs(g *depgraph.Graph) string {
+	ids := make([]string, 0, len(g.GetNodes()))
+	for id := range g.GetNodes() {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestResolveTables(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		sql   string
+		nodes string
+		edges [][2]string
+	}{
+		{
+			name:  "search_path",
+			sql:   "insert into dw.orders_2024_01 select * from users u join items i on u.id = i.user_id",
+			nodes: "dw.orders,ods.users,public.items",
+			edges: [][2]string{{"ods.users", "dw.orders"}, {"public.items", "dw.orders"}},
+		},
+		{
+			name:  "partitions merged",
+			sql:   "insert into dw.orders_2024_01 select * from items; insert into dw.orders_2024_02 select * from items",
+			nodes: "dw.orders,public.items",
+			edges: [][2]string{{"public.items", "dw.orders"}},
+		},
+		{
+			name:  "not in catalog",
+			sql:   "insert into report select * from items",
+			nodes: "public.items,report",
+			edges: [][2]string{{"public.items", "report"}},
+		},
+		{
+			name:  "temp table kept",
+			sql:   "create temp table users as select * from items; insert into dw.orders select * from users",
+			nodes: "dw.orders,public.items,users",
+			edges: [][2]string{{"public.items", "users"}, {"users", "dw.orders"}},
+		},
+	} {
+		g, err := Parse(tc.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		checkGraph(t, tc.name, ResolveTables(testCatalog(), g), tc.nodes, tc.edges)
+	}
+}
+
+func TestResolveTablesWithoutCatalog(t *testing.T) {
+	g, err := Parse("insert into dw.orders_2024_01 select * from users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ResolveTables(nil, g); got != g {
+		t.Error("ResolveTables without a catalog returned a new graph")
+	}
+}
@@ -0,0 +1,56 @@
+package lineage
+
+import (
+	"errors"
+	"regexp"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/pkg/depgraph"
+)
+
+// 脚本类型
+const (
+	ScriptSQL     = "sql"      // 普通 SQL，Parse
+	ScriptPLpgSQL = "plpgsql"  // CREATE FUNCTION / PROCEDURE，ParseUDF
+	ScriptUDFCall = "udf-call" // 函数调用，从 catalog 取定义后按 plpgsql 解析
+)
+
+var ErrNoCatalog = errors.New("UDF call requires a catalog to resolve the function definition")
+
+var createFunctionPattern = regexp.MustCompile(`(?is)^\s*create\s+(or\s+replace\s+)?(function|procedure)\s`)
+
+// Script 一段脚本的解析结果，解析失败时 Kind、Function 仍然有效
+type Script struct {
+	Kind     string
+	Function string // udf-call 时为 schema.name
+	Graph    *depgraph.Graph
+}
+
+// ParseScript 按内容判断脚本类型后解析，c 不为 nil 时用它补全表名（见 ResolveTables），为 nil 时函数调用返回 ErrNoCatalog
+func ParseScript(sql string, c catalog.Catalog) (*Script, error) {
+	s := &Script{Kind: ScriptSQL}
+
+	var err error
+	switch {
+	case createFunctionPattern.MatchString(sql):
+		s.Kind = ScriptPLpgSQL
+		s.Graph, err = ParseUDF(FilterUnhandledCommands(sql))
+		s.Graph = ResolveTables(c, s.Graph)
+
+	default:
+		udf, callErr := IdentifyFuncCall(sql)
+		if callErr != nil {
+			s.Graph, err = Parse(sql)
+			s.Graph = ResolveTables(c, s.Graph)
+			break
+		}
+
+		s.Kind = ScriptUDFCall
+		s.Function = udf.SchemaName + "." + udf.ProcName
+		if c == nil {
+			return s, ErrNoCatalog
+		}
+		s.Graph, err = HandleUDF4Lineage(c, udf)
+	}
+	return s, err
+}
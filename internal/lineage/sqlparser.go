@@ -1,9 +1,10 @@
 package lineage
 
 import (
-	"database/sql"
 	"fmt"
+	"strings"
 
+	"pg_lineage/internal/catalog"
 	"pg_lineage/internal/service"
 	"pg_lineage/pkg/depgraph"
 	"pg_lineage/pkg/log"
@@ -23,8 +24,8 @@ var (
 	}
 )
 
-// 解析函数调用
-func HandleUDF4Lineage(db *sql.DB, udf *service.Udf) (*depgraph.Graph, error) {
+// 解析函数调用，函数定义从 catalog 中获取
+func HandleUDF4Lineage(c catalog.Catalog, udf *service.Udf) (*depgraph.Graph, error) {
 	log.Infof("HandleUDF: %s.%s", udf.SchemaName, udf.ProcName)
 
 	// 排除系统函数的干扰 e.g. select now()
@@ -32,7 +33,7 @@ func HandleUDF4Lineage(db *sql.DB, udf *service.Udf) (*depgraph.Graph, error) {
 		return nil, fmt.Errorf("UDF %s is system function", udf.ProcName)
 	}
 
-	definition, err := GetUDFDefinition(db, udf)
+	definition, err := GetUDFDefinition(c, udf)
 	if err != nil {
 		log.Errorf("GetUDFDefinition err: %s", err)
 		return nil, err
@@ -40,6 +41,7 @@ func HandleUDF4Lineage(db *sql.DB, udf *service.Udf) (*depgraph.Graph, error) {
 	if definition == "" {
 		return nil, fmt.Errorf("UDF %s is undefined.", udf.ProcName)
 	}
+	udf.Definition = definition
 
 	plpgsql := FilterUnhandledCommands(definition)
 	// log.Debug("plpgsql: ", plpgsql)
@@ -50,19 +52,44 @@ func HandleUDF4Lineage(db *sql.DB, udf *service.Udf) (*depgraph.Graph, error) {
 		return nil, err
 	}
 
-	return sqlTree, nil
+	for _, e := range sqlTree.Edges() {
+		for i := range e.Provenance {
+			e.Provenance[i].Source = udf.GetID()
+		}
+	}
+
+	return ResolveTables(c, sqlTree), nil
 }
 
 func ParseUDF(plpgsql string) (*depgraph.Graph, error) {
 
 	sqlTree := depgraph.New()
 
+	stmts, err := UDFStatements(plpgsql)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range stmts {
+		if err := parseSQL(sqlTree, stmt); err != nil {
+			log.Errorf("pg_query.ParseToJSON err: %s, sql: %s", err, stmt)
+		}
+	}
+
+	return sqlTree, nil
+}
+
+// UDFStatements 提取函数体中需要做血缘解析的 SQL 语句
+func UDFStatements(plpgsql string) ([]string, error) {
+
 	raw, err := pg_query.ParsePlPgSqlToJSON(plpgsql)
 	if err != nil {
 		return nil, err
 	}
 	// log.Debugf("pg_query.ParsePlPgSqlToJSON: %s", raw)
 
+	var stmts []string
+
 	v := gjson.Parse(raw).Array()[0]
 
 	for _, action := range v.Get("PLpgSQL_function.action.PLpgSQL_stmt_block.body").Array() {
@@ -72,20 +99,18 @@ func ParseUDF(plpgsql string) (*depgraph.Graph, error) {
 				return false
 			}
 
-			// 递归调用 Parse
-			if err := parseUDFOperator(sqlTree, key.String(), value.String()); err != nil {
-				log.Errorf("pg_query.ParseToJSON err: %s, sql: %s", err, value.String())
-				return false
+			if subQuery := parseUDFOperator(key.String(), value.String()); subQuery != "" {
+				stmts = append(stmts, subQuery)
 			}
 
 			return true
 		})
 	}
 
-	return sqlTree, nil
+	return stmts, nil
 }
 
-func parseUDFOperator(sqlTree *depgraph.Graph, operator, plan string) error {
+func parseUDFOperator(operator, plan string) string {
 	// log.Printf("%s: %s\n", operator, plan)
 
 	var subQuery string
@@ -96,7 +121,7 @@ func parseUDFOperator(sqlTree *depgraph.Graph, operator, plan string) error {
 
 		// 跳过不必要的SQL，没啥解析的价值
 		if subQuery == "select clock_timestamp()" {
-			return nil
+			return ""
 		}
 
 	case "PLpgSQL_stmt_dynexecute":
@@ -105,11 +130,7 @@ func parseUDFOperator(sqlTree *depgraph.Graph, operator, plan string) error {
 
 	}
 
-	if err := parseSQL(sqlTree, subQuery); err != nil {
-		return err
-	}
-
-	return nil
+	return subQuery
 }
 
 func Parse(sql string) (*depgraph.Graph, error) {
@@ -132,6 +153,12 @@ func parseSQL(sqlTree *depgraph.Graph, sql string) error {
 
 	for _, s := range result.Stmts {
 
+		// 边记录产生它的语句
+		edge := depgraph.Edge{
+			Kind:       depgraph.EdgeData,
+			Provenance: []depgraph.Provenance{{Statement: stmtText(sql, s)}},
+		}
+
 		// 跳过 drop/truncate/create index/analyze/vacuum/set 语句
 		if s.Stmt.GetTruncateStmt() != nil ||
 			s.Stmt.GetDropStmt() != nil ||
@@ -145,8 +172,10 @@ func parseSQL(sqlTree *depgraph.Graph, sql string) error {
 		if s.Stmt.GetCreateTableAsStmt() != nil {
 			ctas := s.Stmt.GetCreateTableAsStmt()
 
-			tnode := parseRangeVar(ctas.GetInto().GetRel())
-			sqlTree.AddNode(tnode)
+			tnode := addTable(sqlTree, parseRangeVar(ctas.GetInto().GetRel()))
+			if ctas.GetObjtype() == pg_query.ObjectType_OBJECT_MATVIEW {
+				tnode.RelKind = service.REL_KIND_MATVIEW
+			}
 
 			if ctas.GetQuery().GetSelectStmt() != nil {
 
@@ -157,44 +186,70 @@ func parseSQL(sqlTree *depgraph.Graph, sql string) error {
 				ss := ctas.GetQuery().GetSelectStmt()
 
 				if ss.GetWithClause() != nil {
-					parseWithClause(ss.GetWithClause(), sqlTree)
+					parseWithClause(ss.GetWithClause(), sqlTree, edge)
 				}
 
 				for _, r := range parseSelectStmt(ss) {
-					sqlTree.DependOn(tnode, r)
+					dependOn(sqlTree, tnode, r, edge)
 				}
 
 			}
 		}
 
+		// create view ... as select ...
+		if s.Stmt.GetViewStmt() != nil {
+			vs := s.Stmt.GetViewStmt()
+
+			tnode := addTable(sqlTree, parseRangeVar(vs.GetView()))
+			tnode.RelKind = service.REL_KIND_VIEW
+
+			if ss := vs.GetQuery().GetSelectStmt(); ss != nil {
+				if ss.GetWithClause() != nil {
+					parseWithClause(ss.GetWithClause(), sqlTree, edge)
+				}
+
+				for _, r := range parseSelectStmt(ss) {
+					dependOn(sqlTree, tnode, r, edge)
+				}
+			}
+		}
+
+		// copy ... from / to ...
+		if s.Stmt.GetCopyStmt() != nil {
+			parseCopyStmt(s.Stmt.GetCopyStmt(), sqlTree, edge)
+		}
+
 		// create table ...
 		if s.Stmt.GetCreateStmt() != nil {
 			cs := s.Stmt.GetCreateStmt()
 
-			tnode := parseRangeVar(cs.GetRelation())
-			sqlTree.AddNode(tnode)
+			addTable(sqlTree, parseRangeVar(cs.GetRelation()))
 		}
 
 		// insert into ...
 		if s.Stmt.GetInsertStmt() != nil {
 			is := s.Stmt.GetInsertStmt()
 
-			tnode := parseRangeVar(is.GetRelation())
-			sqlTree.AddNode(tnode)
+			tnode := addTable(sqlTree, parseRangeVar(is.GetRelation()))
+
+			// with ... insert into ... select ...
+			if is.GetWithClause() != nil {
+				parseWithClause(is.GetWithClause(), sqlTree, edge)
+			}
 
 			// with ... select * from ...
 			// select * from ...
 			if is.GetSelectStmt() != nil {
 
-				ss := is.GetSelectStmt()
+				ss := is.GetSelectStmt().GetSelectStmt()
 
 				// with ... select * from ...
 				if ss.GetWithClause() != nil {
-					parseWithClause(ss.GetWithClause(), sqlTree)
+					parseWithClause(ss.GetWithClause(), sqlTree, edge)
 				}
 
-				for _, r := range parseSelectStmt(ss.GetSelectStmt()) {
-					sqlTree.DependOn(tnode, r)
+				for _, r := range parseSelectStmt(ss) {
+					dependOn(sqlTree, tnode, r, edge)
 				}
 			}
 		}
@@ -204,8 +259,7 @@ func parseSQL(sqlTree *depgraph.Graph, sql string) error {
 		if s.Stmt.GetDeleteStmt() != nil {
 			ds := s.Stmt.GetDeleteStmt()
 
-			tnode := parseRangeVar(ds.GetRelation())
-			sqlTree.AddNode(tnode)
+			addTable(sqlTree, parseRangeVar(ds.GetRelation()))
 
 			// TODO:是否要支持解析关联删除？
 			// 关联删除，依赖 using 关键词
@@ -229,12 +283,11 @@ func parseSQL(sqlTree *depgraph.Graph, sql string) error {
 		if s.Stmt.GetUpdateStmt() != nil {
 			us := s.Stmt.GetUpdateStmt()
 
-			tnode := parseRangeVar(us.GetRelation())
-			sqlTree.AddNode(tnode)
+			tnode := addTable(sqlTree, parseRangeVar(us.GetRelation()))
 
 			if us.GetFromClause() != nil {
 				for _, r := range parseUsingClause(us.GetFromClause()) {
-					sqlTree.DependOn(tnode, r)
+					dependOn(sqlTree, tnode, r, edge)
 				}
 			}
 		}
@@ -246,11 +299,11 @@ func parseSQL(sqlTree *depgraph.Graph, sql string) error {
 
 			// with ... select * from ...
 			if ss.GetWithClause() != nil {
-				parseWithClause(ss.GetWithClause(), sqlTree)
+				parseWithClause(ss.GetWithClause(), sqlTree, edge)
 			}
 
 			for _, r := range parseSelectStmt(ss) {
-				sqlTree.AddNode(r)
+				addTable(sqlTree, r)
 			}
 		}
 
@@ -259,6 +312,40 @@ func parseSQL(sqlTree *depgraph.Graph, sql string) error {
 	return nil
 }
 
+// dependOn 读写同一张表（如 insert into t select ... from t）时记为自环，由 Cycles 报告
+func dependOn(sqlTree *depgraph.Graph, child, parent *service.Table, edge depgraph.Edge) {
+	child, parent = addTable(sqlTree, child), addTable(sqlTree, parent)
+	if child.GetID() == parent.GetID() {
+		sqlTree.MergeEdge(parent, child, edge)
+		return
+	}
+	sqlTree.DependOnEdge(child, parent, edge)
+}
+
+// addTable 同名的表只保留一个节点：create temp table、CTE 覆盖之前的引用，之后不带 schema 的引用沿用已有节点，
+// 以免 insert into tmp 把临时表当成未解析的普通表
+func addTable(sqlTree *depgraph.Graph, t *service.Table) *service.Table {
+	switch t.Class() {
+	case depgraph.ClassCTE, depgraph.ClassTemp:
+	default:
+		if old, ok := sqlTree.GetNodes()[t.GetID()].(*service.Table); ok {
+			return old
+		}
+	}
+	sqlTree.AddNode(t)
+	return t
+}
+
+// stmtText 按位置从原文中截取单条语句，StmtLen 为 0 表示到结尾
+func stmtText(sql string, s *pg_query.RawStmt) string {
+	start := min(int(s.GetStmtLocation()), len(sql))
+	end := len(sql)
+	if s.GetStmtLen() > 0 {
+		end = min(start+int(s.GetStmtLen()), len(sql))
+	}
+	return strings.TrimSpace(sql[start:end])
+}
+
 // INSERT / UPDATE / DELETE / CREATE TABLE 单表操作
 func parseRangeVar(node *pg_query.RangeVar) *service.Table {
 
@@ -279,20 +366,52 @@ func parseRangeVar(node *pg_query.RangeVar) *service.Table {
 
 }
 
+// COPY 语句：copy t from 文件 记为 文件 -> t，copy t / (select ...) to 文件 记为 表 -> 文件；
+// program 为外部命令，stdin / stdout 由客户端处理，不产生节点
+func parseCopyStmt(cs *pg_query.CopyStmt, sqlTree *depgraph.Graph, edge depgraph.Edge) {
+	if cs.GetFilename() == "" {
+		return
+	}
+
+	var ext depgraph.Node = &service.File{Path: cs.GetFilename()}
+	if cs.GetIsProgram() {
+		ext = &service.External{System: "program", Name: cs.GetFilename()}
+	}
+
+	if cs.GetIsFrom() {
+		tnode := addTable(sqlTree, parseRangeVar(cs.GetRelation()))
+		sqlTree.DependOnEdge(tnode, ext, edge)
+		return
+	}
+
+	var sources []*service.Table
+	if cs.GetRelation() != nil {
+		sources = append(sources, parseRangeVar(cs.GetRelation()))
+	} else if ss := cs.GetQuery().GetSelectStmt(); ss != nil {
+		if ss.GetWithClause() != nil {
+			parseWithClause(ss.GetWithClause(), sqlTree, edge)
+		}
+		sources = parseSelectStmt(ss)
+	}
+	for _, r := range sources {
+		sqlTree.DependOnEdge(ext, addTable(sqlTree, r), edge)
+	}
+}
+
 // CTE 子句
-func parseWithClause(wc *pg_query.WithClause, sqlTree *depgraph.Graph) error {
+func parseWithClause(wc *pg_query.WithClause, sqlTree *depgraph.Graph, edge depgraph.Edge) error {
 
 	for _, cte := range wc.GetCtes() {
-		tnode := &service.Table{
+		tnode := addTable(sqlTree, &service.Table{
 			RelName:        cte.GetCommonTableExpr().GetCtename(),
 			SchemaName:     "",
 			RelPersistence: service.REL_PERSIST_NOT,
-		}
-		sqlTree.AddNode(tnode)
+			RelKind:        service.REL_KIND_CTE,
+		})
 
 		// 如果存在 FROM 字句，则需要添加依赖关系
 		for _, r := range parseSelectStmt(cte.GetCommonTableExpr().GetCtequery().GetSelectStmt()) {
-			sqlTree.DependOn(tnode, r)
+			dependOn(sqlTree, tnode, r, edge)
 		}
 	}
 
@@ -0,0 +1,111 @@
+package lineage
+
+import (
+	"testing"
+
+	"pg_lineage/pkg/depgraph"
+)
+
+func TestParseStatements(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		sql   string
+		nodes string
+		edges [][2]string
+		kinds map[string]depgraph.NodeKind
+	}{
+		{
+			name:  "copy from file",
+			sql:   "copy dw.t from '/data/t.csv' with (format csv)",
+			nodes: "dw.t,file:///data/t.csv",
+			edges: [][2]string{{"file:///data/t.csv", "dw.t"}},
+			kinds: map[string]depgraph.NodeKind{"file:///data/t.csv": depgraph.KindFile},
+		},
+		{
+			name:  "copy table to file",
+			sql:   "copy dw.t to '/data/t.csv'",
+			nodes: "dw.t,file:///data/t.csv",
+			edges: [][2]string{{"dw.t", "file:///data/t.csv"}},
+		},
+		{
+			name:  "copy query to program",
+			sql:   "copy (select * from dw.a join dw.b using (id)) to program 'gzip > /data/ab.gz'",
+			nodes: "dw.a,dw.b,program:gzip > /data/ab.gz",
+			edges: [][2]string{{"dw.a", "program:gzip > /data/ab.gz"}, {"dw.b", "program:gzip > /data/ab.gz"}},
+			kinds: map[string]depgraph.NodeKind{"program:gzip > /data/ab.gz": depgraph.KindExternal},
+		},
+		{
+			name:  "copy stdin",
+			sql:   "copy dw.t from stdin",
+			nodes: "",
+		},
+		{
+			name:  "create view",
+			sql:   "create view dw.v as with x as (select * from dw.a) select * from x join dw.b using (id)",
+			nodes: "dw.a,dw.b,dw.v,x",
+			edges: [][2]string{{"dw.a", "x"}, {"x", "dw.v"}, {"dw.b", "dw.v"}},
+			kinds: map[string]depgraph.NodeKind{"dw.v": depgraph.KindView, "dw.a": depgraph.KindTable},
+		},
+		{
+			name:  "create materialized view",
+			sql:   "create materialized view dw.mv as select * from dw.a",
+			nodes: "dw.a,dw.mv",
+			edges: [][2]string{{"dw.a", "dw.mv"}},
+			kinds: map[string]depgraph.NodeKind{"dw.mv": depgraph.KindView},
+		},
+		{
+			name:  "create table as",
+			sql:   "create table dw.t as select * from dw.a union all select * from dw.b",
+			nodes: "dw.a,dw.b,dw.t",
+			edges: [][2]string{{"dw.a", "dw.t"}, {"dw.b", "dw.t"}},
+			kinds: map[string]depgraph.NodeKind{"dw.t": depgraph.KindTable},
+		},
+	} {
+		g, err := Parse(tc.sql)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		checkGraph(t, tc.name, g, tc.nodes, tc.edges)
+		for id, kind := range tc.kinds {
+			if n, ok := g.GetNodes()[id]; !ok || n.GetKind() != kind {
+				t.Errorf("%s: %s kind = %v, want %s", tc.name, id, n, kind)
+			}
+		}
+	}
+}
+
+func TestParseUDF(t *testing.T) {
+	g, err := ParseUDF(`CREATE FUNCTION dw.f() RETURNS void AS $$
+BEGIN
+	create temp table tmp as select * from dw.a;
+	raise notice 'loaded';
+	insert into dw.b select * from tmp;
+	copy dw.b to '/data/b.csv';
+END;
+$$ LANGUAGE plpgsql;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGraph(t, "udf", g, "dw.a,dw.b,file:///data/b.csv,tmp",
+		[][2]string{{"dw.a", "tmp"}, {"tmp", "dw.b"}, {"dw.b", "file:///data/b.csv"}})
+
+	if _, err := ParseUDF("CREATE FUNCTION dw.f() RETURNS void AS $$ BEGIN insert into; END; $$ LANGUAGE plpgsql;"); err == nil {
+		t.Error("ParseUDF accepted an invalid function body")
+	}
+}
+
+func checkGraph(t *testing.T, name string, g *depgraph.Graph, nodes string, edges [][2]string) {
+	t.Helper()
+	if got := nodeIDs(g); got != nodes {
+		t.Errorf("%s: nodes = %s, want %s", name, got, nodes)
+	}
+	if len(g.Edges()) != len(edges) {
+		t.Errorf("%s: %d edges, want %d", name, len(g.Edges()), len(edges))
+	}
+	for _, e := range edges {
+		if g.Edge(e[0], e[1]) == nil {
+			t.Errorf("%s: missing edge %s -> %s", name, e[0], e[1])
+		}
+	}
+}
@@ -1,22 +1,15 @@
 package lineage
 
 import (
-	"database/sql"
 	"errors"
-	"fmt"
+	"pg_lineage/internal/catalog"
 	"pg_lineage/internal/service"
 	"pg_lineage/pkg/log"
 	"regexp"
 )
 
 var (
-	PLPGSQL_UNHANLED_COMMANDS   = regexp.MustCompile(`(?i)set\s+(time zone|enable_)(.*?);`)
-	PLPGSQL_GET_FUNC_DEFINITION = `
-		SELECT nspname, proname, pg_get_functiondef(p.oid) as definition
-		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
-		WHERE nspname = '%s' and proname = '%s'
-		LIMIT 1;
-	`
+	PLPGSQL_UNHANLED_COMMANDS = regexp.MustCompile(`(?i)set\s+(time zone|enable_)(.*?);`)
 
 	PG_FuncCallPattern1 = regexp.MustCompile(`(?is)^\s*(select|call)\s+(\w+)\.(\w+)\((.*)\)\s*(;)?`)
 	PG_FuncCallPattern2 = regexp.MustCompile(`(?is)^\s*select\s+(.*)from\s+(\w+)\.(\w+)\((.*)\)\s*(as\s+(.*))?\s*(;)?`)
@@ -56,30 +49,12 @@ func FilterUnhandledCommands(content string) string {
 	return content
 }
 
-// 获取相关定义
-func GetUDFDefinition(db *sql.DB, udf *service.Udf) (string, error) {
-
-	rows, err := db.Query(fmt.Sprintf(PLPGSQL_GET_FUNC_DEFINITION, udf.SchemaName, udf.ProcName))
+// 获取相关定义，c 可以是在线数据库 catalog.NewDB(db)，也可以是离线快照
+func GetUDFDefinition(c catalog.Catalog, udf *service.Udf) (string, error) {
+	definition, err := c.FunctionDefinition(udf.SchemaName, udf.ProcName)
 	if err != nil {
 		return "", err
 	}
-	defer rows.Close()
-
-	var nspname string
-	var proname string
-	var definition string
-
-	for rows.Next() {
-		err := rows.Scan(&nspname, &proname, &definition)
-		switch err {
-		case sql.ErrNoRows:
-			log.Warn("No rows were returned")
-		case nil:
-			log.Infof("Query Data = (%s, %s)\n", nspname, proname)
-		default:
-			log.Fatalf("rows.Scan err: %s", err)
-		}
-	}
-
+	log.Debugf("GetUDFDefinition: %s.%s", udf.SchemaName, udf.ProcName)
 	return definition, nil
 }
@@ -0,0 +1,547 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/internal/lineage"
+	reader "pg_lineage/internal/lineage-reader"
+	"pg_lineage/pkg/depgraph"
+	"pg_lineage/pkg/log"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+
+	maxParseBody = 1 << 20 // POST /api/parse 的 SQL 最大长度
+)
+
+// web 浏览血缘的单页应用，仅调用下面的 /api 接口
+//
+//go:embed web
+var webFS embed.FS
+
+// Server 以 JSON 提供 LineageReader 的查询及 SQL 解析
+type Server struct {
+	reader  reader.LineageReader
+	catalog catalog.Catalog
+	mux     *http.ServeMux
+}
+
+// New c 用于解析函数调用时获取函数定义，可以为 nil
+func New(r reader.LineageReader, c catalog.Catalog) *Server {
+	s := &Server{reader: r, catalog: c, mux: http.NewServeMux()}
+
+	s.mux.Handle("/api/node", handle(http.MethodGet, s.node))
+	s.mux.Handle("/api/upstream", handle(http.MethodGet, s.upstream))
+	s.mux.Handle("/api/downstream", handle(http.MethodGet, s.downstream))
+	s.mux.Handle("/api/edges", handle(http.MethodGet, s.edges))
+	s.mux.Handle("/api/path", handle(http.MethodGet, s.path))
+	s.mux.Handle("/api/impact", handle(http.MethodGet, s.impact))
+	s.mux.Handle("/api/critical", handle(http.MethodGet, s.critical))
+	s.mux.Handle("/api/blast", handle(http.MethodGet, s.blast))
+	s.mux.Handle("/api/search", handle(http.MethodGet, s.search))
+	s.mux.Handle("/api/parse", handle(http.MethodPost, s.parse))
+
+	static, _ := fs.Sub(webFS, "web")
+	s.mux.Handle("/", http.FileServer(http.FS(static)))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError 带状态码的错误，其余错误按 500 返回
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...any) error {
+	return &httpError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+func statusOf(err error) int {
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		return he.status
+	case errors.Is(err, reader.ErrNotFound), errors.Is(err, reader.ErrNoPath):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// handle 检查请求方法，将返回值编码为 JSON，错误统一为 {"error": "..."}
+func handle(method string, fn func(r *http.Request) (any, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		v, err := fn(r)
+		if err != nil {
+			status := statusOf(err)
+			if status >= http.StatusInternalServerError {
+				log.Errorf("%s %s: %v", r.Method, r.URL, err)
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false) // 节点名中的 > 保持原样
+	if err := enc.Encode(v); err != nil {
+		log.Warnf("Write response error: %v", err)
+	}
+}
+
+// page 分页参数 offset / limit，Total 为总数，未知时省略
+type page struct {
+	Offset int  `json:"offset"`
+	Limit  int  `json:"limit"`
+	Total  int  `json:"total,omitempty"`
+	More   bool `json:"more"`
+}
+
+func pageOf(r *http.Request) (page, error) {
+	p := page{Limit: defaultLimit}
+	for _, q := range []struct {
+		name string
+		dst  *int
+	}{{"offset", &p.Offset}, {"limit", &p.Limit}} {
+		v := r.URL.Query().Get(q.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, badRequest("invalid %s: %q", q.name, v)
+		}
+		*q.dst = n
+	}
+	if p.Limit == 0 || p.Limit > maxLimit {
+		p.Limit = maxLimit
+	}
+	return p, nil
+}
+
+func required(r *http.Request, name string) (string, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return "", badRequest("missing parameter: %s", name)
+	}
+	return v, nil
+}
+
+func depthOf(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("depth")
+	if v == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, badRequest("invalid depth: %q", v)
+	}
+	return n, nil
+}
+
+// edgeJSON Via 为 ShrinkGraph 去掉的中间节点
+type edgeJSON struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Via  []string `json:"via,omitempty"`
+}
+
+// graphResponse 节点按拓扑分层排序后分页，每条边随其上游节点所在的页返回；Cycles 为图中的环
+type graphResponse struct {
+	Nodes  []*reader.Node `json:"nodes"`
+	Edges  []edgeJSON     `json:"edges"`
+	Cycles [][]string     `json:"cycles,omitempty"`
+	Page   page           `json:"page"`
+}
+
+func graphPage(g *depgraph.Graph, p page) *graphResponse {
+	var (
+		order  []string
+		cycles [][]string
+		seen   = make(map[string]bool)
+	)
+	layers, err := g.TopoSortedLayers()
+	for _, layer := range layers {
+		for _, id := range layer {
+			seen[id] = true
+		}
+		order = append(order, layer...)
+	}
+	// 环上的节点及其下游不在分层结果中，排在最后
+	var ce *depgraph.CycleError
+	if errors.As(err, &ce) {
+		cycles = ce.Cycles
+	}
+	var rest []string
+	for id := range g.GetNodes() {
+		if !seen[id] {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+	order = append(order, rest...)
+
+	p.Total = len(order)
+	start := min(p.Offset, len(order))
+	end := min(start+p.Limit, len(order))
+	p.More = end < len(order)
+
+	resp := &graphResponse{Nodes: []*reader.Node{}, Edges: []edgeJSON{}, Cycles: cycles, Page: p}
+	rels := g.GetRelationships()
+	for _, id := range order[start:end] {
+		resp.Nodes = append(resp.Nodes, toNode(g.GetNodes()[id]))
+
+		downs := make([]string, 0, len(rels[id]))
+		for down := range rels[id] {
+			downs = append(downs, down)
+		}
+		sort.Strings(downs)
+		for _, down := range downs {
+			via, _ := g.Edge(id, down).Attributes[depgraph.AttrVia].([]string)
+			resp.Edges = append(resp.Edges, edgeJSON{From: id, To: down, Via: via})
+		}
+	}
+	return resp
+}
+
+// toNode 解析 SQL 得到的图中节点为表、文件等，按 kind 和属性统一转为 reader.Node
+func toNode(n depgraph.Node) *reader.Node {
+	if rn, ok := n.(*reader.Node); ok {
+		return rn
+	}
+	out := &reader.Node{ID: n.GetID(), Kind: string(n.GetKind()), Name: n.GetID(), Attributes: map[string]any{}}
+	for k, v := range n.GetAttributes() {
+		out.Attributes[k] = v
+	}
+	if n.IsTemp() {
+		out.Attributes["temp"] = true
+	}
+	return out
+}
+
+// nodeResponse 节点属性及直接上下游的数量
+type nodeResponse struct {
+	*reader.Node
+	Upstream   int `json:"upstream"`
+	Downstream int `json:"downstream"`
+}
+
+func (s *Server) node(r *http.Request) (any, error) {
+	id, err := required(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.reader.Node(id)
+	if err != nil {
+		return nil, err
+	}
+
+	up, err := s.reader.Upstream(id, 1)
+	if err != nil {
+		return nil, err
+	}
+	down, err := s.reader.Downstream(id, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeResponse{Node: n, Upstream: len(up.GetNodes()) - 1, Downstream: len(down.GetNodes()) - 1}, nil
+}
+
+type edgesResponse struct {
+	Edges []*reader.Edge `json:"edges"`
+}
+
+func (s *Server) edges(r *http.Request) (any, error) {
+	from, err := required(r, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := required(r, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	edges, err := s.reader.Edges(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &edgesResponse{Edges: append([]*reader.Edge{}, edges...)}, nil
+}
+
+func (s *Server) upstream(r *http.Request) (any, error) {
+	return s.walk(r, s.reader.Upstream)
+}
+
+func (s *Server) downstream(r *http.Request) (any, error) {
+	return s.walk(r, s.reader.Downstream)
+}
+
+func (s *Server) walk(r *http.Request, fn func(id string, depth int) (*depgraph.Graph, error)) (any, error) {
+	id, err := required(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	depth, err := depthOf(r)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pageOf(r)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := fn(id, depth)
+	if err != nil {
+		return nil, err
+	}
+	return graphPage(g, p), nil
+}
+
+func (s *Server) path(r *http.Request) (any, error) {
+	from, err := required(r, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := required(r, "to")
+	if err != nil {
+		return nil, err
+	}
+	p, err := pageOf(r)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := s.reader.Path(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return graphPage(g, p), nil
+}
+
+func (s *Server) impact(r *http.Request) (any, error) {
+	id, err := required(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	p, err := pageOf(r)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := s.reader.Impact(id)
+	if err != nil {
+		return nil, err
+	}
+	return graphPage(g, p), nil
+}
+
+// criticalResponse Nodes 为从源头到 id 的关键路径，Edges 为路径上每一段的边及属性
+type criticalResponse struct {
+	*depgraph.WeightedPath
+	Edges []*reader.Edge `json:"edges"`
+}
+
+// critical 到 id 最慢的上游链路：weight 为 mean_time（默认）、calls 或 hops，同一对节点间有多条边时取最大值；
+// depth 默认为 reader.MaxDepth
+func (s *Server) critical(r *http.Request) (any, error) {
+	id, err := required(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	depth := 0
+	if r.URL.Query().Has("depth") {
+		if depth, err = depthOf(r); err != nil {
+			return nil, err
+		}
+	}
+	attr := r.URL.Query().Get("weight")
+	switch attr {
+	case "":
+		attr = "mean_time"
+	case "mean_time", "calls", "hops":
+	default:
+		return nil, badRequest("invalid weight: %q", attr)
+	}
+
+	g, err := s.reader.Upstream(id, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	// 子图中的边不带属性，按边查询后取最大值
+	edges := make(map[[2]string][]*reader.Edge)
+	for _, e := range g.Edges() {
+		es, err := s.reader.Edges(e.From, e.To)
+		if err != nil {
+			return nil, err
+		}
+		edges[[2]string{e.From, e.To}] = es
+	}
+	var weight depgraph.Weight
+	if attr != "hops" {
+		weight = func(e *depgraph.Edge) float64 {
+			w := 0.0
+			for _, re := range edges[[2]string{e.From, e.To}] {
+				w = max(w, depgraph.AttrWeight(attr)(&depgraph.Edge{Attributes: re.Attributes}))
+			}
+			return w
+		}
+	}
+
+	path, err := g.CriticalPath(id, weight)
+	var ce *depgraph.CycleError
+	if errors.As(err, &ce) {
+		return nil, &httpError{status: http.StatusUnprocessableEntity, msg: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &criticalResponse{WeightedPath: path, Edges: []*reader.Edge{}}
+	for i := 1; i < len(path.Nodes); i++ {
+		resp.Edges = append(resp.Edges, edges[[2]string{path.Nodes[i-1], path.Nodes[i]}]...)
+	}
+	return resp, nil
+}
+
+// blastResponse Kinds 为各类下游节点的数量，键为 reader.Node.Kind
+type blastResponse struct {
+	ID    string         `json:"id"`
+	Total int            `json:"total"`
+	Kinds map[string]int `json:"kinds"`
+}
+
+// blast 统计 id 的所有下游：沿数据流向的表、面板，以及面板所属的 dashboard
+func (s *Server) blast(r *http.Request) (any, error) {
+	id, err := required(r, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := s.reader.Downstream(id, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp := &blastResponse{ID: id}
+	resp.Kinds = g.BlastRadius(id, nil)
+
+	// dashboard 到面板为 contain 边，不在下游中，有面板受影响的 dashboard 单独计数
+	impact, err := s.reader.Impact(id)
+	if err != nil {
+		return nil, err
+	}
+	affected := g.Dependents(id)
+	rels := impact.GetRelationships()
+	for did, n := range impact.GetNodes() {
+		if rn, ok := n.(*reader.Node); !ok || rn.Kind != reader.KindDashboard {
+			continue
+		}
+		for panel := range rels[did] {
+			if _, ok := affected[panel]; ok {
+				resp.Kinds[reader.KindDashboard]++
+				break
+			}
+		}
+	}
+	for _, n := range resp.Kinds {
+		resp.Total += n
+	}
+	return resp, nil
+}
+
+type searchResponse struct {
+	Nodes []*reader.Node `json:"nodes"`
+	Page  page           `json:"page"`
+}
+
+// search 多取一条判断是否还有下一页
+func (s *Server) search(r *http.Request) (any, error) {
+	q, err := required(r, "q")
+	if err != nil {
+		return nil, err
+	}
+	p, err := pageOf(r)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.reader.Search(q, p.Offset+p.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	nodes = nodes[min(p.Offset, len(nodes)):]
+	if p.More = len(nodes) > p.Limit; p.More {
+		nodes = nodes[:p.Limit]
+	}
+	return &searchResponse{Nodes: append([]*reader.Node{}, nodes...), Page: p}, nil
+}
+
+type parseResponse struct {
+	Kind     string `json:"kind"`
+	Function string `json:"function,omitempty"`
+	*graphResponse
+}
+
+// parse 请求体为 SQL 文本，默认去掉临时节点，shrink=false 时保留
+func (s *Server) parse(r *http.Request) (any, error) {
+	p, err := pageOf(r)
+	if err != nil {
+		return nil, err
+	}
+	shrink := true
+	if v := r.URL.Query().Get("shrink"); v != "" {
+		if shrink, err = strconv.ParseBool(v); err != nil {
+			return nil, badRequest("invalid shrink: %q", v)
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxParseBody))
+	if err != nil {
+		return nil, badRequest("read body: %v", err)
+	}
+	sql := string(body)
+	if strings.TrimSpace(sql) == "" {
+		return nil, badRequest("empty SQL")
+	}
+
+	script, err := lineage.ParseScript(sql, s.catalog)
+	if err != nil {
+		return nil, &httpError{status: http.StatusUnprocessableEntity, msg: err.Error()}
+	}
+
+	g := script.Graph
+	if shrink {
+		g = g.ShrinkGraph()
+	}
+	return &parseResponse{Kind: script.Kind, Function: script.Function, graphResponse: graphPage(g, p)}, nil
+}
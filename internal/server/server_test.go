@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	reader "pg_lineage/internal/lineage-reader"
+	"pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "server-test")
+	if err != nil {
+		panic(err)
+	}
+	// 解析 SQL 时会写日志
+	if err := log.InitLogger(&config.LogConfig{Level: "error", Path: filepath.Join(dir, "test.log")}); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testServer t1 -> t2 -> t3 -> p1 <- d1，t1 -> t3 较快；c1 <-> c2 成环
+func testServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	m := reader.NewMemory()
+	for _, n := range []*reader.Node{
+		{ID: "t1", Kind: reader.KindTable},
+		{ID: "t2", Kind: reader.KindTable},
+		{ID: "t3", Kind: reader.KindTable},
+		{ID: "p1", Kind: reader.KindPanel},
+		{ID: "d1", Kind: reader.KindDashboard},
+		{ID: "c1", Kind: reader.KindTable},
+		{ID: "c2", Kind: reader.KindTable},
+	} {
+		m.AddNode(n)
+	}
+	for _, e := range []*reader.Edge{
+		{From: "t1", To: "t2", Kind: "sql", Attributes: map[string]any{"mean_time": 10.0, "calls": 1.0}},
+		{From: "t2", To: "t3", Kind: "sql", Attributes: map[string]any{"mean_time": 1.0, "calls": 1.0}},
+		{From: "t1", To: "t3", Kind: "sql", Attributes: map[string]any{"mean_time": 2.0, "calls": 9.0}},
+		{From: "t3", To: "p1", Kind: "sql"},
+		{From: "d1", To: "p1", Kind: "contain"},
+		{From: "c1", To: "c2", Kind: "sql"},
+		{From: "c2", To: "c1", Kind: "sql"},
+	} {
+		m.AddEdge(e)
+	}
+
+	srv := httptest.NewServer(New(m, nil))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, srv *httptest.Server, path string, want int, v any) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		t.Fatalf("GET %s: status %d, want %d (%v)", path, resp.StatusCode, want, body)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: decode: %v", path, err)
+		}
+	}
+}
+
+func nodeIDs(nodes []*reader.Node) string {
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestGraphPage(t *testing.T) {
+	srv := testServer(t)
+
+	for _, tc := range []struct {
+		query string
+		nodes string
+		edges int
+		more  bool
+	}{
+		{"", "t1,t2,t3,p1", 4, false},
+		{"&limit=2", "t1,t2", 3, true},
+		{"&offset=2&limit=2", "t3,p1", 1, false},
+		{"&offset=10", "", 0, false},
+	} {
+		var resp graphResponse
+		get(t, srv, "/api/downstream?id=t1&depth=0"+tc.query, http.StatusOK, &resp)
+		if got := nodeIDs(resp.Nodes); got != tc.nodes {
+			t.Errorf("%q: nodes = %s, want %s", tc.query, got, tc.nodes)
+		}
+		if len(resp.Edges) != tc.edges {
+			t.Errorf("%q: %d edges, want %d", tc.query, len(resp.Edges), tc.edges)
+		}
+		if resp.Page.Total != 4 || resp.Page.More != tc.more {
+			t.Errorf("%q: page = %+v", tc.query, resp.Page)
+		}
+	}
+
+	// 环上的节点排在最后，并返回环
+	var resp graphResponse
+	get(t, srv, "/api/downstream?id=c1&depth=0", http.StatusOK, &resp)
+	if got := nodeIDs(resp.Nodes); got != "c1,c2" || len(resp.Cycles) != 1 {
+		t.Errorf("cycle: nodes = %s, cycles = %v", got, resp.Cycles)
+	}
+}
+
+func TestPageOf(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  page
+		err   bool
+	}{
+		{"", page{Limit: defaultLimit}, false},
+		{"offset=5&limit=20", page{Offset: 5, Limit: 20}, false},
+		{"limit=0", page{Limit: maxLimit}, false},
+		{"limit=100000", page{Limit: maxLimit}, false},
+		{"limit=-1", page{}, true},
+		{"offset=x", page{}, true},
+	} {
+		p, err := pageOf(httptest.NewRequest(http.MethodGet, "/api/search?"+tc.query, nil))
+		if (err != nil) != tc.err {
+			t.Errorf("%q: err = %v", tc.query, err)
+			continue
+		}
+		if err == nil && p != tc.want {
+			t.Errorf("%q: page = %+v, want %+v", tc.query, p, tc.want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	srv := testServer(t)
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/api/node?id=t1", http.StatusOK},
+		{"/api/node", http.StatusBadRequest},
+		{"/api/node?id=missing", http.StatusNotFound},
+		{"/api/upstream?id=t3&depth=x", http.StatusBadRequest},
+		{"/api/downstream?id=t1&limit=-1", http.StatusBadRequest},
+		{"/api/path?from=t3&to=t1", http.StatusNotFound},
+		{"/api/path?from=t1&to=missing", http.StatusNotFound},
+		{"/api/critical?id=t3&weight=x", http.StatusBadRequest},
+		{"/api/critical?id=c1", http.StatusUnprocessableEntity},
+		{"/api/blast?id=missing", http.StatusNotFound},
+	} {
+		get(t, srv, tc.path, tc.want, nil)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/parse", "text/plain", strings.NewReader("SELEC 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("POST /api/parse: status %d, want 422", resp.StatusCode)
+	}
+
+	resp, err = http.Post(srv.URL+"/api/node?id=t1", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodGet {
+		t.Errorf("POST /api/node: status %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
+
+func TestCritical(t *testing.T) {
+	srv := testServer(t)
+
+	for _, tc := range []struct {
+		weight string
+		nodes  string
+		total  float64
+	}{
+		{"", "t1,t2,t3", 11},
+		{"calls", "t1,t3", 9},
+		{"hops", "t1,t2,t3", 2},
+	} {
+		var resp struct {
+			Nodes  []string       `json:"nodes"`
+			Weight float64        `json:"weight"`
+			Edges  []*reader.Edge `json:"edges"`
+		}
+		get(t, srv, "/api/critical?id=t3&weight="+tc.weight, http.StatusOK, &resp)
+		if got := strings.Join(resp.Nodes, ","); got != tc.nodes || resp.Weight != tc.total {
+			t.Errorf("weight=%s: path = %s (%v), want %s (%v)", tc.weight, got, resp.Weight, tc.nodes, tc.total)
+		}
+		if len(resp.Edges) != len(resp.Nodes)-1 {
+			t.Errorf("weight=%s: %d edges for %d nodes", tc.weight, len(resp.Edges), len(resp.Nodes))
+		}
+	}
+}
+
+func TestBlast(t *testing.T) {
+	srv := testServer(t)
+
+	var resp blastResponse
+	get(t, srv, "/api/blast?id=t1", http.StatusOK, &resp)
+	want := map[string]int{reader.KindTable: 2, reader.KindPanel: 1, reader.KindDashboard: 1}
+	if resp.ID != "t1" || resp.Total != 4 || len(resp.Kinds) != len(want) {
+		t.Fatalf("blast = %+v", resp)
+	}
+	for k, n := range want {
+		if resp.Kinds[k] != n {
+			t.Errorf("kinds[%s] = %d, want %d", k, resp.Kinds[k], n)
+		}
+	}
+}
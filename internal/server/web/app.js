@@ -0,0 +1,566 @@
+'use strict';
+
+// 血缘浏览页面，只依赖 /api 下的 JSON 接口，不引入第三方库
+(function () {
+  const SVG_NS = 'http://www.w3.org/2000/svg';
+  const NODE_W = 220;
+  const NODE_H = 38;
+  const COL_GAP = 110;
+  const ROW_GAP = 18;
+  const PAD = 40;
+
+  // 详情中优先展示的属性
+  const KEY_ATTRS = ['calls', 'seq_scan', 'idx_scan', 'description', 'comment', 'pic', 'procname'];
+
+  const $ = (id) => document.getElementById(id);
+  const svg = $('graph');
+  const viewport = $('viewport');
+
+  const state = {
+    nodes: new Map(), // id -> {node, layer, order, up, down}
+    edges: new Map(), // from + '\u0000' + to -> {from, to}
+    order: 0,
+    selected: null, // {type: 'node' | 'edge', key}
+    colorBy: 'schema',
+    view: {x: 0, y: 0, k: 1},
+    pos: new Map(), // id -> {x, y}
+  };
+
+  function status(msg, isError) {
+    const el = $('status');
+    el.textContent = msg || '';
+    el.classList.toggle('error', !!isError);
+  }
+
+  async function api(path, params) {
+    const res = await fetch('api/' + path + '?' + new URLSearchParams(params));
+    const body = await res.json().catch(() => ({error: res.statusText}));
+    if (!res.ok) {
+      throw new Error(body.error || res.statusText);
+    }
+    return body;
+  }
+
+  // graphAll 按页取完整个子图
+  async function graphAll(path, params) {
+    const out = {nodes: [], edges: []};
+    let offset = 0;
+    for (;;) {
+      const r = await api(path, Object.assign({}, params, {offset: offset, limit: 1000}));
+      out.nodes.push(...r.nodes);
+      out.edges.push(...r.edges);
+      if (!r.page.more) {
+        return out;
+      }
+      offset += r.page.limit;
+    }
+  }
+
+  // ---------- 着色 ----------
+
+  function schemaOf(n) {
+    const a = n.attributes || {};
+    if (a.schemaname || a.schema) {
+      return a.schemaname || a.schema;
+    }
+    if (n.kind === 'table' && n.name && n.name.includes('.')) {
+      return n.name.split('.').slice(-2)[0];
+    }
+    return n.kind || 'unknown';
+  }
+
+  function colorKey(n) {
+    if (state.colorBy === 'service') {
+      return n.service || n.kind || 'unknown';
+    }
+    return schemaOf(n);
+  }
+
+  function colorOf(key) {
+    let h = 0;
+    for (const c of key) {
+      h = (h * 31 + c.codePointAt(0)) >>> 0;
+    }
+    return 'hsl(' + (h % 360) + ', 60%, 85%)';
+  }
+
+  // ---------- 图数据 ----------
+
+  function addNode(n, layer) {
+    const cur = state.nodes.get(n.id);
+    if (cur) {
+      // 边端点先于节点出现时只有 id，补全属性
+      if (!cur.node.kind && n.kind) {
+        cur.node = n;
+      }
+      return;
+    }
+    state.nodes.set(n.id, {node: n, layer: layer, order: state.order++, up: false, down: false});
+  }
+
+  function addEdge(e) {
+    state.edges.set(e.from + '\u0000' + e.to, e);
+  }
+
+  async function open(id) {
+    status('加载 ' + id + ' ...');
+    try {
+      const n = await api('node', {id: id});
+      state.nodes.clear();
+      state.edges.clear();
+      state.order = 0;
+      addNode(n, 0);
+      state.selected = {type: 'node', key: n.id};
+      render();
+      fit();
+      showNode(n.id);
+      status('');
+    } catch (err) {
+      status(err.message, true);
+    }
+  }
+
+  // expand 展开一层上游或下游，新节点放在相邻的列
+  async function expand(id, dir) {
+    const entry = state.nodes.get(id);
+    if (!entry || entry[dir]) {
+      return;
+    }
+    status('展开 ' + id + ' ...');
+    try {
+      const g = await graphAll(dir === 'up' ? 'upstream' : 'downstream', {id: id, depth: 1});
+      const layer = entry.layer + (dir === 'up' ? -1 : 1);
+      for (const n of g.nodes) {
+        addNode(n, layer);
+      }
+      for (const e of g.edges) {
+        addEdge(e);
+      }
+      entry[dir] = true;
+      render();
+      status(g.nodes.length - 1 + ' 个' + (dir === 'up' ? '上游' : '下游') + '节点');
+    } catch (err) {
+      status(err.message, true);
+    }
+  }
+
+  // ---------- 布局与绘制 ----------
+
+  function layout() {
+    const cols = new Map();
+    for (const [id, e] of state.nodes) {
+      if (!cols.has(e.layer)) {
+        cols.set(e.layer, []);
+      }
+      cols.get(e.layer).push({id: id, order: e.order});
+    }
+    const layers = [...cols.keys()].sort((a, b) => a - b);
+    const height = Math.max(0, ...[...cols.values()].map((c) => c.length)) * (NODE_H + ROW_GAP);
+
+    state.pos.clear();
+    layers.forEach((layer, i) => {
+      const col = cols.get(layer).sort((a, b) => a.order - b.order);
+      const top = PAD + (height - col.length * (NODE_H + ROW_GAP)) / 2;
+      col.forEach((c, j) => {
+        state.pos.set(c.id, {x: PAD + i * (NODE_W + COL_GAP), y: top + j * (NODE_H + ROW_GAP)});
+      });
+    });
+  }
+
+  function el(tag, attrs, parent) {
+    const e = document.createElementNS(SVG_NS, tag);
+    for (const k in attrs) {
+      e.setAttribute(k, attrs[k]);
+    }
+    if (parent) {
+      parent.appendChild(e);
+    }
+    return e;
+  }
+
+  function truncate(s, n) {
+    return s.length > n ? s.slice(0, n - 1) + '…' : s;
+  }
+
+  function render() {
+    layout();
+    viewport.textContent = '';
+    applyView();
+
+    for (const [key, e] of state.edges) {
+      const a = state.pos.get(e.from);
+      const b = state.pos.get(e.to);
+      if (!a || !b) {
+        continue;
+      }
+      const x1 = a.x + NODE_W, y1 = a.y + NODE_H / 2;
+      const x2 = b.x, y2 = b.y + NODE_H / 2;
+      const dx = Math.max(40, Math.abs(x2 - x1) / 2);
+      const d = 'M' + x1 + ',' + y1 + ' C' + (x1 + dx) + ',' + y1 + ' ' + (x2 - dx) + ',' + y2 + ' ' + x2 + ',' + y2;
+
+      const g = el('g', {class: 'edge'}, viewport);
+      if (state.selected && state.selected.type === 'edge' && state.selected.key === key) {
+        g.classList.add('selected');
+      }
+      el('path', {d: d, fill: 'none', stroke: 'transparent', 'stroke-width': 10}, g);
+      el('path', {class: 'line', d: d, fill: 'none', stroke: '#888', 'stroke-width': 1.2, 'marker-end': 'url(#arrow)'}, g);
+      el('title', {}, g).textContent = e.from + ' → ' + e.to;
+      g.addEventListener('click', (ev) => {
+        ev.stopPropagation();
+        state.selected = {type: 'edge', key: key};
+        render();
+        showEdge(e.from, e.to);
+      });
+    }
+
+    for (const [id, e] of state.nodes) {
+      const p = state.pos.get(id);
+      const n = e.node;
+      const g = el('g', {class: 'node', transform: 'translate(' + p.x + ',' + p.y + ')'}, viewport);
+      if (state.selected && state.selected.type === 'node' && state.selected.key === id) {
+        g.classList.add('selected');
+      }
+      el('rect', {class: 'box', width: NODE_W, height: NODE_H, rx: 4, fill: colorOf(colorKey(n)), stroke: '#666', 'stroke-width': 1}, g);
+      el('text', {x: 12, y: 16, 'font-size': 12, 'font-family': 'sans-serif', fill: '#222'}, g)
+        .textContent = truncate(n.name || id, 30);
+      el('text', {x: 12, y: 30, 'font-size': 10, 'font-family': 'sans-serif', fill: '#666'}, g)
+        .textContent = truncate([n.kind, n.service, n.database].filter(Boolean).join(' · '), 36);
+      el('title', {}, g).textContent = id;
+      g.addEventListener('click', (ev) => {
+        ev.stopPropagation();
+        state.selected = {type: 'node', key: id};
+        render();
+        showNode(id);
+      });
+
+      if (!e.up) {
+        expander(g, 0, () => expand(id, 'up'), '展开上游');
+      }
+      if (!e.down) {
+        expander(g, NODE_W, () => expand(id, 'down'), '展开下游');
+      }
+    }
+
+    renderLegend();
+  }
+
+  function expander(parent, x, fn, title) {
+    const g = el('g', {class: 'expand', transform: 'translate(' + x + ',' + NODE_H / 2 + ')'}, parent);
+    el('circle', {r: 8, fill: '#fff', stroke: '#666'}, g);
+    el('path', {d: 'M-4,0 H4 M0,-4 V4', stroke: '#444', 'stroke-width': 1.5}, g);
+    el('title', {}, g).textContent = title;
+    g.addEventListener('click', (ev) => {
+      ev.stopPropagation();
+      fn();
+    });
+  }
+
+  function renderLegend() {
+    const keys = new Set();
+    for (const e of state.nodes.values()) {
+      keys.add(colorKey(e.node));
+    }
+    const legend = $('legend');
+    legend.textContent = '';
+    if (keys.size === 0) {
+      return;
+    }
+    const h = document.createElement('h3');
+    h.textContent = state.colorBy;
+    legend.appendChild(h);
+    for (const k of [...keys].sort()) {
+      const item = document.createElement('div');
+      item.className = 'item';
+      const sw = document.createElement('span');
+      sw.className = 'swatch';
+      sw.style.background = colorOf(k);
+      const label = document.createElement('span');
+      label.textContent = k;
+      item.append(sw, label);
+      legend.appendChild(item);
+    }
+  }
+
+  // ---------- 详情 ----------
+
+  function formatValue(v) {
+    if (Array.isArray(v)) {
+      return v.join(', ');
+    }
+    if (v !== null && typeof v === 'object') {
+      return JSON.stringify(v);
+    }
+    return String(v);
+  }
+
+  function attrTable(rows, keyAttrs) {
+    const table = document.createElement('table');
+    for (const [k, v] of rows) {
+      if (v === undefined || v === null || v === '') {
+        continue;
+      }
+      const tr = table.insertRow();
+      if (keyAttrs && KEY_ATTRS.includes(k)) {
+        tr.className = 'key';
+      }
+      tr.insertCell().textContent = k;
+      tr.insertCell().textContent = formatValue(v);
+    }
+    return table;
+  }
+
+  function sortedAttrs(attrs) {
+    const entries = Object.entries(attrs || {});
+    const rank = (k) => {
+      const i = KEY_ATTRS.indexOf(k);
+      return i < 0 ? KEY_ATTRS.length : i;
+    };
+    return entries.sort((a, b) => rank(a[0]) - rank(b[0]) || a[0].localeCompare(b[0]));
+  }
+
+  function heading(text, kind) {
+    const h = document.createElement('h3');
+    h.textContent = text;
+    if (kind) {
+      const s = document.createElement('span');
+      s.className = 'kind';
+      s.textContent = kind;
+      h.appendChild(s);
+    }
+    return h;
+  }
+
+  async function showNode(id) {
+    const box = $('details');
+    try {
+      const n = await api('node', {id: id});
+      box.textContent = '';
+      box.append(
+        heading(n.name || n.id, n.kind),
+        attrTable([['id', n.id], ['service', n.service], ['database', n.database],
+          ['上游', n.upstream], ['下游', n.downstream]]),
+        attrTable(sortedAttrs(n.attributes), true));
+    } catch (err) {
+      status(err.message, true);
+    }
+  }
+
+  async function showEdge(from, to) {
+    const box = $('details');
+    try {
+      const r = await api('edges', {from: from, to: to});
+      box.textContent = '';
+      box.append(heading(from + ' → ' + to));
+      if (r.edges.length === 0) {
+        box.append(heading('无边属性'));
+      }
+      for (const e of r.edges) {
+        box.append(attrTable([['kind', e.kind]].concat(sortedAttrs(e.attributes)), true));
+      }
+    } catch (err) {
+      status(err.message, true);
+    }
+  }
+
+  // ---------- 缩放与拖动 ----------
+
+  function applyView() {
+    const v = state.view;
+    viewport.setAttribute('transform', 'translate(' + v.x + ',' + v.y + ') scale(' + v.k + ')');
+  }
+
+  function bounds() {
+    let x1 = Infinity, y1 = Infinity, x2 = -Infinity, y2 = -Infinity;
+    for (const p of state.pos.values()) {
+      x1 = Math.min(x1, p.x);
+      y1 = Math.min(y1, p.y);
+      x2 = Math.max(x2, p.x + NODE_W);
+      y2 = Math.max(y2, p.y + NODE_H);
+    }
+    if (x1 === Infinity) {
+      return null;
+    }
+    return {x: x1 - PAD, y: y1 - PAD, w: x2 - x1 + 2 * PAD, h: y2 - y1 + 2 * PAD};
+  }
+
+  function fit() {
+    const b = bounds();
+    if (!b) {
+      return;
+    }
+    const r = svg.getBoundingClientRect();
+    const k = Math.min(1.5, r.width / b.w, r.height / b.h);
+    state.view = {k: k, x: (r.width - b.w * k) / 2 - b.x * k, y: (r.height - b.h * k) / 2 - b.y * k};
+    applyView();
+  }
+
+  svg.addEventListener('wheel', (ev) => {
+    ev.preventDefault();
+    const r = svg.getBoundingClientRect();
+    const mx = ev.clientX - r.left, my = ev.clientY - r.top;
+    const v = state.view;
+    const k = Math.min(4, Math.max(0.1, v.k * Math.exp(-ev.deltaY * 0.001)));
+    v.x = mx - (mx - v.x) * k / v.k;
+    v.y = my - (my - v.y) * k / v.k;
+    v.k = k;
+    applyView();
+  }, {passive: false});
+
+  let drag = null;
+  svg.addEventListener('mousedown', (ev) => {
+    drag = {x: ev.clientX - state.view.x, y: ev.clientY - state.view.y};
+    svg.classList.add('dragging');
+  });
+  window.addEventListener('mousemove', (ev) => {
+    if (drag) {
+      state.view.x = ev.clientX - drag.x;
+      state.view.y = ev.clientY - drag.y;
+      applyView();
+    }
+  });
+  window.addEventListener('mouseup', () => {
+    drag = null;
+    svg.classList.remove('dragging');
+  });
+
+  // ---------- 搜索 ----------
+
+  const search = $('search');
+  const results = $('results');
+  let searchTimer = null;
+  let searchSeq = 0;
+
+  async function runSearch() {
+    const q = search.value.trim();
+    if (!q) {
+      results.hidden = true;
+      return;
+    }
+    const seq = ++searchSeq;
+    try {
+      // 未写通配符时按包含匹配
+      const r = await api('search', {q: /[*?]/.test(q) ? q : '*' + q + '*', limit: 20});
+      if (seq !== searchSeq) {
+        return;
+      }
+      results.textContent = '';
+      for (const n of r.nodes) {
+        const li = document.createElement('li');
+        li.textContent = n.name || n.id;
+        const kind = document.createElement('span');
+        kind.className = 'kind';
+        kind.textContent = [n.kind, n.database].filter(Boolean).join(' · ');
+        li.appendChild(kind);
+        li.title = n.id;
+        li.addEventListener('mousedown', (ev) => {
+          ev.preventDefault();
+          results.hidden = true;
+          open(n.id);
+        });
+        results.appendChild(li);
+      }
+      if (r.page.more) {
+        const li = document.createElement('li');
+        li.className = 'kind';
+        li.textContent = '… 结果过多，请输入更精确的条件';
+        results.appendChild(li);
+      }
+      results.hidden = r.nodes.length === 0;
+      status(r.nodes.length === 0 ? '没有匹配的节点' : '');
+    } catch (err) {
+      status(err.message, true);
+    }
+  }
+
+  search.addEventListener('input', () => {
+    clearTimeout(searchTimer);
+    searchTimer = setTimeout(runSearch, 250);
+  });
+  search.addEventListener('keydown', (ev) => {
+    if (ev.key === 'Enter') {
+      const first = results.querySelector('li[title]');
+      if (first) {
+        results.hidden = true;
+        open(first.title);
+      }
+    } else if (ev.key === 'Escape') {
+      results.hidden = true;
+    }
+  });
+  search.addEventListener('blur', () => {
+    results.hidden = true;
+  });
+  search.addEventListener('focus', () => {
+    results.hidden = results.childElementCount === 0;
+  });
+
+  $('color-by').addEventListener('change', (ev) => {
+    state.colorBy = ev.target.value;
+    render();
+  });
+  $('fit').addEventListener('click', fit);
+
+  // ---------- 导出 ----------
+
+  // exportSVG 样式均写在元素属性上，复制节点即可得到独立的 SVG 文件
+  function exportSVG() {
+    const b = bounds();
+    if (!b) {
+      return null;
+    }
+    const out = svg.cloneNode(true);
+    out.removeAttribute('id');
+    out.removeAttribute('class');
+    out.setAttribute('xmlns', SVG_NS);
+    out.setAttribute('width', b.w);
+    out.setAttribute('height', b.h);
+    out.setAttribute('viewBox', b.x + ' ' + b.y + ' ' + b.w + ' ' + b.h);
+    out.querySelector('#viewport').removeAttribute('transform');
+    for (const e of out.querySelectorAll('.expand')) {
+      e.remove();
+    }
+    return {text: new XMLSerializer().serializeToString(out), w: b.w, h: b.h};
+  }
+
+  function download(blob, name) {
+    const a = document.createElement('a');
+    a.href = URL.createObjectURL(blob);
+    a.download = name;
+    a.click();
+    setTimeout(() => URL.revokeObjectURL(a.href), 1000);
+  }
+
+  $('export-svg').addEventListener('click', () => {
+    const s = exportSVG();
+    if (s) {
+      download(new Blob([s.text], {type: 'image/svg+xml'}), 'lineage.svg');
+    }
+  });
+
+  $('export-png').addEventListener('click', () => {
+    const s = exportSVG();
+    if (!s) {
+      return;
+    }
+    const scale = window.devicePixelRatio || 1;
+    const img = new Image();
+    img.onload = () => {
+      const canvas = document.createElement('canvas');
+      canvas.width = s.w * scale;
+      canvas.height = s.h * scale;
+      const ctx = canvas.getContext('2d');
+      ctx.fillStyle = '#fff';
+      ctx.fillRect(0, 0, canvas.width, canvas.height);
+      ctx.scale(scale, scale);
+      ctx.drawImage(img, 0, 0, s.w, s.h);
+      canvas.toBlob((blob) => download(blob, 'lineage.png'), 'image/png');
+    };
+    img.onerror = () => status('导出 PNG 失败', true);
+    img.src = 'data:image/svg+xml;charset=utf-8,' + encodeURIComponent(s.text);
+  });
+
+  // 支持 #<节点 id> 直接打开
+  if (location.hash.length > 1) {
+    open(decodeURIComponent(location.hash.slice(1)));
+  }
+})();
@@ -0,0 +1,46 @@
+package service
+
+import "pg_lineage/pkg/depgraph"
+
+// File COPY 等语句读写的文件，ID 带 file:// 前缀以免与表名冲突
+type File struct {
+	Path string
+}
+
+func (f *File) GetID() string {
+	return "file://" + f.Path
+}
+
+func (f *File) IsTemp() bool {
+	return false
+}
+
+func (f *File) GetKind() depgraph.NodeKind {
+	return depgraph.KindFile
+}
+
+func (f *File) GetAttributes() map[string]any {
+	return map[string]any{"path": f.Path}
+}
+
+// External 数据库之外的系统，如 COPY ... PROGRAM 调用的命令
+type External struct {
+	System string // 系统类型，如 program
+	Name   string
+}
+
+func (e *External) GetID() string {
+	return e.System + ":" + e.Name
+}
+
+func (e *External) IsTemp() bool {
+	return false
+}
+
+func (e *External) GetKind() depgraph.NodeKind {
+	return depgraph.KindExternal
+}
+
+func (e *External) GetAttributes() map[string]any {
+	return map[string]any{"system": e.System, "name": e.Name}
+}
@@ -3,6 +3,8 @@ package service
 import (
 	"strconv"
 
+	"pg_lineage/pkg/depgraph"
+
 	"github.com/grafana/grafana-openapi-client-go/models"
 )
 
@@ -29,6 +31,18 @@ func (p *Panel) IsTemp() bool {
 	return false
 }
 
+func (p *Panel) GetKind() depgraph.NodeKind {
+	return depgraph.KindPanel
+}
+
+func (p *Panel) GetAttributes() map[string]any {
+	return map[string]any{
+		"title":       p.Title,
+		"type":        p.Type,
+		"description": p.Description,
+	}
+}
+
 type TemplateVar struct {
 	Name       string `json:"name"`
 	Regex      string `json:"regex"`
@@ -63,6 +77,26 @@ type DashboardFullWithMeta struct {
 	Meta models.DashboardMeta `json:"meta,omitempty"`
 }
 
+func (d *DashboardFullWithMeta) GetID() string {
+	return d.Dashboard.UID
+}
+
+func (d *DashboardFullWithMeta) IsTemp() bool {
+	return false
+}
+
+func (d *DashboardFullWithMeta) GetKind() depgraph.NodeKind {
+	return depgraph.KindDashboard
+}
+
+func (d *DashboardFullWithMeta) GetAttributes() map[string]any {
+	return map[string]any{
+		"title":  d.Dashboard.Title,
+		"folder": d.Meta.FolderTitle,
+		"tags":   d.Dashboard.Tags,
+	}
+}
+
 type SqlTableDependency struct {
 	RawSql string
 	Tables []*Table
@@ -0,0 +1,26 @@
+package service
+
+// Join ERD 中两张表按字段的等值关联，From、To 与血缘中的表为同一节点
+type Join struct {
+	Database   string // 图的 namespace，与血缘一致取数据源 label
+	From       *Table
+	To         *Table
+	FromColumn string
+	ToColumn   string
+	Type       string // pg_query.JoinType，如 JOIN_INNER、JOIN_LEFT
+	Calls      int64  // 出现该关联的查询的执行次数
+}
+
+// GetID 同一对字段、同一种关联只有一条边，不含 namespace
+func (j *Join) GetID() string {
+	return j.From.GetID() + "." + j.FromColumn + "=" + j.To.GetID() + "." + j.ToColumn + ":" + j.Type
+}
+
+func (j *Join) GetAttributes() map[string]any {
+	return map[string]any{
+		"database":    j.Database,
+		"from_column": j.FromColumn,
+		"to_column":   j.ToColumn,
+		"join_type":   j.Type,
+	}
+}
@@ -3,6 +3,8 @@ package service
 import (
 	"strings"
 	"time"
+
+	"pg_lineage/pkg/depgraph"
 )
 
 const (
@@ -12,10 +14,20 @@ const (
 )
 
 const (
-	REL_PERSIST     = "p"
-	REL_PERSIST_NOT = "t"
+	REL_PERSIST          = "p"
+	REL_PERSIST_NOT      = "t"
+	REL_PERSIST_UNLOGGED = "u"
+)
+
+// pg_class.relkind 中的视图
+const (
+	REL_KIND_VIEW    = "v"
+	REL_KIND_MATVIEW = "m"
 )
 
+// REL_KIND_CTE 标记 WITH 子句，pg_class.relkind 中没有这个取值
+const REL_KIND_CTE = "cte"
+
 type Owner struct {
 	Username string
 	Nickname string
@@ -65,17 +77,52 @@ func (r *Table) IsTemp() bool {
 		r.SchemaName == ""
 }
 
+// GetKind 普通视图、物化视图为 view，其余（含 CTE、临时表）为 table
+func (r *Table) GetKind() depgraph.NodeKind {
+	switch r.RelKind {
+	case REL_KIND_VIEW, REL_KIND_MATVIEW:
+		return depgraph.KindView
+	}
+	return depgraph.KindTable
+}
+
+func (r *Table) GetAttributes() map[string]any {
+	return map[string]any{
+		"database":       r.Database,
+		"schema":         r.SchemaName,
+		"tablename":      r.RelName,
+		"relpersistence": r.RelPersistence,
+	}
+}
+
+// Class 供 ShrinkGraph 区分 CTE、临时表与未指定 schema 的表，后者可能是普通表
+func (r *Table) Class() depgraph.NodeClass {
+	switch {
+	case r.RelKind == REL_KIND_CTE:
+		return depgraph.ClassCTE
+	case strings.HasPrefix(r.SchemaName, "pg_temp_") || r.RelPersistence == REL_PERSIST_NOT:
+		return depgraph.ClassTemp
+	case r.RelPersistence == REL_PERSIST_UNLOGGED:
+		return depgraph.ClassUnlogged
+	case r.SchemaName == "":
+		return depgraph.ClassUnresolved
+	default:
+		return depgraph.ClassPersistent
+	}
+}
+
 type Udf struct {
 	ID         string
 	Database   string
 	SchemaName string
 	ProcName   string
 	Type       string
-	SrcID      string
-	DestID     string
 	Owner      *Owner
 	Calls      int64
+	MeanTime   float64 // pg_stat_statements 中的平均执行时间，毫秒
 	Comment    string
+	Query      string // 触发本次解析的原始 SQL
+	Definition string // 函数定义，pg_get_functiondef 的结果
 }
 
 func (o *Udf) GetID() string {
@@ -88,3 +135,19 @@ func (o *Udf) GetID() string {
 	}
 	return o.SchemaName + "." + o.ProcName
 }
+
+func (o *Udf) IsTemp() bool {
+	return false
+}
+
+func (o *Udf) GetKind() depgraph.NodeKind {
+	return depgraph.KindFunction
+}
+
+func (o *Udf) GetAttributes() map[string]any {
+	return map[string]any{
+		"database":   o.Database,
+		"schemaname": o.SchemaName,
+		"procname":   o.ProcName,
+	}
+}
@@ -1,248 +1,232 @@
 package main
 
 import (
-	"database/sql"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
-	"strconv"
 	"strings"
 
 	_ "github.com/lib/pq"
 
-	"pg_lineage/internal/lineage"
 	writer "pg_lineage/internal/lineage-writer"
-	"pg_lineage/internal/service"
 	C "pg_lineage/pkg/config"
-	"pg_lineage/pkg/depgraph"
 	"pg_lineage/pkg/log"
 )
 
-type QueryStore struct {
-	Query     string
-	Calls     int64
-	TotalTime float64
-	MinTime   float64
-	MaxTime   float64
-	MeanTime  float64
+// command 子命令，name 可以由多个单词组成，如 "collect pg"
+type command struct {
+	name    string
+	usage   string
+	offline bool // 不依赖配置文件，配置读取失败时使用默认日志配置
+	flags   func(fs *flag.FlagSet)
+	run     func(a *app, args []string) error
 }
 
-var config C.Config
+var commands = []*command{
+	{name: "collect pg", usage: "从 pg_stat_statements 解析表级血缘并补全表统计信息", flags: collectPGFlags, run: collectPG},
+	{name: "collect greenplum", usage: "补全 Greenplum 表统计信息", run: collectGreenplum},
+	{name: "collect grafana", usage: "采集 Grafana 看板、面板及其依赖的表", run: collectGrafana},
+	{name: "erd", usage: "从 SQL 文件或数据源的 pg_stat_statements 中解析表之间的关联关系", offline: true, flags: erdFlags, run: runERD},
+	{name: "report unused", usage: "导出没有血缘、调用及扫描记录的表", flags: reportUnusedFlags, run: reportUnused},
+	{name: "parse", usage: "离线解析 SQL / PL/pgSQL 文件或目录中的表级血缘", offline: true, flags: parseFlags, run: runParse},
+	{name: "catalog export", usage: "导出数据源的 catalog 快照，供离线解析使用", flags: catalogExportFlags, run: catalogExport},
+	{name: "serve", usage: "以 HTTP/JSON 提供血缘查询及 SQL 解析接口", flags: serveFlags, run: runServe},
+	{name: "reset", usage: "清空存储中的血缘图", run: runReset},
+	{name: "migrate", usage: "升级存储后端的表结构", run: runMigrate},
+	{name: "rename", usage: "将按旧命名规则写入的节点、边改为当前 storage.naming", flags: renameFlags, run: runRename},
+}
 
-func init() {
-	configFile := flag.String("c", "./config/config.yaml", "path to config.yaml")
-	flag.Parse()
+// 全局参数，在子命令前后均可指定
+var (
+	configFile = "./config/config.yaml"
+	dryRun     bool
+	labels     string
+)
 
-	var err error
-	if config, err = C.InitConfig(*configFile); err != nil {
-		fmt.Println("InitConfig error:", err)
-		os.Exit(1)
-	}
-	if err := log.InitLogger(&config.Log); err != nil {
-		fmt.Println("InitLogger error:", err)
-		os.Exit(1)
-	}
+// globalFlags 以当前值为默认值注册，子命令再次注册时不会覆盖子命令前已解析的值
+func globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configFile, "c", configFile, "path to config.yaml")
+	fs.BoolVar(&dryRun, "dry-run", dryRun, "parse and log lineage without writing to any storage")
+	fs.StringVar(&labels, "label", labels, "comma separated data source labels to process, all when empty")
+}
+
+// app 子命令共用的配置、日志及 writer 初始化
+type app struct {
+	config C.Config
+	dryRun bool
+	labels []string
 }
 
 func main() {
-	log.Infof("Log level: %s, log file: %s", config.Log.Level, config.Log.Path)
+	global := flag.NewFlagSet("pg_lineage", flag.ExitOnError)
+	globalFlags(global)
+	global.Usage = usage
+	global.Parse(os.Args[1:])
+
+	// 兼容旧的调用方式：不带子命令时等同于 collect pg
+	args := global.Args()
+	if len(args) == 0 {
+		args = []string{"collect", "pg"}
+	}
 
-	neo4jDriver, err := writer.InitNeo4jDriver(&config.Storage.Neo4j)
-	if err != nil {
-		log.Fatalf("InitNeo4jDriver error: %v", err)
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", strings.Join(args, " "))
+		usage()
+		os.Exit(2)
 	}
-	defer safeClose("neo4j", neo4jDriver)
 
-	pgWriterDriver, err := writer.InitPGClient(&config.Storage.Postgres)
-	if err != nil {
-		log.Fatalf("InitPostgresWriter error: %v", err)
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	globalFlags(fs)
+	if cmd.flags != nil {
+		cmd.flags(fs)
 	}
-	defer safeClose("postgres writer", pgWriterDriver)
+	fs.Parse(rest)
 
-	writerManager := writer.InitWriterManager(&writer.WriterContext{
-		Neo4jDriver: neo4jDriver,
-		PgDriver:    pgWriterDriver,
-	})
+	a, err := newApp(cmd)
+	if err != nil {
+		fmt.Println("Init error:", err)
+		os.Exit(1)
+	}
 
-	if err := writerManager.ResetGraph(); err != nil {
-		log.Fatalf("ResetGraph error: %v", err)
+	if err := cmd.run(a, fs.Args()); err != nil {
+		log.Fatalf("%s error: %v", cmd.name, err)
 	}
+}
 
-	for _, dsConf := range config.Service.Postgres {
-		// 目前仅支持 PG 高版本的血缘解析
-		if dsConf.Type != service.DBTypePostgres {
+// findCommand 按最长前缀匹配子命令
+func findCommand(args []string) (*command, []string) {
+	var (
+		found *command
+		n     int
+	)
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(words) > len(args) || len(words) <= n {
 			continue
 		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			found, n = cmd, len(words)
+		}
+	}
+	return found, args[n:]
+}
 
-		// TODO:如何扩展支持 GP，让代码写的更优雅一点
-
-		processDataSource(dsConf, writerManager)
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: pg_lineage [-c config.yaml] [-dry-run] [-label a,b] <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", cmd.name, cmd.usage)
 	}
+	fmt.Fprintln(os.Stderr, "\nGlobal flags:")
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	globalFlags(fs)
+	fs.SetOutput(os.Stderr)
+	fs.PrintDefaults()
 }
 
-func processDataSource(conf C.PostgresService, wm *writer.WriterManager) {
-	log.Infof("Processing data source: %s", conf.Label)
+func newApp(cmd *command) (*app, error) {
+	a := &app{dryRun: dryRun}
+	for _, l := range strings.Split(labels, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			a.labels = append(a.labels, l)
+		}
+	}
 
-	db, err := writer.InitPGClient(&conf)
-	if err != nil {
-		log.Errorf("Failed to connect to data source %s: %v", conf.Label, err)
-		return
+	// 离线命令在配置文件不存在时使用默认日志配置
+	if _, err := os.Stat(configFile); err == nil || !cmd.offline {
+		if a.config, err = C.InitConfig(configFile); err != nil {
+			return nil, err
+		}
+	} else {
+		a.config.Log = C.LogConfig{Level: "error", Path: "./logs/lineage.log"}
+	}
+	// 离线命令的结果输出到标准输出，日志改为输出到标准错误
+	if cmd.offline {
+		a.config.Log.Stderr = true
+	}
+	if err := log.InitLogger(&a.config.Log); err != nil {
+		return nil, err
 	}
-	defer safeClose(conf.Label, db)
 
-	queries, err := fetchQueryStats(db, conf.DBName)
-	if err != nil {
-		log.Errorf("Error fetching query stats for %s: %v", conf.Label, err)
-		return
+	log.Infof("Log level: %s, log file: %s", a.config.Log.Level, a.config.Log.Path)
+	return a, nil
+}
+
+// selected 未指定 -label 时选中所有数据源
+func (a *app) selected(label string) bool {
+	if len(a.labels) == 0 {
+		return true
+	}
+	for _, l := range a.labels {
+		if l == label {
+			return true
+		}
 	}
-	defer queries.Close()
+	return false
+}
 
-	for queries.Next() {
-		var qs QueryStore
-		if err := queries.Scan(&qs.Query, &qs.Calls, &qs.TotalTime, &qs.MinTime, &qs.MaxTime, &qs.MeanTime); err != nil {
-			log.Warnf("Query row scan error: %v", err)
-			continue
+// postgresServices 返回指定类型且被 -label 选中的数据源，typ 为空时不限类型
+func (a *app) postgresServices(typ string) []C.PostgresService {
+	var services []C.PostgresService
+	for _, s := range a.config.Service.Postgres {
+		if (typ == "" || s.Type == typ) && a.selected(s.Label) {
+			services = append(services, s)
 		}
-		handleQueryLineage(&qs, conf, db, wm)
 	}
+	return services
+}
 
-	if err := completeLineageGraph(conf, db, wm); err != nil {
-		log.Errorf("Complete graph update error for %s: %v", conf.Label, err)
-		return
+// writerManager -dry-run 时只启用 dryrun writer
+func (a *app) writerManager() (*writer.WriterManager, error) {
+	storage := a.config.Storage
+	if a.dryRun {
+		storage.Writers = []C.WriterConfig{{Type: writer.DryRunWriterType, Enabled: true}}
 	}
+	return writer.InitWriterManager(&storage)
 }
 
-func fetchQueryStats(db *sql.DB, dbName string) (*sql.Rows, error) {
-	// 获取 PostgreSQL 版本
-	var versionStr string
-	err := db.QueryRow("SHOW server_version;").Scan(&versionStr)
+func runReset(a *app, args []string) error {
+	wm, err := a.writerManager()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get postgres version: %w", err)
-	}
-
-	// 提取主版本号
-	re := regexp.MustCompile(`^(\d+)\.?(\d+)?`)
-	matches := re.FindStringSubmatch(versionStr)
-	if len(matches) < 2 {
-		return nil, fmt.Errorf("could not parse version string: %s", versionStr)
-	}
-	major, _ := strconv.Atoi(matches[1])
-	// minor := 0
-	// if len(matches) > 2 && matches[2] != "" {
-	// 	minor, _ = strconv.Atoi(matches[2])
-	// }
-
-	// 针对不同版本选择字段
-	var query string
-	if major >= 13 {
-		// PostgreSQL 13+ 使用 *_exec_time
-		query = fmt.Sprintf(`
-			SELECT 
-				s.query, s.calls, s.total_exec_time AS total_time,
-				s.min_exec_time AS min_time,
-				s.max_exec_time AS max_time,
-				s.mean_exec_time AS mean_time
-			FROM pg_stat_statements s
-			JOIN pg_database d ON d.oid = s.dbid
-			WHERE d.datname = '%s' AND calls > 10
-			ORDER BY s.mean_exec_time DESC
-			LIMIT 1000;`, dbName)
-	} else {
-		// PostgreSQL < 13 使用 *_time
-		query = fmt.Sprintf(`
-			SELECT 
-				s.query, s.calls, s.total_time, 
-				s.min_time, s.max_time, s.mean_time
-			FROM pg_stat_statements s
-			JOIN pg_database d ON d.oid = s.dbid
-			WHERE d.datname = '%s' AND calls > 10
-			ORDER BY s.mean_time DESC
-			LIMIT 1000;`, dbName)
-	}
-
-	return db.Query(query)
-}
-
-func handleQueryLineage(qs *QueryStore, conf C.PostgresService, db *sql.DB, wm *writer.WriterManager) {
-	var graph *depgraph.Graph
-	udf, err := lineage.IdentifyFuncCall(qs.Query)
-	if err == nil {
-		graph, err = lineage.HandleUDF4Lineage(db, udf)
-	} else {
-		graph, err = lineage.Parse(qs.Query)
+		return err
 	}
+	defer safeClose("lineage writers", wm)
 
-	if err != nil {
-		log.Debugf("Skip invalid query: %s, err: %v", trimQuery(qs.Query), err)
-		return
-	}
-
-	udf.Calls = qs.Calls
-	graph.SetNamespace(conf.Label)
-
-	log.Debugf("Lineage Graph for query: %s", trimQuery(qs.Query))
-	for i, layer := range graph.TopoSortedLayers() {
-		log.Debugf("Layer %d: %s", i, strings.Join(layer, ", "))
-	}
-
-	if err := wm.CreateGraphPostgres(graph.ShrinkGraph(), udf, conf); err != nil {
-		log.Errorf("Failed to write lineage graph: %v", err)
-	}
-}
-
-func completeLineageGraph(conf C.PostgresService, db *sql.DB, wm *writer.WriterManager) error {
-	rows, err := db.Query(`
-		SELECT 
-			COALESCE(p.relname, st.relname) AS relname,
-			COALESCE(n.nspname, st.schemaname) AS schemaname,
-			SUM(st.seq_scan) AS seq_scan,
-			SUM(st.seq_tup_read) AS seq_tup_read,
-			SUM(COALESCE(st.idx_scan, 0)) AS idx_scan,
-			SUM(COALESCE(st.idx_tup_fetch, 0)) AS idx_tup_fetch,
-			STRING_AGG(DISTINCT COALESCE(obj_description(st.relid), ''), ' | ') AS comment
-		FROM pg_stat_user_tables st
-		LEFT JOIN pg_inherits i ON st.relid = i.inhrelid
-		LEFT JOIN pg_class p ON i.inhparent = p.oid
-		LEFT JOIN pg_namespace n ON p.relnamespace = n.oid
-		WHERE st.schemaname !~ '^pg_temp_'
-		AND st.schemaname !~ '_del$'
-		AND st.schemaname NOT IN ('sync', 'sync_his', 'partman', 'debug')
-		GROUP BY COALESCE(p.relname, st.relname),
-				COALESCE(n.nspname, st.schemaname)
-		ORDER BY schemaname, relname;
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to query table stats: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var t service.Table
-		if err := rows.Scan(
-			&t.RelName, &t.SchemaName,
-			&t.SeqScan, &t.SeqTupRead,
-			&t.IdxScan, &t.IdxTupFetch,
-			&t.Comment,
-		); err != nil {
-			return fmt.Errorf("scan error: %w", err)
-		}
-		t.Database = conf.Label
+	return wm.ResetGraph()
+}
 
-		if err := wm.CompleteTableNode(&t, conf); err != nil {
-			return fmt.Errorf("failed to complete node: %w", err)
-		}
+func runMigrate(a *app, args []string) error {
+	if a.dryRun {
+		log.Infof("[dry-run] skip migrate")
+		return nil
 	}
+	return writer.Migrate(&a.config.Storage)
+}
 
-	log.Infof("Lineage node metadata updated for: %s", conf.Label)
-	return nil
+var renameFrom string
+
+func renameFlags(fs *flag.FlagSet) {
+	fs.StringVar(&renameFrom, "from", "", "config.yaml holding the old storage.naming, default naming when empty")
 }
 
-func trimQuery(query string) string {
-	if len(query) > 80 {
-		return query[:80] + "..."
+func runRename(a *app, args []string) error {
+	if a.dryRun {
+		log.Infof("[dry-run] skip rename")
+		return nil
+	}
+
+	var from C.NamingConfig
+	if renameFrom != "" {
+		// InitConfig 使用全局 viper，当前配置已解析完毕，不受影响
+		old, err := C.InitConfig(renameFrom)
+		if err != nil {
+			return err
+		}
+		from = old.Storage.Naming
 	}
-	return query
+	return writer.Rename(&a.config.Storage, from)
 }
 
 func safeClose(name string, closer interface{ Close() error }) {
@@ -252,3 +236,34 @@ func safeClose(name string, closer interface{ Close() error }) {
 		}
 	}
 }
+
+// sqlInput 一个 SQL 文件的内容
+type sqlInput struct {
+	name string
+	sql  string
+}
+
+// readInputs 依次读取文件内容，"-" 或未指定文件时读取标准输入
+func readInputs(args []string) ([]sqlInput, error) {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	var inputs []sqlInput
+	for _, name := range args {
+		var (
+			data []byte
+			err  error
+		)
+		if name == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, sqlInput{name: name, sql: string(data)})
+	}
+	return inputs, nil
+}
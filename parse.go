@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pg_lineage/internal/catalog"
+	"pg_lineage/internal/lineage"
+	"pg_lineage/pkg/depgraph"
+	"pg_lineage/pkg/log"
+)
+
+var (
+	parseFormat  string
+	parseCatalog string
+	parseShrink  bool
+	parseRemove  string
+)
+
+func parseFlags(fs *flag.FlagSet) {
+	fs.StringVar(&parseFormat, "format", "text", "output format: text | json | dot")
+	fs.StringVar(&parseCatalog, "catalog", "", "catalog snapshot file used to resolve UDF calls offline")
+	fs.BoolVar(&parseShrink, "shrink", true, "remove temporary nodes (CTE, temp tables) from the graph")
+	fs.StringVar(&parseRemove, "remove", "cte,temp", "node classes removed by -shrink: cte, temp, unlogged, unresolved")
+}
+
+// shrinkClasses 解析 -remove
+func shrinkClasses() ([]depgraph.NodeClass, error) {
+	classes := []depgraph.NodeClass{}
+	for _, s := range strings.Split(parseRemove, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		c, err := depgraph.ParseNodeClass(s)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// parseResult 一个输入文件的解析结果，也是 -format json 的输出格式
+type parseResult struct {
+	File     string           `json:"file"`
+	Kind     string           `json:"kind"`
+	Function string           `json:"function,omitempty"` // udf-call 时为 schema.name
+	Error    string           `json:"error,omitempty"`
+	Nodes    []parseNode      `json:"nodes"`
+	Edges    []*depgraph.Edge `json:"edges"`
+	Layers   [][]string       `json:"layers"`
+	Cycles   [][]string       `json:"cycles,omitempty"` // 环上的节点不在 layers 中
+}
+
+type parseNode struct {
+	ID    string             `json:"id"`
+	Kind  depgraph.NodeKind  `json:"kind"`
+	Temp  bool               `json:"temp,omitempty"`
+	Class depgraph.NodeClass `json:"class"`
+}
+
+// runParse 离线解析 SQL / PL/pgSQL 文件、目录（递归查找 *.sql）或标准输入，不连接数据库；
+// 有文件解析失败时返回错误，便于在 CI 中使用
+func runParse(a *app, args []string) error {
+	var snapshot *catalog.Snapshot
+	if parseCatalog != "" {
+		var err error
+		if snapshot, err = catalog.Load(parseCatalog); err != nil {
+			return err
+		}
+	}
+
+	remove, err := shrinkClasses()
+	if err != nil {
+		return err
+	}
+
+	files, err := expandInputs(args)
+	if err != nil {
+		return err
+	}
+	inputs, err := readInputs(files)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*parseResult, 0, len(inputs))
+	failed := 0
+	for _, in := range inputs {
+		r := parseInput(in, snapshot, remove)
+		if r.Error != "" {
+			failed++
+			log.Errorf("Parse %s error: %s", r.File, r.Error)
+		}
+		results = append(results, r)
+	}
+
+	switch parseFormat {
+	case "text":
+		err = writeParseText(os.Stdout, results)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	case "dot":
+		err = writeParseDOT(os.Stdout, results)
+	default:
+		return fmt.Errorf("unknown format %q", parseFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d inputs failed to parse", failed, len(inputs))
+	}
+	return nil
+}
+
+// expandInputs 目录展开为其下所有 .sql 文件，按路径排序
+func expandInputs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if arg == "-" || err != nil || !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".sql") {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+func parseInput(in sqlInput, snapshot *catalog.Snapshot, remove []depgraph.NodeClass) *parseResult {
+	// nil 的 *Snapshot 赋给接口后不为 nil，需单独判断
+	var cat catalog.Catalog
+	if snapshot != nil {
+		cat = snapshot
+	}
+
+	script, err := lineage.ParseScript(in.sql, cat)
+	r := &parseResult{File: in.name, Kind: script.Kind, Function: script.Function}
+	if errors.Is(err, lineage.ErrNoCatalog) {
+		err = errors.New("UDF call requires -catalog to resolve the function definition")
+	}
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	graph := script.Graph
+	if parseShrink {
+		graph = graph.Shrink(depgraph.ShrinkOptions{Remove: remove})
+	}
+
+	for id, n := range graph.GetNodes() {
+		r.Nodes = append(r.Nodes, parseNode{ID: id, Kind: n.GetKind(), Temp: n.IsTemp(), Class: depgraph.DefaultClassifier(n)})
+	}
+	sort.Slice(r.Nodes, func(i, j int) bool { return r.Nodes[i].ID < r.Nodes[j].ID })
+
+	r.Edges = graph.Edges()
+
+	r.Layers, _ = graph.TopoSortedLayers()
+	r.Cycles = graph.Cycles()
+	return r
+}
+
+func writeParseText(out io.Writer, results []*parseResult) error {
+	for _, r := range results {
+		fmt.Fprintf(out, "# %s (%s", r.File, r.Kind)
+		if r.Function != "" {
+			fmt.Fprintf(out, " %s", r.Function)
+		}
+		fmt.Fprintln(out, ")")
+
+		if r.Error != "" {
+			fmt.Fprintf(out, "error: %s\n\n", r.Error)
+			continue
+		}
+		for _, e := range r.Edges {
+			fmt.Fprintf(out, "%s -> %s", e.From, e.To)
+			if via, ok := e.Attributes[depgraph.AttrVia].([]string); ok {
+				fmt.Fprintf(out, " (via %s)", strings.Join(via, ", "))
+			}
+			fmt.Fprintln(out)
+		}
+		for i, layer := range r.Layers {
+			fmt.Fprintf(out, "layer %d: %s\n", i, strings.Join(layer, ", "))
+		}
+		for _, c := range r.Cycles {
+			fmt.Fprintf(out, "cycle: %s\n", strings.Join(c, ", "))
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+// writeParseDOT 每个文件一个 cluster，节点 ID 加上文件序号以免不同文件的同名表合并，临时节点为虚线，
+// COPY 读写的文件为 tab，外部命令为 component
+func writeParseDOT(out io.Writer, results []*parseResult) error {
+	fmt.Fprintln(out, "digraph lineage {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	fmt.Fprintln(out, `  node [shape=box, fontname="Helvetica", fontsize=10];`)
+
+	for i, r := range results {
+		if r.Error != "" {
+			continue
+		}
+		id := func(n string) string { return strconv.Quote(fmt.Sprintf("%d:%s", i, n)) }
+
+		fmt.Fprintf(out, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(out, "    label=%s;\n", strconv.Quote(r.File))
+		for _, n := range r.Nodes {
+			style := ""
+			if n.Temp {
+				style = ", style=dashed"
+			}
+			switch n.Kind {
+			case depgraph.KindFile:
+				style += ", shape=tab"
+			case depgraph.KindExternal:
+				style += ", shape=component"
+			}
+			fmt.Fprintf(out, "    %s [label=%s%s];\n", id(n.ID), strconv.Quote(n.ID), style)
+		}
+		for _, e := range r.Edges {
+			attrs := ""
+			if via, ok := e.Attributes[depgraph.AttrVia].([]string); ok {
+				attrs = fmt.Sprintf(" [label=%s, style=dashed]", strconv.Quote("via "+strings.Join(via, ", ")))
+			}
+			fmt.Fprintf(out, "    %s -> %s%s;\n", id(e.From), id(e.To), attrs)
+		}
+		fmt.Fprintln(out, "  }")
+	}
+
+	_, err := fmt.Fprintln(out, "}")
+	return err
+}
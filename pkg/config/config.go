@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -14,13 +16,40 @@ type Config struct {
 }
 
 type StorageConfig struct {
+	// 启用的存储后端列表，type 为 writer 的注册名，settings 由各 writer 自行解析
+	Writers []WriterConfig `mapstructure:"writers"`
+
+	// 点、边的命名规则，postgres / sqlite 等按名称去重的后端共用
+	Naming NamingConfig `mapstructure:"naming"`
+
+	// 兼容旧配置：writers 为空时，enabled 的 neo4j/postgres 在 InitConfig 时转换为对应类型的 writer
 	Neo4j    Neo4jService    `mapstructure:"neo4j"`
 	Postgres PostgresService `mapstructure:"postgres"`
 }
 
+type WriterConfig struct {
+	Type     string         `mapstructure:"type"`
+	Enabled  bool           `mapstructure:"enabled"`
+	Settings map[string]any `mapstructure:"settings"`
+}
+
+// NamingConfig 命名模板为 text/template，可用变量见 writer.URNVars，留空使用默认值
+type NamingConfig struct {
+	Table     string `mapstructure:"table"`     // 默认 {{.Zone}}:{{.Type}}:{{.Label}}:{{.DBName}}.{{.Schema}}.{{.Table}}
+	Dashboard string `mapstructure:"dashboard"` // 默认 {{.Zone}}:grafana:{{.Host}}:{{.Folder}}>{{.Dashboard}}
+	Panel     string `mapstructure:"panel"`     // 默认 {{.Zone}}:grafana:{{.Host}}:{{.Folder}}>{{.Dashboard}}>{{.Panel}}
+	Node      string `mapstructure:"node"`      // 文件、外部系统等其他节点，默认 {{.Zone}}:{{.Kind}}:{{.Label}}:{{.Name}}
+	Edge      string `mapstructure:"edge"`      // 边名取 md5 前的拼接方式，默认 {{.Up}}_{{.Down}}_{{.Attribute}}
+
+	Author   string            `mapstructure:"author"`   // 写入 author 字段，默认 ITC180012
+	Site     string            `mapstructure:"site"`     // 写入 site 字段，默认取数据源的 zone
+	Services map[string]string `mapstructure:"services"` // 数据源类型到 service 标签的映射，如 postgresql: pg
+}
+
 type LogConfig struct {
-	Level string `mapstructure:"level"`
-	Path  string `mapstructure:"path"`
+	Level  string `mapstructure:"level"`
+	Path   string `mapstructure:"path"`
+	Stderr bool   `mapstructure:"stderr"` // 控制台日志输出到标准错误，标准输出留给命令的结果
 }
 
 type ServiceConfig struct {
@@ -32,7 +61,17 @@ type Neo4jService struct {
 	URL      string `mapstructure:"url"`
 	User     string `mapstructure:"user"`
 	Password string `mapstructure:"password"`
+	Database string `mapstructure:"database"` // 为空时使用服务端默认库
 	Enabled  bool   `mapstructure:"enabled"`
+
+	// 加密与信任策略，仅在 URL 为 neo4j:// 或 bolt:// 时生效
+	// neo4j+s:// 等带加密的 scheme 以 URL 为准
+	Encrypted     bool   `mapstructure:"encrypted"`
+	TrustStrategy string `mapstructure:"trust_strategy"` // system(默认) | all
+	CACertFile    string `mapstructure:"ca_cert_file"`   // 自签名 CA 证书，PEM 格式
+
+	MaxTransactionRetryTime time.Duration `mapstructure:"max_transaction_retry_time"` // 瞬时错误的重试时长，默认 30s
+	BatchSize               int           `mapstructure:"batch_size"`                 // UNWIND 批量写入行数，默认 1000
 }
 
 type PostgresService struct {
@@ -54,6 +93,52 @@ type GrafanaService struct {
 	Datasources  map[string]string `json:"datasources"`
 }
 
+// EnabledWriters 返回启用的 writer 配置，旧的 neo4j/postgres 配置在 InitConfig 时已转换为 writers
+func (c *StorageConfig) EnabledWriters() []WriterConfig {
+	var writers []WriterConfig
+	for _, w := range c.Writers {
+		if w.Enabled {
+			writers = append(writers, w)
+		}
+	}
+	return writers
+}
+
+// convertLegacy 未配置 writers 时，将启用的旧 neo4j/postgres 配置转换为 writers
+func (c *StorageConfig) convertLegacy() error {
+	if len(c.Writers) > 0 {
+		return nil
+	}
+
+	for _, legacy := range []struct {
+		typ     string
+		enabled bool
+		conf    any
+	}{
+		{"neo4j", c.Neo4j.Enabled, c.Neo4j},
+		{"postgres", c.Postgres.Enabled, c.Postgres},
+	} {
+		if !legacy.enabled {
+			continue
+		}
+		w, err := legacyWriter(legacy.typ, legacy.conf)
+		if err != nil {
+			return err
+		}
+		c.Writers = append(c.Writers, w)
+	}
+	return nil
+}
+
+func legacyWriter(typ string, conf any) (WriterConfig, error) {
+	settings := make(map[string]any)
+	// 结构体转 map，键名沿用 mapstructure tag
+	if err := mapstructure.Decode(conf, &settings); err != nil {
+		return WriterConfig{}, fmt.Errorf("convert legacy storage.%s config: %w", typ, err)
+	}
+	return WriterConfig{Type: typ, Enabled: true, Settings: settings}, nil
+}
+
 func InitConfig(cfgFile string) (Config, error) {
 
 	var config Config
@@ -75,16 +160,15 @@ func InitConfig(cfgFile string) (Config, error) {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// 读取配置文件
-	err := viper.ReadInConfig()
-	if err != nil {
-		fmt.Println("Error reading config file:", err)
-		return config, err
+	if err := viper.ReadInConfig(); err != nil {
+		return config, fmt.Errorf("read config file: %w", err)
 	}
 
 	// 将配置文件内容解析到结构体中
-	err = viper.Unmarshal(&config)
-	if err != nil {
-		fmt.Println("Error parsing config file:", err)
+	if err := viper.Unmarshal(&config); err != nil {
+		return config, fmt.Errorf("parse config file: %w", err)
+	}
+	if err := config.Storage.convertLegacy(); err != nil {
 		return config, err
 	}
 
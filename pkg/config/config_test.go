@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitConfigLegacyStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`
+storage:
+  neo4j:
+    url: neo4j://localhost:7687
+    user: neo4j
+    enabled: true
+  postgres:
+    host: localhost
+    enabled: false
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := InitConfig(path)
+	if err != nil {
+		t.Fatalf("InitConfig: %v", err)
+	}
+	writers := c.Storage.EnabledWriters()
+	if len(writers) != 1 || writers[0].Type != "neo4j" {
+		t.Fatalf("writers = %+v, want the legacy neo4j writer", writers)
+	}
+	if got := writers[0].Settings["url"]; got != "neo4j://localhost:7687" {
+		t.Errorf("settings.url = %v", got)
+	}
+}
+
+func TestInitConfigMissingFile(t *testing.T) {
+	if _, err := InitConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("InitConfig: want error for a missing file")
+	}
+}
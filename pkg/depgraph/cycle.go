@@ -0,0 +1,242 @@
+package depgraph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CycleError is returned by TopoSortedLayers when some nodes cannot be sorted because of cycles.
+type CycleError struct {
+	Cycles  [][]string `json:"cycles"`  // see Graph.Cycles
+	Blocked []string   `json:"blocked"` // nodes outside the cycles that depend on them, sorted
+}
+
+func (e *CycleError) Error() string {
+	cycles := make([]string, len(e.Cycles))
+	for i, c := range e.Cycles {
+		cycles[i] = "{" + strings.Join(c, ", ") + "}"
+	}
+	msg := fmt.Sprintf("graph contains %d cycle(s): %s", len(e.Cycles), strings.Join(cycles, " "))
+	if len(e.Blocked) > 0 {
+		msg += fmt.Sprintf(", %d node(s) depend on them", len(e.Blocked))
+	}
+	return msg
+}
+
+// StronglyConnectedComponents returns the strongly connected components of the graph, found with
+// Tarjan's algorithm. Each component is sorted, and the components are in topological order: a
+// component comes before every component that depends on it. Vertices and edges are visited in
+// sorted order, so the result is deterministic.
+func (g *Graph) StronglyConnectedComponents() [][]string {
+	// edges may reference IDs that were never added as nodes, they are components too
+	roots := make([]int, 0, len(g.index))
+	for _, i := range g.index {
+		roots = append(roots, i)
+	}
+	sort.Slice(roots, func(a, b int) bool { return g.ids[roots[a]] < g.ids[roots[b]] })
+
+	t := &tarjan{
+		g:       g,
+		index:   make([]int, len(g.ids)),
+		low:     make([]int, len(g.ids)),
+		onStack: make([]bool, len(g.ids)),
+	}
+	for i := range t.index {
+		t.index[i] = -1
+	}
+	for _, v := range roots {
+		if t.index[v] < 0 {
+			t.visit(v)
+		}
+	}
+
+	// Tarjan emits a component after all the components it reaches, i.e. children first
+	slices.Reverse(t.components)
+	return t.components
+}
+
+// Cycles returns the strongly connected components that contain a cycle: those with more than
+// one node, or a single node with an edge to itself.
+func (g *Graph) Cycles() [][]string {
+	var cycles [][]string
+	for _, c := range g.StronglyConnectedComponents() {
+		if len(c) > 1 || g.Edge(c[0], c[0]) != nil {
+			cycles = append(cycles, c)
+		}
+	}
+	return cycles
+}
+
+type tarjan struct {
+	g          *Graph
+	next       int
+	index      []int // visit order, -1 if not visited yet
+	low        []int
+	stack      []int
+	onStack    []bool
+	components [][]string
+}
+
+// frame is a vertex on the DFS stack and the position in its sorted children
+type frame struct {
+	v        int
+	children []int
+	pos      int
+}
+
+func (t *tarjan) enter(v int) frame {
+	t.index[v] = t.next
+	t.low[v] = t.next
+	t.next++
+	t.stack = append(t.stack, v)
+	t.onStack[v] = true
+	return frame{v: v, children: t.g.sortedNeighbours(t.g.dependents[v])}
+}
+
+// visit is the iterative form of the recursive algorithm, long chains of 100k+ tables do not
+// need a matching call depth
+func (t *tarjan) visit(root int) {
+	dfs := []frame{t.enter(root)}
+	for len(dfs) > 0 {
+		f := &dfs[len(dfs)-1]
+		if f.pos < len(f.children) {
+			w := f.children[f.pos]
+			f.pos++
+			if t.index[w] < 0 {
+				dfs = append(dfs, t.enter(w))
+			} else if t.onStack[w] {
+				t.low[f.v] = min(t.low[f.v], t.index[w])
+			}
+			continue
+		}
+
+		v := f.v
+		dfs = dfs[:len(dfs)-1]
+		if len(dfs) > 0 {
+			parent := dfs[len(dfs)-1].v
+			t.low[parent] = min(t.low[parent], t.low[v])
+		}
+		if t.low[v] != t.index[v] {
+			continue
+		}
+
+		var component []string
+		for {
+			w := t.stack[len(t.stack)-1]
+			t.stack = t.stack[:len(t.stack)-1]
+			t.onStack[w] = false
+			component = append(component, t.g.ids[w])
+			if w == v {
+				break
+			}
+		}
+		sort.Strings(component)
+		t.components = append(t.components, component)
+	}
+}
+
+// Component is the super-node that replaces a cycle in a condensed graph.
+type Component struct {
+	ID      string
+	Members []Node  // sorted by ID
+	Edges   []*Edge // the edges among the members
+}
+
+func (c *Component) GetID() string {
+	return c.ID
+}
+
+// IsTemp is true only if all members are temporary, so ShrinkGraph keeps a cycle that
+// involves a real table.
+func (c *Component) IsTemp() bool {
+	for _, n := range c.Members {
+		if !n.IsTemp() {
+			return false
+		}
+	}
+	return true
+}
+
+// GetKind is the kind shared by all members, KindTable if they differ.
+func (c *Component) GetKind() NodeKind {
+	kind := KindTable
+	for i, n := range c.Members {
+		switch k := n.GetKind(); {
+		case i == 0:
+			kind = k
+		case k != kind:
+			return KindTable
+		}
+	}
+	return kind
+}
+
+// GetAttributes lists the IDs of the members.
+func (c *Component) GetAttributes() map[string]any {
+	members := make([]string, len(c.Members))
+	for i, n := range c.Members {
+		members[i] = n.GetID()
+	}
+	return map[string]any{"members": members}
+}
+
+// Class is the class shared by all members, ClassPersistent if they differ.
+func (c *Component) Class() NodeClass {
+	class := ClassPersistent
+	for i, n := range c.Members {
+		switch m := DefaultClassifier(n); {
+		case i == 0:
+			class = m
+		case m != class:
+			return ClassPersistent
+		}
+	}
+	return class
+}
+
+// ComponentID is the ID of the super-node for the given, sorted, member IDs.
+func ComponentID(members []string) string {
+	return "{" + strings.Join(members, ",") + "}"
+}
+
+// Condense returns a copy of the graph in which every cycle is replaced by a *Component. Edges
+// between the members move into the component, edges from or to a member are attached to the
+// component and merged when several members share a neighbour. The result is acyclic.
+func (g *Graph) Condense() *Graph {
+	owner := make(map[string]string)
+	condensed := New()
+	condensed.namespace = g.namespace
+
+	for _, ids := range g.StronglyConnectedComponents() {
+		if len(ids) == 1 && g.Edge(ids[0], ids[0]) == nil {
+			owner[ids[0]] = ids[0]
+			if n, ok := g.nodes[ids[0]]; ok {
+				condensed.AddNode(n)
+			}
+			continue
+		}
+
+		c := &Component{ID: ComponentID(ids)}
+		for _, id := range ids {
+			owner[id] = c.ID
+			if n, ok := g.nodes[id]; ok {
+				c.Members = append(c.Members, n)
+			}
+		}
+		condensed.AddNode(c)
+	}
+
+	for _, e := range g.Edges() {
+		from, to := owner[e.From], owner[e.To]
+		if from == to {
+			c := condensed.nodes[from].(*Component)
+			c.Edges = append(c.Edges, e.clone())
+			continue
+		}
+		condensed.mergeEdge(from, to, e)
+	}
+
+	return condensed
+}
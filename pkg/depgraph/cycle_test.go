@@ -0,0 +1,104 @@
+package depgraph
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// cyclicGraph x -> a -> b <-> c -> d -> d -> e <-> f -> z, and b -> d
+func cyclicGraph() *Graph {
+	return testGraph(map[string]any{AttrCalls: int64(1)},
+		[2]string{"x", "a"}, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "b"},
+		[2]string{"c", "d"}, [2]string{"b", "d"}, [2]string{"d", "d"},
+		[2]string{"d", "e"}, [2]string{"e", "f"}, [2]string{"f", "e"}, [2]string{"f", "z"})
+}
+
+func TestCycles(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		g      *Graph
+		sccs   string
+		cycles string
+	}{
+		{
+			name:   "several components",
+			g:      cyclicGraph(),
+			sccs:   "[[x] [a] [b c] [d] [e f] [z]]",
+			cycles: "[[b c] [d] [e f]]",
+		},
+		{
+			name:   "self loop only",
+			g:      testGraph(nil, [2]string{"a", "a"}, [2]string{"a", "b"}),
+			sccs:   "[[a] [b]]",
+			cycles: "[[a]]",
+		},
+		{
+			name:   "acyclic",
+			g:      testGraph(nil, [2]string{"a", "b"}, [2]string{"a", "c"}, [2]string{"b", "c"}),
+			sccs:   "[[a] [b] [c]]",
+			cycles: "[]",
+		},
+	} {
+		if got := fmt.Sprint(tc.g.StronglyConnectedComponents()); got != tc.sccs {
+			t.Errorf("%s: components = %s, want %s", tc.name, got, tc.sccs)
+		}
+		if got := fmt.Sprint(tc.g.Cycles()); got != tc.cycles {
+			t.Errorf("%s: cycles = %s, want %s", tc.name, got, tc.cycles)
+		}
+	}
+}
+
+func TestTopoSortedLayersReportsCycles(t *testing.T) {
+	layers, err := cyclicGraph().TopoSortedLayers()
+	if got := fmt.Sprint(layers); got != "[[x] [a]]" {
+		t.Errorf("layers = %s, want the nodes before the first cycle", got)
+	}
+
+	var cycleErr *CycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("err = %v, want a *CycleError", err)
+	}
+	if got := fmt.Sprint(cycleErr.Cycles); got != "[[b c] [d] [e f]]" {
+		t.Errorf("cycles = %s", got)
+	}
+	if got := fmt.Sprint(cycleErr.Blocked); got != "[z]" {
+		t.Errorf("blocked = %s, want [z]", got)
+	}
+}
+
+func TestCondense(t *testing.T) {
+	g := cyclicGraph()
+	condensed := g.Condense()
+
+	if cycles := condensed.Cycles(); len(cycles) != 0 {
+		t.Errorf("condensed graph has cycles %v", cycles)
+	}
+	layers, err := condensed.TopoSortedLayers()
+	if err != nil {
+		t.Fatalf("TopoSortedLayers: %v", err)
+	}
+	if got := fmt.Sprint(layers); got != "[[x] [a] [{b,c}] [{d}] [{e,f}] [z]]" {
+		t.Errorf("layers = %s", got)
+	}
+
+	// b -> d and c -> d are merged into one edge of the component
+	if e := condensed.Edge("{b,c}", "{d}"); e == nil || e.Attributes[AttrCalls] != int64(2) {
+		t.Errorf("{b,c} -> {d} = %+v, want calls 2", e)
+	}
+	for id, want := range map[string]struct{ members, edges int }{"{b,c}": {2, 2}, "{d}": {1, 1}, "{e,f}": {2, 2}} {
+		c, ok := condensed.GetNodes()[id].(*Component)
+		if !ok {
+			t.Errorf("%s is not a component", id)
+			continue
+		}
+		if len(c.Members) != want.members || len(c.Edges) != want.edges {
+			t.Errorf("%s: %d members and %d inner edges, want %d and %d", id, len(c.Members), len(c.Edges), want.members, want.edges)
+		}
+	}
+
+	// the original graph keeps its cycles
+	if len(g.Cycles()) != 3 {
+		t.Error("Condense changed the original graph")
+	}
+}
@@ -2,14 +2,29 @@ package depgraph
 
 import (
 	"errors"
-	"log"
+	"sort"
+)
 
-	"github.com/mitchellh/copystructure"
+// NodeKind is what a node stands for. Writers use it to label the node and to build its name.
+type NodeKind string
+
+const (
+	KindTable     NodeKind = "table"
+	KindView      NodeKind = "view"
+	KindFunction  NodeKind = "function"
+	KindPanel     NodeKind = "panel"
+	KindDashboard NodeKind = "dashboard"
+	KindFile      NodeKind = "file"     // a file read or written by COPY, an export, etc.
+	KindExternal  NodeKind = "external" // a system outside of the databases, e.g. a COPY PROGRAM
 )
 
 type Node interface {
 	GetID() string
 	IsTemp() bool
+	GetKind() NodeKind
+	// GetAttributes returns the properties stored with the node, they must be encodable as JSON.
+	// The map may be shared, callers must not change it.
+	GetAttributes() map[string]any
 }
 
 // Node collection
@@ -19,27 +34,35 @@ type nodeset map[string]Node
 // Dependency between nodes using adjacency list
 type depmap map[string]map[string]struct{}
 
+// adjacency maps the interned ID of a neighbour to the edge shared with it
+type adjacency map[int]*Edge
+
 type Graph struct {
 	nodes nodeset
 
+	// IDs of nodes, and of edge endpoints that were never added as nodes, are interned as
+	// integers, so traversals work on slices indexed by int instead of maps keyed by string.
+	// A removed ID keeps its slot in `ids` but is dropped from `index`.
+	index map[string]int
+	ids   []string
+
 	// Maintain dependency relationships in both directions. These
-	// data structures are the edges of the graph.
+	// data structures are the edges of the graph, indexed by interned ID.
+	// Both directions point to the same *Edge.
 
 	// `dependencies` tracks child -> parents.
-	dependencies depmap
+	dependencies []adjacency
 	// `dependents` tracks parent -> children.
-	dependents depmap
-	// Keep track of the nodes of the graph themselves.
+	dependents []adjacency
 
 	namespace string
 }
 
 func New() *Graph {
 	return &Graph{
-		dependencies: make(depmap),
-		dependents:   make(depmap),
-		nodes:        make(nodeset),
-		namespace:    "default",
+		nodes:     make(nodeset),
+		index:     make(map[string]int),
+		namespace: "default",
 	}
 }
 
@@ -47,8 +70,21 @@ func (g *Graph) GetNodes() nodeset {
 	return g.nodes
 }
 
+// GetRelationships returns parent -> children for every parent with at least one child.
+// The map is built on each call, changing it does not change the graph.
 func (g *Graph) GetRelationships() depmap {
-	return g.dependents
+	dm := make(depmap)
+	for p, children := range g.dependents {
+		if len(children) == 0 || !g.live(p) {
+			continue
+		}
+		set := make(map[string]struct{}, len(children))
+		for c := range children {
+			set[g.ids[c]] = struct{}{}
+		}
+		dm[g.ids[p]] = set
+	}
+	return dm
 }
 
 func (g *Graph) GetNamespace() string {
@@ -59,63 +95,141 @@ func (g *Graph) SetNamespace(namespace string) {
 	g.namespace = namespace
 }
 
+// intern returns the integer ID of `id`, allocating one if needed.
+func (g *Graph) intern(id string) int {
+	if i, ok := g.index[id]; ok {
+		return i
+	}
+	i := len(g.ids)
+	g.index[id] = i
+	g.ids = append(g.ids, id)
+	g.dependencies = append(g.dependencies, nil)
+	g.dependents = append(g.dependents, nil)
+	return i
+}
+
+func (g *Graph) live(i int) bool {
+	j, ok := g.index[g.ids[i]]
+	return ok && j == i
+}
+
 // Add nodes and relationships
 func (g *Graph) DependOn(child Node, parent Node) error {
+	return g.DependOnEdge(child, parent, Edge{Kind: EdgeData})
+}
+
+// DependOnEdge is DependOn with the kind, attributes and provenance of the edge given by `e`.
+// `e.From` and `e.To` are ignored.
+func (g *Graph) DependOnEdge(child Node, parent Node, e Edge) error {
 	if child.GetID() == parent.GetID() {
 		return errors.New("self-referential dependencies not allowed")
 	}
 
-	if g.DependsOn(parent.GetID(), child.GetID()) {
-		log.Printf("[WARN] Dependency %s -> %s already exists", child.GetID(), parent.GetID())
-		// If there is a circular dependency among several nodes, it will not be processed for now, just recording.
-		// return errors.New("circular dependencies not allowed")
-	}
+	// Circular dependencies are allowed, e.g. a function reading and writing the same staging
+	// table. They are reported by Cycles() and TopoSortedLayers().
 
 	// Add nodes and edges
-	g.AddNode(parent).AddNode(child).AddEdge(parent, child)
+	g.AddNode(parent).AddNode(child).MergeEdge(parent, child, e)
 
 	return nil
 }
 
+// AddEdge adds a data edge parent -> child.
 func (g *Graph) AddEdge(parent Node, child Node) *Graph {
-	addDependency(g.dependents, parent.GetID(), child.GetID())
-	addDependency(g.dependencies, child.GetID(), parent.GetID())
+	return g.MergeEdge(parent, child, Edge{Kind: EdgeData})
+}
+
+// MergeEdge adds the edge parent -> child, or merges `e` into the existing one: AttrCalls are summed,
+// AttrMeanTime is weighted by calls, other attributes already on the edge are kept. See Edge.merge.
+func (g *Graph) MergeEdge(parent Node, child Node, e Edge) *Graph {
+	return g.mergeEdge(parent.GetID(), child.GetID(), &e)
+}
 
+func (g *Graph) mergeEdge(parent, child string, e *Edge) *Graph {
+	g.mergeAt(g.intern(parent), g.intern(child), e)
 	return g
 }
 
-func addDependency(dm depmap, key string, node string) {
-	nodes, ok := dm[key]
+// mergeAt is mergeEdge on interned IDs.
+func (g *Graph) mergeAt(p, c int, e *Edge) {
+	if old, ok := g.dependents[p][c]; ok {
+		old.merge(e)
+		return
+	}
+
+	e = e.clone()
+	e.From, e.To = g.ids[p], g.ids[c]
+	g.link(p, c, e)
+}
+
+func (g *Graph) link(p, c int, e *Edge) {
+	if g.dependents[p] == nil {
+		g.dependents[p] = make(adjacency)
+	}
+	g.dependents[p][c] = e
+	if g.dependencies[c] == nil {
+		g.dependencies[c] = make(adjacency)
+	}
+	g.dependencies[c][p] = e
+}
+
+// Edge returns the edge parent -> child, nil if there is none. The returned value is
+// owned by the graph.
+func (g *Graph) Edge(parent, child string) *Edge {
+	p, ok := g.index[parent]
 	if !ok {
-		nodes = make(map[string]struct{})
-		dm[key] = nodes
+		return nil
 	}
-	nodes[node] = struct{}{}
+	c, ok := g.index[child]
+	if !ok {
+		return nil
+	}
+	return g.dependents[p][c]
+}
+
+// Edges returns all edges ordered by parent, then child.
+func (g *Graph) Edges() []*Edge {
+	var edges []*Edge
+	for p, children := range g.dependents {
+		if !g.live(p) {
+			continue
+		}
+		for _, e := range children {
+			edges = append(edges, e)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	if edges == nil {
+		edges = []*Edge{}
+	}
+	return edges
 }
 
 func (g *Graph) AddNode(node Node) *Graph {
 	g.nodes[node.GetID()] = node
+	g.intern(node.GetID())
 
 	return g
 }
 
 func (g *Graph) DependsOn(child, parent string) bool {
-	deps := g.Dependencies(child)
-	_, ok := deps[parent]
-	return ok
+	return g.reaches(child, parent, g.dependencies)
 }
 
 func (g *Graph) HasDependent(parent, child string) bool {
-	deps := g.Dependents(parent)
-	_, ok := deps[child]
-	return ok
+	return g.reaches(parent, child, g.dependents)
 }
 
 func (g *Graph) Leaves() []string {
 	leaves := make([]string, 0)
 
 	for node := range g.nodes {
-		if _, ok := g.dependencies[node]; !ok {
+		if len(g.dependencies[g.index[node]]) == 0 {
 			leaves = append(leaves, node)
 		}
 	}
@@ -125,70 +239,106 @@ func (g *Graph) Leaves() []string {
 
 // TopoSortedLayers returns a slice of all of the graph nodes in topological sort order. That is,
 // if `B` depends on `A`, then `A` is guaranteed to come before `B` in the sorted output.
-// The graph is guaranteed to be cycle-free because cycles are detected while building the
-// graph. Additionally, the output is grouped into "layers", which are guaranteed to not have
+// Additionally, the output is grouped into "layers", which are guaranteed to not have
 // any dependencies within each layer. This is useful, e.g. when building an execution plan for
 // some DAG, in which case each element within each layer could be executed in parallel. If you
 // do not need this layered property, use `Graph.TopoSorted()`, which flattens all elements.
-func (g *Graph) TopoSortedLayers() [][]string {
+// Each layer is sorted.
+//
+// Nodes on a cycle, and nodes depending on one, cannot be sorted. They are left out of the
+// layers and reported by a *CycleError, while the layers of the remaining nodes are still
+// returned. Use Condense() first to sort every node, with each cycle as a single Component.
+func (g *Graph) TopoSortedLayers() ([][]string, error) {
 	layers := [][]string{}
 
-	// Copy the graph
-	shrinkingGraph := g.clone()
-	for {
-		leaves := shrinkingGraph.Leaves()
-		if len(leaves) == 0 {
-			break
+	// Kahn's algorithm: a vertex joins the next layer once all of its parents are placed
+	indegree := make([]int, len(g.ids))
+	var current []int
+	for i := range g.ids {
+		if !g.live(i) {
+			continue
 		}
-
-		layers = append(layers, leaves)
-		for _, leafNode := range leaves {
-			shrinkingGraph.Remove(leafNode)
+		indegree[i] = len(g.dependencies[i])
+		if indegree[i] == 0 {
+			current = append(current, i)
 		}
 	}
 
-	// If there is a circular dependency among several nodes, it will not be processed for now, just recording.
-	if len(shrinkingGraph.nodes) > 0 {
-		log.Printf("[WARN] Graph contains cycles: %+v", shrinkingGraph.nodes)
+	for len(current) > 0 {
+		var next []int
+		layer := make([]string, 0, len(current))
+		for _, v := range current {
+			// endpoints of edges that were never added as nodes are not part of the output
+			if _, ok := g.nodes[g.ids[v]]; ok {
+				layer = append(layer, g.ids[v])
+			}
+			for c := range g.dependents[v] {
+				if indegree[c]--; indegree[c] == 0 {
+					next = append(next, c)
+				}
+			}
+		}
+		if len(layer) > 0 {
+			sort.Strings(layer)
+			layers = append(layers, layer)
+		}
+		current = next
 	}
 
-	return layers
-}
+	var left []string
+	for id, i := range g.index {
+		if _, ok := g.nodes[id]; ok && indegree[i] > 0 {
+			left = append(left, id)
+		}
+	}
+	if len(left) == 0 {
+		return layers, nil
+	}
 
-func removeFromDepmap(dm depmap, key, node string) {
-	nodes := dm[key]
-	if len(nodes) == 1 {
-		// The only element in the nodeset must be `node`, so we
-		// can delete the entry entirely.
-		delete(dm, key)
-	} else {
-		// Otherwise, remove the single node from the nodeset.
-		delete(nodes, node)
+	cycles := g.Cycles()
+	onCycle := make(map[string]bool)
+	for _, c := range cycles {
+		for _, id := range c {
+			onCycle[id] = true
+		}
+	}
+	blocked := []string{}
+	for _, id := range left {
+		if !onCycle[id] {
+			blocked = append(blocked, id)
+		}
 	}
+	sort.Strings(blocked)
+
+	return layers, &CycleError{Cycles: cycles, Blocked: blocked}
 }
 
 func (g *Graph) Remove(node string) {
-	// Remove edges from things that depend on `node`.
-	for dependent := range g.dependents[node] {
-		removeFromDepmap(g.dependencies, dependent, node)
-	}
-	delete(g.dependents, node)
+	if i, ok := g.index[node]; ok {
+		// Remove edges from things that depend on `node`.
+		for dependent := range g.dependents[i] {
+			delete(g.dependencies[dependent], i)
+		}
+		g.dependents[i] = nil
+
+		// Remove all edges from node to the things it depends on.
+		for dependency := range g.dependencies[i] {
+			delete(g.dependents[dependency], i)
+		}
+		g.dependencies[i] = nil
 
-	// Remove all edges from node to the things it depends on.
-	for dependency := range g.dependencies[node] {
-		removeFromDepmap(g.dependents, dependency, node)
+		delete(g.index, node)
 	}
-	delete(g.dependencies, node)
 
 	// Finally, remove the node itself.
 	delete(g.nodes, node)
 }
 
 // TopoSorted returns all the nodes in the graph is topological sort order.
-// See also `Graph.TopoSortedLayers()`.
-func (g *Graph) TopoSorted() []string {
+// See also `Graph.TopoSortedLayers()`, including for the returned error.
+func (g *Graph) TopoSorted() ([]string, error) {
 	nodeCount := 0
-	layers := g.TopoSortedLayers()
+	layers, err := g.TopoSortedLayers()
 	for _, layer := range layers {
 		nodeCount += len(layer)
 	}
@@ -198,95 +348,101 @@ func (g *Graph) TopoSorted() []string {
 		allNodes = append(allNodes, layer...)
 	}
 
-	return allNodes
+	return allNodes, err
 }
 
 func (g *Graph) Dependencies(child string) map[string]struct{} {
-	return g.buildTransitive(child, g.immediateDependencies)
-}
-
-func (g *Graph) immediateDependencies(node string) map[string]struct{} {
-	return g.dependencies[node]
+	return g.buildTransitive(child, g.dependencies)
 }
 
 func (g *Graph) Dependents(parent string) map[string]struct{} {
-	return g.buildTransitive(parent, g.immediateDependents)
-}
-
-func (g *Graph) immediateDependents(node string) map[string]struct{} {
-	return g.dependents[node]
+	return g.buildTransitive(parent, g.dependents)
 }
 
-// buildTransitive starts at `root` and continues calling `nextFn` to keep discovering more nodes until
-// the graph cannot produce any more. It returns the set of all discovered nodes.
-func (g *Graph) buildTransitive(root string, nextFn func(string) map[string]struct{}) map[string]struct{} {
+// buildTransitive starts at `root` and keeps following `next` until the graph cannot produce
+// any more nodes. It returns the set of all discovered nodes.
+func (g *Graph) buildTransitive(root string, next []adjacency) map[string]struct{} {
 	if _, ok := g.nodes[root]; !ok {
 		return nil
 	}
 
 	out := make(map[string]struct{})
-	searchNext := []string{root}
-	for len(searchNext) > 0 {
-		// List of new nodes from this layer of the dependency graph. This is
-		// assigned to `searchNext` at the end of the outer "discovery" loop.
-		discovered := []string{}
-		for _, node := range searchNext {
-			// For each node to discover, find the next nodes.
-			for nextNode := range nextFn(node) {
-				// If we have not seen the node before, add it to the output as well
-				// as the list of nodes to traverse in the next iteration.
-				if _, ok := out[nextNode]; !ok {
-					out[nextNode] = struct{}{}
-					discovered = append(discovered, nextNode)
-				}
-			}
-		}
-		searchNext = discovered
-	}
-
+	g.walk(g.index[root], next, func(v int) bool {
+		out[g.ids[v]] = struct{}{}
+		return true
+	})
 	return out
 }
 
-func (g *Graph) clone() *Graph {
-	return &Graph{
-		dependencies: copyDepmap(g.dependencies),
-		dependents:   copyDepmap(g.dependents),
-		nodes:        copyNodeset(g.nodes),
-		namespace:    g.namespace,
+// reaches reports whether `target` can be reached from `root` along `next`.
+func (g *Graph) reaches(root, target string, next []adjacency) bool {
+	if _, ok := g.nodes[root]; !ok {
+		return false
+	}
+	t, ok := g.index[target]
+	if !ok {
+		return false
 	}
-}
-
-func copyNodeset(s nodeset) nodeset {
-	dst, _ := copystructure.Copy(s)
-	return dst.(nodeset)
-}
 
-func copyDepmap(m depmap) depmap {
-	dst, _ := copystructure.Copy(m)
-	return dst.(depmap)
+	found := false
+	g.walk(g.index[root], next, func(v int) bool {
+		found = v == t
+		return !found
+	})
+	return found
 }
 
-// Simplify the graph, remove the temporary nodes, but keep the original graph
-// Traverse all nodes, if the node is a temporary node, connect the upstream node and downstream node
-// of the node, and then delete the node and its connection
-func (g *Graph) ShrinkGraph() *Graph {
-	shrinkingGraph := g.clone()
-
-	for _, v := range shrinkingGraph.nodes {
-		if v.IsTemp() {
-			// At First, add new edges
-			for pid := range shrinkingGraph.dependencies[v.GetID()] {
-				for cid := range shrinkingGraph.dependents[v.GetID()] {
-					shrinkingGraph.DependOn(shrinkingGraph.nodes[cid], shrinkingGraph.nodes[pid])
-				}
+// walk visits every vertex reachable from `root` along `next` breadth first, excluding `root`
+// itself unless it is on a cycle, until `visit` returns false.
+func (g *Graph) walk(root int, next []adjacency, visit func(v int) bool) {
+	seen := make(map[int]struct{})
+	queue := []int{root}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for n := range next[v] {
+			if _, ok := seen[n]; ok {
+				continue
 			}
-			// Then remove the relevant information of the node
-			// But if the outdegree of the node is 0, it cannot be deleted
-			if len(shrinkingGraph.dependents[v.GetID()]) > 0 {
-				shrinkingGraph.Remove(v.GetID())
+			seen[n] = struct{}{}
+			if !visit(n) {
+				return
 			}
+			queue = append(queue, n)
 		}
 	}
+}
 
-	return shrinkingGraph
+// clone copies the structure of the graph. Nodes are shared, edges are copied.
+func (g *Graph) clone() *Graph {
+	c := &Graph{
+		nodes:        make(nodeset, len(g.nodes)),
+		index:        make(map[string]int, len(g.index)),
+		ids:          append([]string(nil), g.ids...),
+		dependencies: make([]adjacency, len(g.ids)),
+		dependents:   make([]adjacency, len(g.ids)),
+		namespace:    g.namespace,
+	}
+	for id, n := range g.nodes {
+		c.nodes[id] = n
+	}
+	for id, i := range g.index {
+		c.index[id] = i
+	}
+	for p, children := range g.dependents {
+		for ch, e := range children {
+			c.link(p, ch, e.clone())
+		}
+	}
+	return c
+}
+
+// sortedNeighbours returns the interned IDs in `adj` ordered by their string ID.
+func (g *Graph) sortedNeighbours(adj adjacency) []int {
+	out := make([]int, 0, len(adj))
+	for n := range adj {
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool { return g.ids[out[i]] < g.ids[out[j]] })
+	return out
 }
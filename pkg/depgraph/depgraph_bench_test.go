@@ -0,0 +1,112 @@
+package depgraph
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// Benchmarks run on layered random DAGs of increasing size:
+//
+//	go test -run '^$' -bench . -benchmem ./pkg/depgraph/
+//
+// The 100000 node graphs are skipped with -short.
+
+const (
+	benchLayers  = 50 // layers of the DAG
+	benchFanIn   = 3  // parents of each node, taken from the previous layer
+	benchTempPct = 10 // percentage of temporary nodes
+)
+
+var benchSizes = []int{1000, 10000, 100000}
+
+// benchGraph uses a fixed seed per size, so every run builds the same graph.
+func benchGraph(n int) (nodes []*testNode, deps [][2]int) {
+	r := rand.New(rand.NewSource(int64(n)))
+	width := max(1, n/benchLayers)
+	for i := 0; i < n; i++ {
+		nodes = append(nodes, &testNode{id: fmt.Sprintf("s%d.t%d", i%7, i), temp: r.Intn(100) < benchTempPct})
+		if i < width {
+			continue
+		}
+		base := (i/width - 1) * width
+		for j := 0; j < benchFanIn; j++ {
+			deps = append(deps, [2]int{i, base + r.Intn(width)})
+		}
+	}
+	return nodes, deps
+}
+
+func buildBenchGraph(nodes []*testNode, deps [][2]int) *Graph {
+	g := New()
+	for _, n := range nodes {
+		g.AddNode(n)
+	}
+	for _, d := range deps {
+		g.DependOn(nodes[d[0]], nodes[d[1]])
+	}
+	return g
+}
+
+func runSizes(b *testing.B, fn func(b *testing.B, g *Graph, nodes []*testNode, deps [][2]int)) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			if n > 10000 && testing.Short() {
+				b.Skip("large graph skipped in short mode")
+			}
+			nodes, deps := benchGraph(n)
+			g := buildBenchGraph(nodes, deps)
+			b.ReportAllocs()
+			b.ResetTimer()
+			fn(b, g, nodes, deps)
+		})
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	runSizes(b, func(b *testing.B, _ *Graph, nodes []*testNode, deps [][2]int) {
+		for i := 0; i < b.N; i++ {
+			buildBenchGraph(nodes, deps)
+		}
+	})
+}
+
+func BenchmarkTopoSortedLayers(b *testing.B) {
+	runSizes(b, func(b *testing.B, g *Graph, _ []*testNode, _ [][2]int) {
+		for i := 0; i < b.N; i++ {
+			g.TopoSortedLayers()
+		}
+	})
+}
+
+func BenchmarkShrinkGraph(b *testing.B) {
+	runSizes(b, func(b *testing.B, g *Graph, _ []*testNode, _ [][2]int) {
+		for i := 0; i < b.N; i++ {
+			g.ShrinkGraph()
+		}
+	})
+}
+
+func BenchmarkMerge(b *testing.B) {
+	runSizes(b, func(b *testing.B, g *Graph, _ []*testNode, _ [][2]int) {
+		for i := 0; i < b.N; i++ {
+			New().Merge(g)
+		}
+	})
+}
+
+func BenchmarkCycles(b *testing.B) {
+	runSizes(b, func(b *testing.B, g *Graph, _ []*testNode, _ [][2]int) {
+		for i := 0; i < b.N; i++ {
+			g.Cycles()
+		}
+	})
+}
+
+func BenchmarkDependents(b *testing.B) {
+	runSizes(b, func(b *testing.B, g *Graph, nodes []*testNode, _ [][2]int) {
+		for i := 0; i < b.N; i++ {
+			g.Dependents(nodes[0].id)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package depgraph
+
+import (
+	"maps"
+	"slices"
+)
+
+// EdgeKind describes how a child depends on its parent.
+type EdgeKind string
+
+const (
+	EdgeData     EdgeKind = "data"     // rows of the parent flow into the child
+	EdgeFilter   EdgeKind = "filter"   // the parent only restricts which rows reach the child, e.g. WHERE / JOIN conditions
+	EdgeCalls    EdgeKind = "calls"    // the parent invokes the child, e.g. a function calling another function
+	EdgeContains EdgeKind = "contains" // the parent groups the child, e.g. a dashboard and its panels
+	EdgeRefresh  EdgeKind = "refresh"  // the child is rebuilt from the parent, e.g. REFRESH MATERIALIZED VIEW
+)
+
+// Provenance records where an edge was observed.
+type Provenance struct {
+	Source    string `json:"source,omitempty"`    // function, file or query the edge was parsed from
+	Statement string `json:"statement,omitempty"` // the SQL statement that produced the edge
+}
+
+// Edge attributes that Edge.merge accumulates instead of keeping the first value.
+const (
+	AttrCalls    = "calls"     // how many times the statement producing the edge ran
+	AttrMeanTime = "mean_time" // mean execution time of that statement, in milliseconds
+)
+
+// Edge is the value of a parent -> child relationship. There is at most one edge per pair of nodes,
+// edges added again for the same pair are merged into it, see Edge.merge.
+type Edge struct {
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Kind       EdgeKind       `json:"kind"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Provenance []Provenance   `json:"provenance,omitempty"`
+}
+
+// merge folds `other` into the edge, e.g. the same dependency produced by another statement.
+// AttrCalls present on both sides are summed and AttrMeanTime is averaged weighted by those calls,
+// the way the lineage writers accumulate repeated function edges. Other attributes present on both
+// sides keep the existing value.
+func (e *Edge) merge(other *Edge) {
+	if calls, ok := e.Attributes[AttrCalls]; ok {
+		if otherCalls, ok := other.Attributes[AttrCalls]; ok {
+			n, m := number(calls), number(otherCalls)
+			mean, hasMean := e.Attributes[AttrMeanTime]
+			otherMean, otherHasMean := other.Attributes[AttrMeanTime]
+			if hasMean && otherHasMean && n+m > 0 {
+				e.Attributes[AttrMeanTime] = (number(mean)*n + number(otherMean)*m) / (n + m)
+			}
+			e.Attributes[AttrCalls] = addNumbers(calls, otherCalls)
+		}
+	}
+	e.fold(other)
+}
+
+// fold merges the kind, attributes and provenance of `other` into the edge. Attributes present on
+// both sides keep the existing value, provenance records are appended without duplicates. A data
+// edge is the strongest dependency, so it replaces any other kind; otherwise the kind seen first is
+// kept.
+func (e *Edge) fold(other *Edge) {
+	if other.Kind != "" && (e.Kind == "" || other.Kind == EdgeData) {
+		e.Kind = other.Kind
+	}
+
+	for k, v := range other.Attributes {
+		if _, ok := e.Attributes[k]; ok {
+			continue
+		}
+		if e.Attributes == nil {
+			e.Attributes = make(map[string]any, len(other.Attributes))
+		}
+		e.Attributes[k] = v
+	}
+
+	for _, p := range other.Provenance {
+		if !slices.Contains(e.Provenance, p) {
+			e.Provenance = append(e.Provenance, p)
+		}
+	}
+}
+
+// addNumbers sums two numeric attribute values, keeping the integer type when both sides share it.
+func addNumbers(a, b any) any {
+	switch x := a.(type) {
+	case int:
+		if y, ok := b.(int); ok {
+			return x + y
+		}
+	case int64:
+		if y, ok := b.(int64); ok {
+			return x + y
+		}
+	}
+	return number(a) + number(b)
+}
+
+func (e *Edge) clone() *Edge {
+	c := *e
+	c.Attributes = maps.Clone(e.Attributes)
+	c.Provenance = slices.Clone(e.Provenance)
+	return &c
+}
+
+// chain builds the edge parent -> child that replaces parent -> via -> child. The result is a
+// data edge only if both hops are, otherwise it takes the kind of the weaker hop. Both hops carry the
+// same rows, so their calls are not summed: attributes of `in` win over those of `out`.
+func chain(in, out *Edge) Edge {
+	kind := in.Kind
+	if kind == EdgeData {
+		kind = out.Kind
+	}
+
+	var e Edge
+	e.fold(in)
+	e.fold(out)
+	e.Kind = kind
+	return e
+}
@@ -0,0 +1,41 @@
+package depgraph
+
+import "testing"
+
+func TestMergeEdgeAccumulatesCalls(t *testing.T) {
+	g := New()
+	a, b := &testNode{id: "a"}, &testNode{id: "b"}
+	g.MergeEdge(a, b, Edge{Kind: EdgeData, Attributes: map[string]any{AttrCalls: int64(1), AttrMeanTime: 10.0, "procname": "f"}})
+	g.MergeEdge(a, b, Edge{Kind: EdgeData, Attributes: map[string]any{AttrCalls: int64(3), AttrMeanTime: 2.0, "procname": "g"}})
+
+	e := g.Edge("a", "b")
+	if got := e.Attributes[AttrCalls]; got != int64(4) {
+		t.Errorf("calls = %v, want 4", got)
+	}
+	if got := e.Attributes[AttrMeanTime]; got != 4.0 {
+		t.Errorf("mean_time = %v, want 4", got)
+	}
+	if got := e.Attributes["procname"]; got != "f" {
+		t.Errorf("procname = %v, want the first value", got)
+	}
+}
+
+func TestChainKeepsCalls(t *testing.T) {
+	e := chain(
+		&Edge{Kind: EdgeData, Attributes: map[string]any{AttrCalls: 2}},
+		&Edge{Kind: EdgeData, Attributes: map[string]any{AttrCalls: 5}},
+	)
+	if got := e.Attributes[AttrCalls]; got != 2 {
+		t.Errorf("calls = %v, want 2", got)
+	}
+}
+
+type testNode struct {
+	id   string
+	temp bool
+}
+
+func (n *testNode) GetID() string                 { return n.id }
+func (n *testNode) IsTemp() bool                  { return n.temp }
+func (n *testNode) GetKind() NodeKind             { return KindTable }
+func (n *testNode) GetAttributes() map[string]any { return nil }
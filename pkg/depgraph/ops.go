@@ -0,0 +1,169 @@
+package depgraph
+
+import "sort"
+
+// Direction of a traversal along the edges of the graph.
+type Direction int
+
+const (
+	Upstream   Direction = iota // towards parents
+	Downstream                  // towards children
+	Both                        // upstream and downstream
+)
+
+// NodeIDs returns the IDs of all nodes in sorted order.
+func (g *Graph) NodeIDs() []string {
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Merge adds the nodes and edges of `other` to the graph. Nodes already present are kept,
+// edges present in both graphs are merged, see Edge.merge. Edges are merged in the order of
+// `other.Edges()`, so the resulting provenance lists do not depend on map iteration.
+func (g *Graph) Merge(other *Graph) *Graph {
+	for id, n := range other.nodes {
+		if _, ok := g.nodes[id]; !ok {
+			g.AddNode(n)
+		}
+	}
+	for _, e := range other.Edges() {
+		g.mergeEdge(e.From, e.To, e)
+	}
+
+	return g
+}
+
+// GraphDiff lists what changed from one graph to another. Nodes are compared by ID and edges
+// by their endpoints; all lists are sorted.
+type GraphDiff struct {
+	AddedNodes   []string `json:"added_nodes"`
+	RemovedNodes []string `json:"removed_nodes"`
+	AddedEdges   []*Edge  `json:"added_edges"`
+	RemovedEdges []*Edge  `json:"removed_edges"`
+}
+
+// Empty reports whether both graphs have the same nodes and edges.
+func (d *GraphDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0
+}
+
+// Diff returns the changes that turn `a` into `b`: added entries exist only in `b`, removed
+// entries only in `a`. The returned edges are owned by the respective graph.
+func Diff(a, b *Graph) *GraphDiff {
+	d := &GraphDiff{
+		AddedNodes:   []string{},
+		RemovedNodes: []string{},
+		AddedEdges:   []*Edge{},
+		RemovedEdges: []*Edge{},
+	}
+
+	for _, id := range b.NodeIDs() {
+		if _, ok := a.nodes[id]; !ok {
+			d.AddedNodes = append(d.AddedNodes, id)
+		}
+	}
+	for _, id := range a.NodeIDs() {
+		if _, ok := b.nodes[id]; !ok {
+			d.RemovedNodes = append(d.RemovedNodes, id)
+		}
+	}
+	for _, e := range b.Edges() {
+		if a.Edge(e.From, e.To) == nil {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for _, e := range a.Edges() {
+		if b.Edge(e.From, e.To) == nil {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+
+	return d
+}
+
+// Subgraph returns the nodes reachable from `roots` within `depth` steps in the given direction,
+// together with all edges among them. Both is the union of the upstream and downstream parts, it
+// does not turn around, so siblings of the roots are not included. A depth <= 0 means no limit.
+// Roots not in the graph are ignored. Nodes are shared with the original graph, edges are copied.
+func (g *Graph) Subgraph(roots []string, direction Direction, depth int) *Graph {
+	seen := make(map[int]struct{})
+	if direction == Upstream || direction == Both {
+		g.reach(roots, g.dependencies, depth, seen)
+	}
+	if direction == Downstream || direction == Both {
+		g.reach(roots, g.dependents, depth, seen)
+	}
+
+	return g.induced(func(id string) bool {
+		_, ok := seen[g.index[id]]
+		return ok
+	})
+}
+
+// reach adds the nodes within `depth` steps of `roots` along `next` to `seen`.
+func (g *Graph) reach(roots []string, next []adjacency, depth int, seen map[int]struct{}) {
+	visited := make(map[int]struct{})
+	var frontier []int
+	for _, id := range roots {
+		if _, ok := g.nodes[id]; !ok {
+			continue
+		}
+		i := g.index[id]
+		if _, ok := visited[i]; !ok {
+			visited[i] = struct{}{}
+			frontier = append(frontier, i)
+		}
+	}
+
+	for level := 0; len(frontier) > 0 && (depth <= 0 || level < depth); level++ {
+		var discovered []int
+		for _, v := range frontier {
+			for n := range next[v] {
+				if _, ok := visited[n]; !ok {
+					visited[n] = struct{}{}
+					discovered = append(discovered, n)
+				}
+			}
+		}
+		frontier = discovered
+	}
+
+	for v := range visited {
+		seen[v] = struct{}{}
+	}
+}
+
+// Filter returns the nodes for which `keep` returns true and the edges among them. Unlike
+// ShrinkGraph, no edges are added to bridge the nodes that were dropped.
+func (g *Graph) Filter(keep func(Node) bool) *Graph {
+	return g.induced(func(id string) bool {
+		return keep(g.nodes[id])
+	})
+}
+
+// induced builds the subgraph of the nodes accepted by `in`.
+func (g *Graph) induced(in func(id string) bool) *Graph {
+	sub := New()
+	sub.namespace = g.namespace
+
+	var kept []int
+	for id, n := range g.nodes {
+		if in(id) {
+			sub.AddNode(n)
+			kept = append(kept, g.index[id])
+		}
+	}
+	for _, p := range kept {
+		for c, e := range g.dependents[p] {
+			if _, ok := sub.nodes[g.ids[c]]; ok {
+				sub.link(sub.index[g.ids[p]], sub.index[g.ids[c]], e.clone())
+			}
+		}
+	}
+
+	return sub
+}
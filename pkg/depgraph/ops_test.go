@@ -0,0 +1,128 @@
+package depgraph
+
+import (
+	"strings"
+	"testing"
+)
+
+// testGraph builds a graph from parent -> child pairs, every edge with the given attributes.
+func testGraph(attrs map[string]any, edges ...[2]string) *Graph {
+	g := New()
+	for _, e := range edges {
+		parent, child := &testNode{id: e[0]}, &testNode{id: e[1]}
+		g.AddNode(parent).AddNode(child).MergeEdge(parent, child, Edge{Kind: EdgeData, Attributes: attrs})
+	}
+	return g
+}
+
+func edgeIDs(edges []*Edge) string {
+	ids := make([]string, 0, len(edges))
+	for _, e := range edges {
+		ids = append(ids, e.From+">"+e.To)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestDiff(t *testing.T) {
+	base := [][2]string{{"a", "b"}, {"b", "c"}}
+	for _, tc := range []struct {
+		name                     string
+		b                        *Graph
+		added, removed           string
+		addedEdges, removedEdges string
+	}{
+		{
+			name: "same",
+			b:    testGraph(map[string]any{AttrCalls: int64(1)}, base...),
+		},
+		{
+			// edges are compared by their endpoints, changed counts are not a lineage change
+			name: "attributes changed",
+			b:    testGraph(map[string]any{AttrCalls: int64(7), "procname": "g"}, base...),
+		},
+		{
+			name:         "edge moved",
+			b:            testGraph(nil, [2]string{"a", "b"}, [2]string{"a", "c"}),
+			addedEdges:   "a>c",
+			removedEdges: "b>c",
+		},
+		{
+			name:         "nodes added and removed",
+			b:            testGraph(nil, [2]string{"a", "b"}, [2]string{"d", "a"}, [2]string{"e", "a"}),
+			added:        "d,e",
+			removed:      "c",
+			addedEdges:   "d>a,e>a",
+			removedEdges: "b>c",
+		},
+	} {
+		d := Diff(testGraph(map[string]any{AttrCalls: int64(1)}, base...), tc.b)
+		if got := strings.Join(d.AddedNodes, ","); got != tc.added {
+			t.Errorf("%s: added nodes = %s, want %s", tc.name, got, tc.added)
+		}
+		if got := strings.Join(d.RemovedNodes, ","); got != tc.removed {
+			t.Errorf("%s: removed nodes = %s, want %s", tc.name, got, tc.removed)
+		}
+		if got := edgeIDs(d.AddedEdges); got != tc.addedEdges {
+			t.Errorf("%s: added edges = %s, want %s", tc.name, got, tc.addedEdges)
+		}
+		if got := edgeIDs(d.RemovedEdges); got != tc.removedEdges {
+			t.Errorf("%s: removed edges = %s, want %s", tc.name, got, tc.removedEdges)
+		}
+		if empty := tc.added+tc.removed+tc.addedEdges+tc.removedEdges == ""; d.Empty() != empty {
+			t.Errorf("%s: Empty() = %v, want %v", tc.name, d.Empty(), empty)
+		}
+	}
+}
+
+func TestSubgraph(t *testing.T) {
+	// a -> b -> c -> d, x -> c -> e, y -> b
+	g := testGraph(nil, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "d"},
+		[2]string{"x", "c"}, [2]string{"c", "e"}, [2]string{"y", "b"})
+
+	for _, tc := range []struct {
+		roots     []string
+		direction Direction
+		depth     int
+		nodes     string
+		edges     string
+	}{
+		{[]string{"c"}, Upstream, 1, "b,c,x", "b>c,x>c"},
+		{[]string{"c"}, Upstream, 2, "a,b,c,x,y", "a>b,b>c,x>c,y>b"},
+		{[]string{"c"}, Upstream, 0, "a,b,c,x,y", "a>b,b>c,x>c,y>b"},
+		{[]string{"c"}, Downstream, 1, "c,d,e", "c>d,c>e"},
+		{[]string{"b"}, Both, 1, "a,b,c,y", "a>b,b>c,y>b"},
+		{[]string{"a", "x"}, Downstream, 1, "a,b,c,x", "a>b,b>c,x>c"},
+		{[]string{"missing"}, Both, 0, "", ""},
+	} {
+		sub := g.Subgraph(tc.roots, tc.direction, tc.depth)
+		if got := strings.Join(sub.NodeIDs(), ","); got != tc.nodes {
+			t.Errorf("%v %d depth %d: nodes = %s, want %s", tc.roots, tc.direction, tc.depth, got, tc.nodes)
+		}
+		if got := edgeIDs(sub.Edges()); got != tc.edges {
+			t.Errorf("%v %d depth %d: edges = %s, want %s", tc.roots, tc.direction, tc.depth, got, tc.edges)
+		}
+	}
+}
+
+func TestFilterAndMerge(t *testing.T) {
+	g := testGraph(map[string]any{AttrCalls: int64(1)}, [2]string{"a", "tmp"}, [2]string{"tmp", "b"}, [2]string{"a", "b"})
+
+	// dropped nodes are not bridged
+	f := g.Filter(func(n Node) bool { return n.GetID() != "tmp" })
+	if got := edgeIDs(f.Edges()); got != "a>b" {
+		t.Errorf("Filter: edges = %s, want a>b", got)
+	}
+
+	m := testGraph(map[string]any{AttrCalls: int64(2)}, [2]string{"a", "b"}, [2]string{"b", "c"})
+	f.Merge(m)
+	if got := strings.Join(f.NodeIDs(), ","); got != "a,b,c" {
+		t.Errorf("Merge: nodes = %s, want a,b,c", got)
+	}
+	if got := f.Edge("a", "b").Attributes[AttrCalls]; got != int64(3) {
+		t.Errorf("Merge: a -> b calls = %v, want 3", got)
+	}
+	// the filtered graph has its own copy of the edge
+	if got := g.Edge("a", "b").Attributes[AttrCalls]; got != int64(1) {
+		t.Errorf("Merge changed the original graph: calls = %v", got)
+	}
+}
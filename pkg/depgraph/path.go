@@ -0,0 +1,253 @@
+package depgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ShortestPath returns a path with the fewest edges from `from` down to `to`, following edges
+// from parent to child, or nil if there is none within `maxLen` edges. A maxLen <= 0 means no
+// limit. Neighbours are visited in sorted order, so among several shortest paths the result is
+// always the same one.
+func (g *Graph) ShortestPath(from, to string, maxLen int) []string {
+	s, ok := g.index[from]
+	if !ok {
+		return nil
+	}
+	t, ok := g.index[to]
+	if !ok {
+		return nil
+	}
+	if s == t {
+		return []string{from}
+	}
+
+	prev := map[int]int{s: s}
+	frontier := []int{s}
+	for length := 1; len(frontier) > 0 && (maxLen <= 0 || length <= maxLen); length++ {
+		var next []int
+		for _, v := range frontier {
+			for _, c := range g.sortedNeighbours(g.dependents[v]) {
+				if _, ok := prev[c]; ok {
+					continue
+				}
+				prev[c] = v
+				if c == t {
+					return g.pathTo(prev, t)
+				}
+				next = append(next, c)
+			}
+		}
+		frontier = next
+	}
+	return nil
+}
+
+func (g *Graph) pathTo(prev map[int]int, t int) []string {
+	path := []string{g.ids[t]}
+	for v := t; prev[v] != v; v = prev[v] {
+		path = append(path, g.ids[prev[v]])
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// AllPaths returns every path from `from` down to `to` with at most `maxLen` edges that does not
+// visit a node twice, shortest first and then in lexical order. A maxLen <= 0 means no limit; the
+// number of paths can grow exponentially with the length, so a limit is advised on large graphs.
+func (g *Graph) AllPaths(from, to string, maxLen int) [][]string {
+	s, ok := g.index[from]
+	if !ok {
+		return nil
+	}
+	t, ok := g.index[to]
+	if !ok {
+		return nil
+	}
+	if s == t {
+		return [][]string{{from}}
+	}
+
+	// only vertices that can still reach `to` are worth entering
+	useful := map[int]struct{}{t: {}}
+	g.walk(t, g.dependencies, func(v int) bool {
+		useful[v] = struct{}{}
+		return true
+	})
+	if _, ok := useful[s]; !ok {
+		return nil
+	}
+
+	var (
+		paths  [][]string
+		path   = []int{s}
+		onPath = map[int]bool{s: true}
+		visit  func(v int)
+	)
+	visit = func(v int) {
+		if maxLen > 0 && len(path) > maxLen {
+			return
+		}
+		for _, c := range g.sortedNeighbours(g.dependents[v]) {
+			if _, ok := useful[c]; !ok || onPath[c] {
+				continue
+			}
+			path = append(path, c)
+			if c == t {
+				ids := make([]string, len(path))
+				for i, p := range path {
+					ids[i] = g.ids[p]
+				}
+				paths = append(paths, ids)
+			} else {
+				onPath[c] = true
+				visit(c)
+				onPath[c] = false
+			}
+			path = path[:len(path)-1]
+		}
+	}
+	visit(s)
+
+	sort.SliceStable(paths, func(i, j int) bool { return len(paths[i]) < len(paths[j]) })
+	return paths
+}
+
+// Weight returns the cost of an edge, e.g. the time the statement producing the child takes.
+type Weight func(*Edge) float64
+
+// AttrWeight uses the numeric attribute `key` of the edge as its weight, 0 when it is missing.
+func AttrWeight(key string) Weight {
+	return func(e *Edge) float64 {
+		return number(e.Attributes[key])
+	}
+}
+
+// number converts a numeric attribute value to float64, 0 for anything else.
+func number(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return 0
+}
+
+// WeightedPath is a path together with the total weight of its edges.
+type WeightedPath struct {
+	Nodes  []string `json:"nodes"`
+	Weight float64  `json:"weight"`
+}
+
+// CriticalPath returns the heaviest path of the graph ending at `to`, or the heaviest path of the
+// whole graph if `to` is empty: the chain of edges that decides when `to` can be ready if every
+// edge takes its weight and a child starts once all of its parents are done. A nil weight counts
+// each edge as 1, giving the longest chain. Paths of equal weight are resolved by node ID. The
+// graph must be acyclic, otherwise a *CycleError is returned; see Condense.
+func (g *Graph) CriticalPath(to string, weight Weight) (*WeightedPath, error) {
+	if weight == nil {
+		weight = func(*Edge) float64 { return 1 }
+	}
+	t, ok := g.index[to]
+	if to != "" && !ok {
+		return nil, fmt.Errorf("node %q not in graph", to)
+	}
+
+	order, err := g.topoOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	// dist is the weight of the heaviest path ending at a vertex, prev the parent on that path
+	dist := make([]float64, len(g.ids))
+	prev := make(map[int]int, len(order))
+	for _, v := range order {
+		prev[v] = v
+		for _, p := range g.sortedNeighbours(g.dependencies[v]) {
+			if d := dist[p] + weight(g.dependencies[v][p]); prev[v] == v || d > dist[v] {
+				dist[v], prev[v] = d, p
+			}
+		}
+	}
+
+	if to == "" {
+		t = -1
+		for _, v := range order {
+			if t < 0 || dist[v] > dist[t] || dist[v] == dist[t] && g.ids[v] < g.ids[t] {
+				t = v
+			}
+		}
+		if t < 0 {
+			return &WeightedPath{Nodes: []string{}}, nil
+		}
+	}
+	return &WeightedPath{Nodes: g.pathTo(prev, t), Weight: dist[t]}, nil
+}
+
+// topoOrder returns every vertex, including the endpoints of edges that were never added as
+// nodes, in topological order, or a *CycleError.
+func (g *Graph) topoOrder() ([]int, error) {
+	indegree := make([]int, len(g.ids))
+	var order []int
+	for _, i := range g.index {
+		indegree[i] = len(g.dependencies[i])
+		if indegree[i] == 0 {
+			order = append(order, i)
+		}
+	}
+	for k := 0; k < len(order); k++ {
+		for c := range g.dependents[order[k]] {
+			if indegree[c]--; indegree[c] == 0 {
+				order = append(order, c)
+			}
+		}
+	}
+	if len(order) == len(g.index) {
+		return order, nil
+	}
+
+	_, err := g.TopoSortedLayers()
+	if err == nil {
+		// the cycles are among edge endpoints only, which TopoSortedLayers leaves out
+		err = &CycleError{Cycles: g.Cycles(), Blocked: []string{}}
+	}
+	return nil, err
+}
+
+// BlastRadius counts the nodes that transitively depend on `id`, grouped by `kind`, e.g. how many
+// tables, panels and dashboards are affected when it breaks. A nil kind groups by GetKind. Endpoints
+// of edges that were never added as nodes are counted under "". The result is empty if `id` is not
+// in the graph.
+func (g *Graph) BlastRadius(id string, kind func(Node) string) map[string]int {
+	if kind == nil {
+		kind = func(n Node) string { return string(n.GetKind()) }
+	}
+	out := make(map[string]int)
+	i, ok := g.index[id]
+	if !ok {
+		return out
+	}
+
+	g.walk(i, g.dependents, func(v int) bool {
+		if v == i {
+			return true
+		}
+		k := ""
+		if n, ok := g.nodes[g.ids[v]]; ok {
+			k = kind(n)
+		}
+		out[k]++
+		return true
+	})
+	return out
+}
@@ -0,0 +1,127 @@
+package depgraph
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// weightedGraph a -> b -> d, a -> c -> d, a -> d, d -> e; mean_time is heaviest through c
+func weightedGraph() *Graph {
+	g := New()
+	for _, e := range []struct {
+		from, to string
+		meanTime float64
+	}{
+		{"a", "b", 1}, {"b", "d", 1}, {"a", "c", 5}, {"c", "d", 1}, {"a", "d", 1}, {"d", "e", 2},
+	} {
+		parent, child := &testNode{id: e.from}, &testNode{id: e.to}
+		g.AddNode(parent).AddNode(child).MergeEdge(parent, child, Edge{Kind: EdgeData, Attributes: map[string]any{AttrMeanTime: e.meanTime}})
+	}
+	return g
+}
+
+func TestShortestPath(t *testing.T) {
+	g := weightedGraph()
+	for _, tc := range []struct {
+		from, to string
+		maxLen   int
+		want     string
+	}{
+		{"a", "e", 0, "[a d e]"},
+		{"a", "e", 2, "[a d e]"},
+		{"a", "e", 1, "[]"},
+		{"b", "e", 0, "[b d e]"},
+		{"e", "a", 0, "[]"},
+		{"a", "a", 0, "[a]"},
+		{"a", "missing", 0, "[]"},
+	} {
+		if got := fmt.Sprint(g.ShortestPath(tc.from, tc.to, tc.maxLen)); got != tc.want {
+			t.Errorf("%s -> %s max %d: path = %s, want %s", tc.from, tc.to, tc.maxLen, got, tc.want)
+		}
+	}
+}
+
+func TestAllPaths(t *testing.T) {
+	g := weightedGraph()
+	for _, tc := range []struct {
+		from, to string
+		maxLen   int
+		want     string
+	}{
+		{"a", "e", 0, "[[a d e] [a b d e] [a c d e]]"},
+		{"a", "e", 2, "[[a d e]]"},
+		{"a", "e", 1, "[]"},
+		{"c", "e", 0, "[[c d e]]"},
+		{"b", "c", 0, "[]"},
+	} {
+		if got := fmt.Sprint(g.AllPaths(tc.from, tc.to, tc.maxLen)); got != tc.want {
+			t.Errorf("%s -> %s max %d: paths = %s, want %s", tc.from, tc.to, tc.maxLen, got, tc.want)
+		}
+	}
+
+	// a path does not visit a node twice
+	cyclic := testGraph(nil, [2]string{"a", "b"}, [2]string{"b", "a"}, [2]string{"b", "c"})
+	if got := fmt.Sprint(cyclic.AllPaths("a", "c", 0)); got != "[[a b c]]" {
+		t.Errorf("cyclic: paths = %s", got)
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	g := weightedGraph()
+	for _, tc := range []struct {
+		name   string
+		to     string
+		weight Weight
+		want   string
+	}{
+		{"mean time", "e", AttrWeight(AttrMeanTime), "[a c d e] 8"},
+		{"mean time to d", "d", AttrWeight(AttrMeanTime), "[a c d] 6"},
+		{"whole graph", "", AttrWeight(AttrMeanTime), "[a c d e] 8"},
+		{"hops, ties by node ID", "e", nil, "[a b d e] 3"},
+		{"missing attribute", "e", AttrWeight("missing"), "[a d e] 0"},
+	} {
+		p, err := g.CriticalPath(tc.to, tc.weight)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := fmt.Sprint(p.Nodes, " ", p.Weight); got != tc.want {
+			t.Errorf("%s: path = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := g.CriticalPath("missing", nil); err == nil {
+		t.Error("missing node: no error")
+	}
+	var cycleErr *CycleError
+	if _, err := cyclicGraph().CriticalPath("", nil); !errors.As(err, &cycleErr) {
+		t.Errorf("cyclic graph: err = %v, want a *CycleError", err)
+	}
+}
+
+func TestBlastRadius(t *testing.T) {
+	g := weightedGraph()
+	byName := func(n Node) string {
+		if n.GetID() == "e" {
+			return "panel"
+		}
+		return "table"
+	}
+
+	for _, tc := range []struct {
+		id   string
+		kind func(Node) string
+		want string
+	}{
+		{"a", byName, "map[panel:1 table:3]"},
+		{"d", byName, "map[panel:1]"},
+		{"a", nil, "map[table:4]"},
+		{"e", nil, "map[]"},
+		{"missing", nil, "map[]"},
+	} {
+		if got := fmt.Sprint(g.BlastRadius(tc.id, tc.kind)); got != tc.want {
+			t.Errorf("%s: blast radius = %s, want %s", tc.id, got, tc.want)
+		}
+	}
+}
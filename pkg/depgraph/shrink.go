@@ -0,0 +1,181 @@
+package depgraph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// NodeClass tells what kind of relation a node is, ShrinkGraph removes nodes by class.
+type NodeClass string
+
+const (
+	ClassPersistent NodeClass = "persistent" // an ordinary table, view or function
+	ClassCTE        NodeClass = "cte"        // a WITH query, only visible inside its statement
+	ClassTemp       NodeClass = "temp"       // a temporary table
+	ClassUnlogged   NodeClass = "unlogged"   // an unlogged table, often used for staging
+	ClassUnresolved NodeClass = "unresolved" // a table whose schema could not be determined
+)
+
+// AttrVia is the edge attribute listing, in order, the nodes removed between the two ends of an
+// edge added by Shrink.
+const AttrVia = "via"
+
+// ParseNodeClass checks that `s` is one of the NodeClass values.
+func ParseNodeClass(s string) (NodeClass, error) {
+	switch c := NodeClass(s); c {
+	case ClassPersistent, ClassCTE, ClassTemp, ClassUnlogged, ClassUnresolved:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown node class %q", s)
+}
+
+// Classified is implemented by nodes that know their class.
+type Classified interface {
+	Class() NodeClass
+}
+
+// Classifier returns the class of a node.
+type Classifier func(Node) NodeClass
+
+// DefaultClassifier uses Class() if the node implements Classified, otherwise the node is
+// ClassTemp when IsTemp() is true and ClassPersistent when it is not.
+func DefaultClassifier(n Node) NodeClass {
+	if c, ok := n.(Classified); ok {
+		return c.Class()
+	}
+	if n.IsTemp() {
+		return ClassTemp
+	}
+	return ClassPersistent
+}
+
+// ShrinkOptions selects the nodes removed by Shrink.
+type ShrinkOptions struct {
+	Classify Classifier  // nil means DefaultClassifier
+	Remove   []NodeClass // nil means ClassCTE and ClassTemp
+}
+
+// ShrinkGraph removes the CTEs and temporary tables, see Shrink.
+func (g *Graph) ShrinkGraph() *Graph {
+	return g.Shrink(ShrinkOptions{})
+}
+
+// Shrink returns the graph without the nodes whose class is in `opts.Remove`. For every kept node
+// the removed nodes below it are walked through until kept nodes are reached, and an edge is added
+// to each of them: parent -> a -> b -> child becomes parent -> child when a and b are removed. The
+// new edge combines the hops, see chain, and its AttrVia attribute is the path of removed nodes,
+// the shortest one if there are several. When parent -> child is already an edge of the graph, the
+// path is merged into it without AttrVia, so AttrVia only appears on edges created by Shrink. A path that comes back to where it started is kept as a
+// self loop, so Cycles still reports it. Removed nodes are dropped together with their edges even
+// when nothing is reached through them. The original graph is not changed, nodes are shared.
+func (g *Graph) Shrink(opts ShrinkOptions) *Graph {
+	classify, remove := opts.Classify, opts.Remove
+	if classify == nil {
+		classify = DefaultClassifier
+	}
+	if remove == nil {
+		remove = []NodeClass{ClassCTE, ClassTemp}
+	}
+
+	removed := make([]bool, len(g.ids))
+	for id, n := range g.nodes {
+		if slices.Contains(remove, classify(n)) {
+			removed[g.index[id]] = true
+		}
+	}
+
+	shrunk := New()
+	shrunk.namespace = g.namespace
+
+	// edges may reference IDs that were never added as nodes, they are kept. `to` maps the
+	// interned IDs of the kept vertices to those in the new graph.
+	kept := make([]int, 0, len(g.index))
+	for _, i := range g.index {
+		if !removed[i] {
+			kept = append(kept, i)
+		}
+	}
+	sort.Slice(kept, func(a, b int) bool { return g.ids[kept[a]] < g.ids[kept[b]] })
+	to := make([]int, len(g.ids))
+	for _, i := range kept {
+		if n, ok := g.nodes[g.ids[i]]; ok {
+			shrunk.AddNode(n)
+		}
+		to[i] = shrunk.intern(g.ids[i])
+	}
+
+	for _, p := range kept {
+		g.bridge(shrunk, p, removed, to)
+	}
+
+	return shrunk
+}
+
+// hop is a removed node reached from the kept node being bridged, with the combined edge and
+// the path of removed nodes leading to it.
+type hop struct {
+	v    int
+	edge Edge
+	via  []string
+}
+
+// bridge adds to `shrunk` the edges from the kept node `p` to the kept nodes it reaches directly
+// or through removed nodes, breadth first so that the recorded path is the shortest.
+func (g *Graph) bridge(shrunk *Graph, p int, removed []bool, to []int) {
+	var starts []int
+	for c, e := range g.dependents[p] {
+		if removed[c] {
+			starts = append(starts, c)
+			continue
+		}
+		shrunk.mergeAt(to[p], to[c], e)
+	}
+	if len(starts) == 0 {
+		return
+	}
+
+	// the order of the walk decides the recorded path and the order of provenance records
+	sort.Slice(starts, func(i, j int) bool { return g.ids[starts[i]] < g.ids[starts[j]] })
+	visited := make(map[int]struct{})
+	var queue []hop
+	for _, c := range starts {
+		e := g.dependents[p][c]
+		visited[c] = struct{}{}
+		queue = append(queue, hop{v: c, edge: *e.clone(), via: append(via(e), g.ids[c])})
+	}
+
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		for _, c := range g.sortedNeighbours(g.dependents[h.v]) {
+			out := g.dependents[h.v][c]
+			e := chain(&h.edge, out)
+			path := append(slices.Clip(h.via), via(out)...)
+			if !removed[c] {
+				// a direct edge p -> c keeps its own provenance, the path only adds to its counts
+				if _, direct := g.dependents[p][c]; direct {
+					delete(e.Attributes, AttrVia)
+				} else {
+					if e.Attributes == nil {
+						e.Attributes = make(map[string]any, 1)
+					}
+					e.Attributes[AttrVia] = path
+				}
+				shrunk.mergeAt(to[p], to[c], &e)
+				continue
+			}
+			if _, ok := visited[c]; ok {
+				continue
+			}
+			visited[c] = struct{}{}
+			queue = append(queue, hop{v: c, edge: e, via: append(path, g.ids[c])})
+		}
+	}
+}
+
+// via returns the AttrVia path of an edge that was itself added by Shrink.
+func via(e *Edge) []string {
+	path, _ := e.Attributes[AttrVia].([]string)
+	return slices.Clone(path)
+}
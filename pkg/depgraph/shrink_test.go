@@ -0,0 +1,119 @@
+package depgraph
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShrink(t *testing.T) {
+	// nodes named cte* are CTEs, tmp* temporary tables, the rest are kept
+	classify := func(n Node) NodeClass {
+		switch {
+		case strings.HasPrefix(n.GetID(), "cte"):
+			return ClassCTE
+		case strings.HasPrefix(n.GetID(), "tmp"):
+			return ClassTemp
+		}
+		return ClassPersistent
+	}
+	calls := func(n int) Edge {
+		return Edge{Kind: EdgeData, Attributes: map[string]any{AttrCalls: int64(n)}}
+	}
+
+	type want struct {
+		from, to string
+		via      []string // nil: the edge has no AttrVia
+		calls    int64
+	}
+	for _, tc := range []struct {
+		name  string
+		edges [][2]string // parent, child, every edge with 1 call
+		extra [][2]string // parent, child, edges with 2 calls
+		nodes string
+		want  []want
+	}{
+		{
+			name:  "temp",
+			edges: [][2]string{{"a", "tmp"}, {"tmp", "b"}},
+			nodes: "a,b",
+			want:  []want{{"a", "b", []string{"tmp"}, 1}},
+		},
+		{
+			name:  "cte chain",
+			edges: [][2]string{{"a", "cte1"}, {"cte1", "cte2"}, {"cte2", "b"}, {"c", "cte2"}},
+			nodes: "a,b,c",
+			want:  []want{{"a", "b", []string{"cte1", "cte2"}, 1}, {"c", "b", []string{"cte2"}, 1}},
+		},
+		{
+			name:  "shortest path",
+			edges: [][2]string{{"a", "tmp1"}, {"tmp1", "tmp2"}, {"tmp2", "b"}, {"a", "tmp3"}, {"tmp3", "b"}},
+			nodes: "a,b",
+			want:  []want{{"a", "b", []string{"tmp3"}, 2}},
+		},
+		{
+			name:  "direct edge",
+			edges: [][2]string{{"a", "b"}},
+			extra: [][2]string{{"a", "tmp"}, {"tmp", "b"}},
+			nodes: "a,b",
+			want:  []want{{"a", "b", nil, 3}},
+		},
+		{
+			name:  "self loop",
+			edges: [][2]string{{"a", "tmp"}, {"tmp", "a"}},
+			nodes: "a",
+			want:  []want{{"a", "a", []string{"tmp"}, 1}},
+		},
+		{
+			name:  "dead end",
+			edges: [][2]string{{"a", "cte"}, {"tmp", "b"}},
+			nodes: "a,b",
+		},
+	} {
+		g := New()
+		for i, edges := range [][][2]string{tc.edges, tc.extra} {
+			for _, e := range edges {
+				parent, child := &testNode{id: e[0]}, &testNode{id: e[1]}
+				g.AddNode(parent).AddNode(child).MergeEdge(parent, child, calls(i+1))
+			}
+		}
+
+		shrunk := g.Shrink(ShrinkOptions{Classify: classify, Remove: []NodeClass{ClassCTE, ClassTemp}})
+		if got := strings.Join(shrunk.NodeIDs(), ","); got != tc.nodes {
+			t.Errorf("%s: nodes = %s, want %s", tc.name, got, tc.nodes)
+		}
+		if got := len(shrunk.Edges()); got != len(tc.want) {
+			t.Errorf("%s: %d edges, want %d", tc.name, got, len(tc.want))
+		}
+		for _, w := range tc.want {
+			e := shrunk.Edge(w.from, w.to)
+			if e == nil {
+				t.Errorf("%s: missing edge %s -> %s", tc.name, w.from, w.to)
+				continue
+			}
+			path, ok := e.Attributes[AttrVia].([]string)
+			if (w.via == nil) == ok || !slices.Equal(path, w.via) {
+				t.Errorf("%s: %s -> %s via = %v, want %v", tc.name, w.from, w.to, e.Attributes[AttrVia], w.via)
+			}
+			if got := e.Attributes[AttrCalls]; got != w.calls {
+				t.Errorf("%s: %s -> %s calls = %v, want %d", tc.name, w.from, w.to, got, w.calls)
+			}
+		}
+	}
+}
+
+func TestShrinkDefaultClassifier(t *testing.T) {
+	g := New()
+	a, tmp, b := &testNode{id: "a"}, &testNode{id: "tmp", temp: true}, &testNode{id: "b"}
+	g.DependOn(tmp, a)
+	g.DependOn(b, tmp)
+
+	shrunk := g.ShrinkGraph()
+	if e := shrunk.Edge("a", "b"); e == nil || !slices.Equal(e.Attributes[AttrVia].([]string), []string{"tmp"}) {
+		t.Errorf("a -> b = %+v, want via tmp", e)
+	}
+	// the original graph is not changed
+	if g.Edge("a", "tmp") == nil || g.Edge("a", "b") != nil {
+		t.Error("Shrink changed the original graph")
+	}
+}
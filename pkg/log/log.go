@@ -92,7 +92,11 @@ func NewLogger(cfg *config.LogConfig) (Logger, error) {
 		MaxAge:     30, // Max number of days to retain log files
 		Compress:   true,
 	}
-	logrusLogger.SetOutput(io.MultiWriter(os.Stdout, lumberjackLogrotate))
+	var console io.Writer = os.Stdout
+	if cfg.Stderr {
+		console = os.Stderr
+	}
+	logrusLogger.SetOutput(io.MultiWriter(console, lumberjackLogrotate))
 
 	// 设置日志级别
 	if cfg.Level == "" {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+
+	writer "pg_lineage/internal/lineage-writer"
+	C "pg_lineage/pkg/config"
+	"pg_lineage/pkg/log"
+)
+
+var reportOutput string
+
+func reportUnusedFlags(fs *flag.FlagSet) {
+	fs.StringVar(&reportOutput, "o", "tables_not_inuse.csv", "output csv file, - for stdout")
+}
+
+// reportUnused 从 Neo4j 中找出没有任何血缘关系、没有被查询调用、也没有扫描记录的表，导出为 CSV；
+// 指定 -label 时只导出对应数据源的表
+func reportUnused(a *app, args []string) error {
+	conf, err := neo4jConfig(&a.config.Storage)
+	if err != nil {
+		return err
+	}
+
+	driver, err := writer.InitNeo4jDriver(conf)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	defer driver.Close(ctx)
+
+	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead, DatabaseName: conf.Database})
+	defer session.Close(ctx)
+
+	// nil 在 Cypher 中为 null，size(null) 不等于 0
+	labels := append([]string{}, a.labels...)
+	result, err := session.Run(ctx, `
+		MATCH (n:lineage)
+		WHERE NOT (n)--() AND n.calls IS NULL AND coalesce(n.seq_scan, 0) = 0 AND coalesce(n.idx_scan, 0) = 0
+			AND (size($labels) = 0 OR n.database IN $labels)
+		RETURN n
+	`, map[string]any{"labels": labels})
+	if err != nil {
+		return fmt.Errorf("query unused tables: %w", err)
+	}
+
+	// 各节点的属性不完全相同，表头取所有属性的并集
+	uniqueKeys := make(map[string]bool)
+	var nodes []map[string]any
+	for result.Next(ctx) {
+		node, ok := result.Record().Values[0].(neo4j.Node)
+		if !ok {
+			continue
+		}
+		for key := range node.Props {
+			uniqueKeys[key] = true
+		}
+		nodes = append(nodes, node.Props)
+	}
+	if err := result.Err(); err != nil {
+		return err
+	}
+
+	headers := make([]string, 0, len(uniqueKeys))
+	for key := range uniqueKeys {
+		headers = append(headers, key)
+	}
+	sort.Strings(headers)
+
+	var out io.Writer = os.Stdout
+	if reportOutput != "-" {
+		f, err := os.Create(reportOutput)
+		if err != nil {
+			return err
+		}
+		defer safeClose(reportOutput, f)
+		out = f
+	}
+
+	cw := csv.NewWriter(out)
+	cw.Write(headers)
+	for _, props := range nodes {
+		row := make([]string, len(headers))
+		for i, header := range headers {
+			if value, ok := props[header]; ok {
+				row[i] = fmt.Sprint(value)
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	log.Infof("Unused tables: %d, written to %s", len(nodes), reportOutput)
+	return nil
+}
+
+// neo4jConfig 取第一个启用的 neo4j writer 的配置
+func neo4jConfig(cfg *C.StorageConfig) (*C.Neo4jService, error) {
+	for _, wc := range cfg.EnabledWriters() {
+		if wc.Type != "neo4j" {
+			continue
+		}
+		var c C.Neo4jService
+		ctx := &writer.WriterContext{Type: wc.Type, Settings: wc.Settings}
+		if err := ctx.Decode(&c); err != nil {
+			return nil, err
+		}
+		return &c, nil
+	}
+	return nil, errors.New("no neo4j writer enabled in storage")
+}
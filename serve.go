@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"pg_lineage/internal/catalog"
+	reader "pg_lineage/internal/lineage-reader"
+	"pg_lineage/internal/server"
+	"pg_lineage/pkg/log"
+)
+
+var (
+	serveAddr    string
+	serveBackend string
+	serveCatalog string
+)
+
+func serveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&serveAddr, "addr", ":8080", "listen address")
+	fs.StringVar(&serveBackend, "backend", "", "storage backend to query: neo4j | postgres | sqlite | json, default the first enabled")
+	fs.StringVar(&serveCatalog, "catalog", "", "catalog snapshot file used to resolve UDF calls in /api/parse")
+}
+
+// runServe 收到 SIGINT / SIGTERM 后等待处理中的请求结束再退出
+func runServe(a *app, args []string) error {
+	r, err := reader.Open(&a.config.Storage, serveBackend)
+	if err != nil {
+		return err
+	}
+	defer safeClose("lineage reader", r)
+
+	var cat catalog.Catalog
+	if serveCatalog != "" {
+		snapshot, err := catalog.Load(serveCatalog)
+		if err != nil {
+			return err
+		}
+		cat = snapshot
+	}
+
+	srv := &http.Server{
+		Addr:              serveAddr,
+		Handler:           server.New(r, cat),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Infof("Lineage API listening on %s", serveAddr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Infof("Shutting down lineage API")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}